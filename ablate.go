@@ -0,0 +1,117 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ablation disables a component of the network
+type Ablation struct {
+	Name  string
+	Apply func(net *Net) bool
+}
+
+// Ablations is the matrix of ablations, each disables one component,
+// Apply returns false when the component isn't enabled in the baseline
+var Ablations = []Ablation{
+	{"k", func(net *Net) bool {
+		net.Ablated.K = true
+		return true
+	}},
+	{"v", func(net *Net) bool {
+		net.Ablated.V = true
+		return true
+	}},
+	{"binarization", func(net *Net) bool {
+		net.Ablated.Binarize = true
+		return true
+	}},
+	{"window update", func(net *Net) bool {
+		net.Ablated.Update = true
+		return true
+	}},
+	{"normalization", func(net *Net) bool {
+		if !net.Normalize {
+			return false
+		}
+		net.Normalize = false
+		return true
+	}},
+}
+
+// AblationResult is the metrics of a run of an ablation
+type AblationResult struct {
+	Entropy     float64
+	CodeEntropy float64
+	Codes       []int
+	Seconds     float64
+}
+
+// RunAblation colors the data with a new network with the ablation applied,
+// returning false if the ablation doesn't apply
+func RunAblation(ablation *Ablation, data []byte) (AblationResult, bool) {
+	net := NewFlagNet(3)
+	if ablation != nil && !ablation.Apply(&net) {
+		return AblationResult{}, false
+	}
+	result := AblationResult{Codes: make([]int, 0, len(data))}
+	histogram := [len(Colors)]int{}
+	start := time.Now()
+	Color(&net, data, 0, nil, func(symbol Symbol) {
+		result.Entropy += float64(symbol.Entropy)
+		result.Codes = append(result.Codes, symbol.Code)
+		histogram[symbol.Code]++
+	})
+	result.Seconds = time.Since(start).Seconds()
+	result.Entropy /= float64(len(data))
+	result.CodeEntropy = Bits(histogram[:])
+	return result, true
+}
+
+// AblateCommand disables one component at a time and tabulates the change in the metrics
+func AblateCommand(args []string) {
+	flags := flag.NewFlagSet("ablate", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	offset := flags.Int("offset", 0, "offset of the slice of the corpus")
+	length := flags.Int("length", 4096, "length of the slice of the corpus, 0 for the rest of the corpus")
+	flags.Parse(args)
+
+	data := Load(*file)
+	if *offset > len(data) {
+		panic(fmt.Errorf("offset %d is past the end of the corpus of %d symbols", *offset, len(data)))
+	}
+	data = data[*offset:]
+	if *length > 0 && *length < len(data) {
+		data = data[:*length]
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	baseline, _ := RunAblation(nil, data)
+	fmt.Printf("%-14s %10s %10s %13s %10s %9s\n", "ablation", "entropy", "delta", "code entropy", "delta", "agreement")
+	fmt.Printf("%-14s %10f %10s %13f %10s %9s\n", "baseline", baseline.Entropy, "", baseline.CodeEntropy, "", "")
+	Metric("entropy", baseline.Entropy)
+	Metric("code_entropy", baseline.CodeEntropy)
+	for i := range Ablations {
+		ablation := &Ablations[i]
+		result, ok := RunAblation(ablation, data)
+		if !ok {
+			fmt.Printf("%-14s not enabled in the baseline\n", ablation.Name)
+			continue
+		}
+		agreement := NMI(baseline.Codes, result.Codes)
+		fmt.Printf("%-14s %10f %+10f %13f %+10f %9f\n", ablation.Name,
+			result.Entropy, result.Entropy-baseline.Entropy,
+			result.CodeEntropy, result.CodeEntropy-baseline.CodeEntropy, agreement)
+		name := strings.ReplaceAll(ablation.Name, " ", "_")
+		Metric(name+"_entropy_delta", result.Entropy-baseline.Entropy)
+		Metric(name+"_agreement", agreement)
+	}
+}
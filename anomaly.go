@@ -0,0 +1,124 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/fatih/color"
+)
+
+// Anomaly is a span of the corpus of unusually high entropy
+type Anomaly struct {
+	Offset  int     `json:"offset"`
+	Length  int     `json:"length"`
+	Line    int     `json:"line"`
+	Entropy float64 `json:"entropy"`
+	Score   float64 `json:"score"`
+	Before  string  `json:"before"`
+	Text    string  `json:"text"`
+	After   string  `json:"after"`
+}
+
+// Anomalies are the top spans of window symbols with the highest mean entropy, the spans don't overlap
+func Anomalies(entropies []float32, window, top int) []Anomaly {
+	if window > len(entropies) {
+		window = len(entropies)
+	}
+	if window < 1 {
+		return nil
+	}
+	sums := make([]float64, len(entropies)+1)
+	for i, entropy := range entropies {
+		sums[i+1] = sums[i] + float64(entropy)
+	}
+	means := make([]float64, len(entropies)-window+1)
+	for i := range means {
+		means[i] = (sums[i+window] - sums[i]) / float64(window)
+	}
+	mean, std := MeanStd(means)
+	order := make([]int, len(means))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return means[order[i]] > means[order[j]]
+	})
+	anomalies := []Anomaly{}
+	for _, offset := range order {
+		if len(anomalies) >= top {
+			break
+		}
+		overlaps := false
+		for _, anomaly := range anomalies {
+			if offset < anomaly.Offset+window && anomaly.Offset < offset+window {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		anomaly := Anomaly{Offset: offset, Length: window, Entropy: means[offset]}
+		if std > 0 {
+			anomaly.Score = (means[offset] - mean) / std
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+	return anomalies
+}
+
+// AnomalyCommand reports the spans of the corpus with the highest entropy along with the text around them,
+// which finds ocr garbage, corrupted encodings and inserted text
+func AnomalyCommand(args []string) {
+	flags := flag.NewFlagSet("anomaly", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	window := flags.Int("window", 32, "length of the spans in symbols")
+	top := flags.Int("top", 10, "number of spans to report")
+	context := flags.Int("context", 40, "number of symbols of context shown before and after a span")
+	details := OutputFlag(flags, "json", "", "file to write the spans to as json lines")
+	flags.Parse(args)
+	if *window < 1 || *top < 1 || *context < 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data := Load(*file)
+	_, entropies := Colorings(*model, data)
+	anomalies := Anomalies(entropies, *window, *top)
+	highlight, dim := color.New(color.ReverseVideo), color.New(color.Faint)
+	for i := range anomalies {
+		anomaly := &anomalies[i]
+		begin, end := max(0, anomaly.Offset-*context), min(len(data), anomaly.Offset+anomaly.Length+*context)
+		anomaly.Line = bytes.Count(data[:anomaly.Offset], []byte("\n")) + 1
+		anomaly.Before = string(data[begin:anomaly.Offset])
+		anomaly.Text = string(data[anomaly.Offset : anomaly.Offset+anomaly.Length])
+		anomaly.After = string(data[anomaly.Offset+anomaly.Length : end])
+		fmt.Printf("%3d offset %8d line %6d entropy %f score %7.3f\n", i+1, anomaly.Offset, anomaly.Line, anomaly.Entropy, anomaly.Score)
+		fmt.Printf("    %s%s%s\n", dim.Sprint(Printable(anomaly.Before)), highlight.Sprint(Printable(anomaly.Text)),
+			dim.Sprint(Printable(anomaly.After)))
+	}
+	Metric("anomalies", float64(len(anomalies)))
+
+	if *details != "" {
+		output, err := os.Create(*details)
+		if err != nil {
+			panic(err)
+		}
+		defer output.Close()
+		encoder := json.NewEncoder(output)
+		for _, anomaly := range anomalies {
+			if err := encoder.Encode(anomaly); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
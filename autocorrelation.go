@@ -0,0 +1,249 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"os"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// FFT computes the discrete fourier transform in place, the length must be a power of 2.
+// The inverse transform isn't scaled
+func FFT(x []complex128, inverse bool) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for begin := 0; begin < n; begin += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[begin+k], w*x[begin+k+size/2]
+				x[begin+k], x[begin+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+// Spectrum is the autocorrelation and spectral density of a series
+type Spectrum struct {
+	// Autocorrelation is the autocorrelation of each lag normalized by the variance
+	Autocorrelation []float64
+	// Power is the spectral density of each frequency bin of the padded series
+	Power []float64
+	// Length is the length of the padded series, frequency bin k has a period of Length/k
+	Length int
+}
+
+// NewSpectrum computes the autocorrelation up to lags and the periodogram of the series with the fft,
+// the series is zero padded so that the autocorrelation isn't circular
+func NewSpectrum(series []float64, lags int) Spectrum {
+	mean := 0.0
+	for _, v := range series {
+		mean += v
+	}
+	mean /= float64(len(series))
+	n := 1
+	for n < 2*len(series) {
+		n <<= 1
+	}
+	x := make([]complex128, n)
+	for i, v := range series {
+		x[i] = complex(v-mean, 0)
+	}
+	FFT(x, false)
+	spectrum := Spectrum{Power: make([]float64, n/2+1), Length: n}
+	for i := range x {
+		power := real(x[i])*real(x[i]) + imag(x[i])*imag(x[i])
+		if i < len(spectrum.Power) {
+			spectrum.Power[i] = power / float64(len(series))
+		}
+		x[i] = complex(power, 0)
+	}
+	FFT(x, true)
+	lags = min(lags, len(series)-1)
+	spectrum.Autocorrelation = make([]float64, lags+1)
+	if variance := real(x[0]); variance > 0 {
+		for lag := range spectrum.Autocorrelation {
+			spectrum.Autocorrelation[lag] = real(x[lag]) / variance
+		}
+	}
+	return spectrum
+}
+
+// Peak is a dominant periodicity
+type Peak struct {
+	Period float64
+	Value  float64
+}
+
+// Peaks are the top local maxima of the values, the period of index i is period(i)
+func Peaks(values []float64, begin, end int, period func(i int) float64, top int) []Peak {
+	peaks := []Peak{}
+	for i := max(begin, 1); i < min(end, len(values)-1); i++ {
+		if values[i] > values[i-1] && values[i] >= values[i+1] {
+			peaks = append(peaks, Peak{Period: period(i), Value: values[i]})
+		}
+	}
+	sort.SliceStable(peaks, func(i, j int) bool {
+		return peaks[i].Value > peaks[j].Value
+	})
+	return peaks[:min(top, len(peaks))]
+}
+
+// WriteCSV writes the rows to a csv file
+func WriteCSV(file string, header []string, rows [][]string) {
+	output, err := os.Create(file)
+	if err != nil {
+		panic(err)
+	}
+	defer output.Close()
+	writer := csv.NewWriter(output)
+	if err := writer.Write(header); err != nil {
+		panic(err)
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		panic(err)
+	}
+}
+
+// PlotSpectrum plots the autocorrelation over the lags and the spectral density over the periods up to lags
+func PlotSpectrum(file string, spectrum Spectrum) {
+	acf := plot.New()
+	acf.Title.Text = "autocorrelation of the entropy"
+	acf.X.Label.Text = "lag"
+	acf.Y.Label.Text = "autocorrelation"
+	points := make(plotter.XYs, 0, len(spectrum.Autocorrelation))
+	for lag, v := range spectrum.Autocorrelation {
+		points = append(points, plotter.XY{X: float64(lag), Y: v})
+	}
+	line, err := plotter.NewLine(points)
+	if err != nil {
+		panic(err)
+	}
+	acf.Add(line)
+
+	psd := plot.New()
+	psd.Title.Text = "spectral density of the entropy"
+	psd.X.Label.Text = "period"
+	psd.Y.Label.Text = "power"
+	points = plotter.XYs{}
+	lags := float64(len(spectrum.Autocorrelation) - 1)
+	for k := len(spectrum.Power) - 1; k > 0; k-- {
+		if period := float64(spectrum.Length) / float64(k); period <= lags {
+			points = append(points, plotter.XY{X: period, Y: spectrum.Power[k]})
+		}
+	}
+	line, err = plotter.NewLine(points)
+	if err != nil {
+		panic(err)
+	}
+	psd.Add(line)
+
+	img := vgimg.New(8*vg.Inch, 8*vg.Inch)
+	canvases := plot.Align([][]*plot.Plot{{acf}, {psd}}, draw.Tiles{Rows: 2, Cols: 1}, draw.New(img))
+	acf.Draw(canvases[0][0])
+	psd.Draw(canvases[1][0])
+	output, err := os.Create(file)
+	if err != nil {
+		panic(err)
+	}
+	defer output.Close()
+	if _, err := (vgimg.PngCanvas{Canvas: img}).WriteTo(output); err != nil {
+		panic(err)
+	}
+}
+
+// AutocorrelationCommand reports the dominant periodicities of the entropy of the corpus from its autocorrelation
+// and spectral density
+func AutocorrelationCommand(args []string) {
+	flags := flag.NewFlagSet("autocorrelation", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	length := flags.Int("length", 0, "length of the slice of the corpus, 0 for the whole corpus")
+	lags := flags.Int("lags", 512, "largest lag of the autocorrelation and period of the spectral density")
+	top := flags.Int("top", 5, "number of dominant periodicities reported")
+	acf := OutputFlag(flags, "acf", "autocorrelation.csv", "the csv file the autocorrelation is written to")
+	psd := OutputFlag(flags, "psd", "spectrum.csv", "the csv file the spectral density is written to")
+	image := OutputFlag(flags, "plot", "", "the png file the autocorrelation and spectral density are plotted to, no plot when empty")
+	flags.Parse(args)
+
+	data := Load(*file)
+	if *length > 0 && *length < len(data) {
+		data = data[:*length]
+	}
+	if len(data) < 3 {
+		return
+	}
+	_, entropies := Colorings(*model, data)
+	series := make([]float64, len(entropies))
+	for i, entropy := range entropies {
+		series[i] = float64(entropy)
+	}
+	spectrum := NewSpectrum(series, *lags)
+	maximum := len(spectrum.Autocorrelation) - 1
+
+	fmt.Printf("autocorrelation peaks over %d symbols\n", len(series))
+	for _, peak := range Peaks(spectrum.Autocorrelation, 2, len(spectrum.Autocorrelation), func(i int) float64 {
+		return float64(i)
+	}, *top) {
+		fmt.Printf("  lag %8.0f autocorrelation %f\n", peak.Period, peak.Value)
+	}
+	fmt.Printf("spectral density peaks\n")
+	// the frequency bins with periods from 2 up to the largest lag
+	begin := (spectrum.Length + maximum - 1) / max(maximum, 1)
+	for _, peak := range Peaks(spectrum.Power, begin, spectrum.Length/2, func(k int) float64 {
+		return float64(spectrum.Length) / float64(k)
+	}, *top) {
+		fmt.Printf("  period %8.2f power %f\n", peak.Period, peak.Value)
+	}
+
+	rows := [][]string{}
+	for lag, v := range spectrum.Autocorrelation {
+		rows = append(rows, []string{strconv.Itoa(lag), strconv.FormatFloat(v, 'g', -1, 64)})
+	}
+	WriteCSV(*acf, []string{"lag", "autocorrelation"}, rows)
+	rows = rows[:0]
+	for k, power := range spectrum.Power {
+		frequency := float64(k) / float64(spectrum.Length)
+		period := math.Inf(1)
+		if k > 0 {
+			period = 1 / frequency
+		}
+		rows = append(rows, []string{strconv.FormatFloat(frequency, 'g', -1, 64), strconv.FormatFloat(period, 'g', -1, 64),
+			strconv.FormatFloat(power, 'g', -1, 64)})
+	}
+	WriteCSV(*psd, []string{"frequency", "period", "power"}, rows)
+	fmt.Printf("wrote the autocorrelation to %s and the spectral density to %s\n", *acf, *psd)
+	if *image != "" {
+		PlotSpectrum(*image, spectrum)
+		fmt.Printf("wrote the plot to %s\n", *image)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Candidates are the count best systems of the value branch of the last layer of the last fire, in the order
+// of the objective. The outputs are only valid until the next fire
+func (n *Net) Candidates(count int) []Sample {
+	last := n
+	if len(n.Layers) > 0 {
+		last = &n.Layers[len(n.Layers)-1]
+	}
+	systems := last.scratch.Branches[2].Systems
+	return systems[:min(count, len(systems))]
+}
+
+// Beam is a path of a beam search, the paths share their beginnings through the parents.
+// The jumps skip back along the parents so the ancestors are found in logarithmic time
+type Beam struct {
+	Parent   *Beam
+	Jump     *Beam
+	Position int
+	Code     int
+	Depth    int
+	Entropy  float64
+}
+
+// NewBeam makes the path continuing the parent to the position, a nil parent starts a path
+func NewBeam(parent *Beam, position int) *Beam {
+	b := &Beam{Parent: parent, Position: position}
+	if parent == nil {
+		b.Jump = b
+		return b
+	}
+	b.Depth, b.Jump = parent.Depth+1, parent
+	if jump := parent.Jump; parent.Depth-jump.Depth == jump.Depth-jump.Jump.Depth {
+		b.Jump = jump.Jump
+	}
+	return b
+}
+
+// Ancestor is the beginning of the path at the depth
+func (b *Beam) Ancestor(depth int) *Beam {
+	for b.Depth > depth {
+		if b.Jump.Depth >= depth {
+			b = b.Jump
+		} else {
+			b = b.Parent
+		}
+	}
+	return b
+}
+
+// Visited reports whether the path passed through one of the beams
+func (b *Beam) Visited(beams []*Beam) bool {
+	for _, beam := range beams {
+		if beam.Depth <= b.Depth && b.Ancestor(beam.Depth) == beam {
+			return true
+		}
+	}
+	return false
+}
+
+// Path are the jumps of the path after the depth
+func (b *Beam) Path(depth int) []Jump {
+	jumps := make([]Jump, max(b.Depth-depth, 0))
+	for ; b.Depth > depth; b = b.Parent {
+		jumps[b.Depth-depth-1] = Jump{From: b.Parent.Position, To: b.Position, Addressed: b.Position, Code: b.Code}
+	}
+	return jumps
+}
+
+// Shared is the longest beginning the paths share
+func Shared(beams []*Beam, from *Beam) *Beam {
+	shares := func(depth int) bool {
+		ancestor := beams[0].Ancestor(depth)
+		for _, beam := range beams[1:] {
+			if beam.Ancestor(depth) != ancestor {
+				return false
+			}
+		}
+		return true
+	}
+	low, high := from.Depth, beams[0].Depth
+	for low < high {
+		if middle := (low + high + 1) / 2; shares(middle) {
+			low = middle
+		} else {
+			high = middle - 1
+		}
+	}
+	return beams[0].Ancestor(low)
+}
+
+// Searched is the summary of a beam search
+type Searched struct {
+	Best     *Beam
+	Width    int
+	Expanded int
+	Stop     string
+}
+
+// String is the summary printed at the end of a beam search
+func (s Searched) String() string {
+	return fmt.Sprintf("stopped on %s with a beam of %d after %d expansions, best path of %d jumps with cumulative entropy %f",
+		s.Stop, s.Width, s.Expanded, s.Best.Depth, s.Best.Entropy)
+}
+
+// BeamSearch wanders the tokens from position keeping the width paths of lowest cumulative entropy. Each path is expanded
+// by firing the network at its end and jumping to the positions addressed by the codes of the width best value systems,
+// a path that would revisit one of its own positions is pruned. The paths share the network, which keeps learning as it
+// fires. fn is called with the jumps of the best path as soon as every path shares them, the rest of the best path
+// follows when the search stops. The search stops when every path is pruned, a path visits every position or a stop
+// condition of the walk fires
+func BeamSearch(net *Net, tokens []Token, position, width int, walk Walk, done <-chan struct{}, fn func(jump Jump)) Searched {
+	length, start := len(tokens), time.Now()
+	searched := Searched{Best: NewBeam(nil, position), Width: width}
+	if length == 0 {
+		searched.Stop = StopCovered
+		return searched
+	}
+	// the beams of each position, shared is the beginning of the paths the jumps are written up to
+	in, beam, beams, shared := NewInput(net), []*Beam{searched.Best}, map[int][]*Beam{position: {searched.Best}}, searched.Best
+	defer func() {
+		for _, jump := range searched.Best.Path(shared.Depth) {
+			fn(jump)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			searched.Stop = StopInterrupted
+			return searched
+		default:
+		}
+		switch {
+		case walk.MaxSteps > 0 && searched.Best.Depth >= walk.MaxSteps:
+			searched.Stop = StopSteps
+		case walk.MaxDuration > 0 && time.Since(start) >= walk.MaxDuration:
+			searched.Stop = StopSeconds
+		case searched.Best.Depth+1 >= length:
+			searched.Stop = StopCovered
+		}
+		if searched.Stop != "" {
+			return searched
+		}
+
+		expansions, best := []*Beam{}, make(map[int]*Beam)
+		for _, path := range beam {
+			net.InputTokens(in, tokens, path.Position)
+			net.Fire(in)
+			frozen := net.Frozen
+			net.Frozen = true
+			for _, candidate := range net.Candidates(width) {
+				code := net.Decode(candidate.Outputs).Label
+				next := code % length
+				if path.Visited(beams[next]) {
+					continue
+				}
+				expansion := NewBeam(path, next)
+				expansion.Code, expansion.Entropy = code, path.Entropy+float64(candidate.Entropy)
+				if other, ok := best[next]; !ok || expansion.Entropy < other.Entropy {
+					if !ok {
+						expansions = append(expansions, expansion)
+					} else {
+						*other = *expansion
+						continue
+					}
+					best[next] = expansion
+				}
+			}
+			net.Frozen = frozen
+			searched.Expanded++
+		}
+		if len(expansions) == 0 {
+			searched.Stop = StopRevisit
+			return searched
+		}
+		sort.SliceStable(expansions, func(i, j int) bool {
+			return expansions[i].Entropy < expansions[j].Entropy
+		})
+		beam = expansions[:min(width, len(expansions))]
+		for _, path := range beam {
+			beams[path.Position] = append(beams[path.Position], path)
+		}
+		searched.Best = beam[0]
+		if next := Shared(beam, shared); next != shared {
+			for _, jump := range next.Path(shared.Depth) {
+				fn(jump)
+			}
+			shared = next
+		}
+		Trace("beam", "depth", searched.Best.Depth, "paths", len(beam), "entropy", searched.Best.Entropy)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Direction is the strong direction of a text
+type Direction int
+
+const (
+	// DirectionNeutral is a text without strongly directional runes
+	DirectionNeutral Direction = iota
+	// DirectionLTR is left to right text
+	DirectionLTR
+	// DirectionRTL is right to left text
+	DirectionRTL
+)
+
+// RTL are the scripts written right to left
+var RTL = []*unicode.RangeTable{
+	unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana,
+	unicode.Nko, unicode.Samaritan, unicode.Mandaic, unicode.Adlam,
+}
+
+// TextDirection is the direction of the first strongly directional rune of the text, only letters are strongly directional
+func TextDirection(text string) Direction {
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.In(r, RTL...) {
+			return DirectionRTL
+		}
+		return DirectionLTR
+	}
+	return DirectionNeutral
+}
+
+// Bidi collects the runs of right to left symbols that are isolated when rendered, so the coloring
+// of each symbol doesn't scramble the visual order. A run is the half open range of the symbols from
+// the first to the last right to left symbol with no left to right symbol or line break in between
+type Bidi struct {
+	Runs  [][2]int
+	open  bool
+	begin int
+	end   int
+}
+
+// Add adds the text of the symbol at index
+func (b *Bidi) Add(index int, text string) {
+	switch TextDirection(text) {
+	case DirectionRTL:
+		if !b.open {
+			b.open, b.begin = true, index
+		}
+		b.end = index + 1
+	case DirectionLTR:
+		b.Close()
+	default:
+		if strings.ContainsAny(text, "\n\r\u2029") {
+			b.Close()
+		}
+	}
+}
+
+// Close ends the current run
+func (b *Bidi) Close() {
+	if b.open {
+		b.Runs = append(b.Runs, [2]int{b.begin, b.end})
+		b.open = false
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bpe implements a byte pair encoding tokenizer
+package bpe
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Bytes is the number of byte tokens every vocabulary starts with
+const Bytes = 256
+
+// Pair is a pair of adjacent tokens
+type Pair [2]int
+
+// Vocab is a byte pair encoding vocabulary, the first 256 tokens are the bytes
+// and every merge adds a token
+type Vocab struct {
+	Merges []Pair `json:"merges"`
+	tokens [][]byte
+}
+
+// NewVocab makes a vocabulary from merges
+func NewVocab(merges []Pair) (*Vocab, error) {
+	v := &Vocab{
+		Merges: merges,
+		tokens: make([][]byte, Bytes, Bytes+len(merges)),
+	}
+	for i := range v.tokens[:Bytes] {
+		v.tokens[i] = []byte{byte(i)}
+	}
+	for i, merge := range merges {
+		id := Bytes + i
+		if merge[0] < 0 || merge[0] >= id || merge[1] < 0 || merge[1] >= id {
+			return nil, fmt.Errorf("merge %d references unknown token", i)
+		}
+		token := append(append([]byte{}, v.tokens[merge[0]]...), v.tokens[merge[1]]...)
+		v.tokens = append(v.tokens, token)
+	}
+	return v, nil
+}
+
+// Train learns a vocabulary of up to size tokens from the data by repeatedly merging
+// the most frequent pair of adjacent tokens
+func Train(data []byte, size int) *Vocab {
+	ids := make([]int, len(data))
+	for i, b := range data {
+		ids[i] = int(b)
+	}
+	merges := []Pair{}
+	for Bytes+len(merges) < size {
+		counts := make(map[Pair]int)
+		for i := 0; i+1 < len(ids); i++ {
+			counts[Pair{ids[i], ids[i+1]}]++
+		}
+		best, count := Pair{}, 1
+		for pair, c := range counts {
+			if c > count || (c == count && count > 1 && less(pair, best)) {
+				best, count = pair, c
+			}
+		}
+		if count < 2 {
+			break
+		}
+		ids = merge(ids, best, Bytes+len(merges))
+		merges = append(merges, best)
+	}
+	v, err := NewVocab(merges)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func less(a, b Pair) bool {
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+	return a[1] < b[1]
+}
+
+// merge replaces each occurrence of the pair with the token
+func merge(ids []int, pair Pair, token int) []int {
+	merged := ids[:0]
+	for i := 0; i < len(ids); i++ {
+		if i+1 < len(ids) && ids[i] == pair[0] && ids[i+1] == pair[1] {
+			merged = append(merged, token)
+			i++
+			continue
+		}
+		merged = append(merged, ids[i])
+	}
+	return merged
+}
+
+// Size is the number of tokens in the vocabulary
+func (v *Vocab) Size() int {
+	return len(v.tokens)
+}
+
+// Token is the bytes of a token
+func (v *Vocab) Token(id int) []byte {
+	return v.tokens[id]
+}
+
+// Encode encodes the data into tokens by applying the merges in order
+func (v *Vocab) Encode(data []byte) []int {
+	ids := make([]int, len(data))
+	for i, b := range data {
+		ids[i] = int(b)
+	}
+	for i, pair := range v.Merges {
+		ids = merge(ids, pair, Bytes+i)
+	}
+	return ids
+}
+
+// Decode decodes the tokens into data
+func (v *Vocab) Decode(ids []int) []byte {
+	data := []byte{}
+	for _, id := range ids {
+		data = append(data, v.tokens[id]...)
+	}
+	return data
+}
+
+// Save saves the vocabulary as json
+func (v *Vocab) Save(file string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// Load loads a json vocabulary
+func Load(file string) (*Vocab, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var v Vocab
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return NewVocab(v.Merges)
+}
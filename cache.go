@@ -0,0 +1,335 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// FlagReuse reuses the artifacts of an identical recorded run in place of running the command again
+var FlagReuse = flag.Bool("reuse", false, "reuse the output of an identical run recorded in the runs directory instead of running again")
+
+// OutputFlags are the names of the flags naming files that are written rather than read, registered by OutputFlag.
+// Their contents aren't part of the key of a run and they are stored as the artifacts of the run
+var OutputFlags = map[string]bool{}
+
+// outputs are the values of the output flags
+var outputs []*string
+
+// RunFlags are the flags of the directories of the runs and of the downloads, which aren't inputs of a run
+var RunFlags = map[string]bool{
+	"runs":  true,
+	"cache": true,
+}
+
+// OutputFlag defines a string flag naming a file the command writes, registering it as an output flag
+func OutputFlag(flags *flag.FlagSet, name, value, usage string) *string {
+	output := flags.String(name, value, usage)
+	OutputFlags[name], outputs = true, append(outputs, output)
+	return output
+}
+
+// Artifact is a file written by a run, stored in the directory of the run
+type Artifact struct {
+	Path string `json:"path"`
+	File string `json:"file"`
+}
+
+// Checksum is the sha256 of the contents of a file
+func Checksum(file string) (string, error) {
+	input, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer input.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, input); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Version is the checksum of the executable, which identifies the version of the code
+var Version = sync.OnceValue(func() string {
+	executable, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	checksum, err := Checksum(executable)
+	if err != nil {
+		return ""
+	}
+	return checksum
+})
+
+// Inputs are the checksums of the files named by the flags and arguments of a run that aren't named by the output flags,
+// directories and globs are expanded
+func Inputs(flags map[string]string, args []string, outputs map[string]bool) map[string]string {
+	inputs := make(map[string]string)
+	add := func(value string) {
+		if value == "" || value == "-" || IsURL(value) {
+			return
+		}
+		if _, err := os.Stat(value); err != nil && !strings.ContainsAny(value, "*?[") {
+			return
+		}
+		for _, file := range Files(value) {
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				if checksum, err := Checksum(file); err == nil {
+					inputs[file] = checksum
+				}
+			}
+		}
+	}
+	skip := func(name string) bool {
+		return outputs[name] || RunFlags[name]
+	}
+	for name, value := range flags {
+		if !skip(name) {
+			add(value)
+		}
+	}
+	for i, arg := range args {
+		name, value, ok := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case strings.HasPrefix(arg, "-") && skip(name):
+		case ok && strings.HasPrefix(arg, "-"):
+			add(value)
+		case i > 0 && strings.HasPrefix(args[i-1], "-") && skip(strings.TrimLeft(args[i-1], "-")):
+		default:
+			add(arg)
+		}
+	}
+	return inputs
+}
+
+// Outputs are the names of the output flags of a run, those registered so far along with those the run recorded
+func (m Manifest) Outputs() map[string]bool {
+	names := make(map[string]bool)
+	for name := range OutputFlags {
+		names[name] = true
+	}
+	for _, name := range m.OutputFlags {
+		names[name] = true
+	}
+	return names
+}
+
+// Hash is the checksum of everything that determines the results of the run: the command, its arguments,
+// the flags, the checksums of the inputs and the version of the code
+func (m Manifest) Hash() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00", m.Version, m.Command)
+	for _, arg := range m.Args {
+		fmt.Fprintf(hash, "%s\x00", arg)
+	}
+	names := make([]string, 0, len(m.Flags))
+	for name := range m.Flags {
+		if name != "runs" && name != "reuse" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s=%s\x00", name, m.Flags[name])
+	}
+	files := make([]string, 0, len(m.Inputs))
+	for file := range m.Inputs {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s=%s\x00", file, m.Inputs[file])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// OutputFiles are the files named by the output flags: the registered flags that are set and,
+// for the flags that weren't registered while the run started, the values of the output flags in the arguments.
+// A directory stands for the files in it
+func OutputFiles(args []string) []string {
+	values := []string{}
+	for _, output := range outputs {
+		values = append(values, *output)
+	}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !OutputFlags[name] {
+			continue
+		}
+		if !ok && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		values = append(values, value)
+	}
+	files, seen := []string{}, make(map[string]bool)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	for _, value := range values {
+		if value == "" || value == "-" || IsURL(value) {
+			continue
+		}
+		info, err := os.Stat(value)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			add(value)
+			continue
+		}
+		entries, err := os.ReadDir(value)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				add(filepath.Join(value, entry.Name()))
+			}
+		}
+	}
+	return files
+}
+
+// Capture tees the standard output of the run into the stdout file of the run
+func (r *Run) Capture() {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+	file, err := os.Create(filepath.Join(r.Dir, "stdout"))
+	if err != nil {
+		panic(err)
+	}
+	stdout, done := os.Stdout, make(chan struct{})
+	go func() {
+		defer close(done)
+		defer file.Close()
+		io.Copy(io.MultiWriter(stdout, file), reader)
+	}()
+	output := color.Output
+	os.Stdout, color.Output = writer, writer
+	r.release = func() {
+		writer.Close()
+		<-done
+		os.Stdout, color.Output = stdout, output
+	}
+}
+
+// Store stops capturing the standard output and copies the files the run wrote to its output flags into its artifacts,
+// the files that weren't written during the run are left out
+func (r *Run) Store(args []string) {
+	if r.release != nil {
+		r.release()
+	}
+	for name := range OutputFlags {
+		r.Manifest.OutputFlags = append(r.Manifest.OutputFlags, name)
+	}
+	sort.Strings(r.Manifest.OutputFlags)
+	for i, path := range OutputFiles(args) {
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || info.ModTime().Before(r.Manifest.Start) {
+			continue
+		}
+		name := fmt.Sprintf("artifact-%d-%s", i, filepath.Base(path))
+		if err := Copy(path, filepath.Join(r.Dir, name)); err != nil {
+			continue
+		}
+		r.Manifest.Artifacts = append(r.Manifest.Artifacts, Artifact{Path: path, File: name})
+	}
+}
+
+// Replay writes the standard output of the run to stdout and restores its artifacts
+func (r *Run) Replay() error {
+	stdout, err := os.Open(filepath.Join(r.Dir, "stdout"))
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	if _, err := io.Copy(os.Stdout, stdout); err != nil {
+		return err
+	}
+	for _, artifact := range r.Manifest.Artifacts {
+		if err := os.MkdirAll(filepath.Dir(artifact.Path), 0755); err != nil {
+			return err
+		}
+		if err := Copy(filepath.Join(r.Dir, artifact.File), artifact.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reuse replays the latest complete recorded run with the key of the manifest, returning false if there isn't one.
+// The key of each recorded run is recomputed with its output flags, which include those of its command
+func Reuse(manifest Manifest) bool {
+	runs, err := LoadRuns(*FlagRuns)
+	if err != nil {
+		return false
+	}
+	keys := make(map[string]string)
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if run.Manifest.Command != manifest.Command || run.Manifest.Interrupted {
+			continue
+		}
+		manifest.OutputFlags = run.Manifest.OutputFlags
+		names := strings.Join(manifest.OutputFlags, ",")
+		key, ok := keys[names]
+		if !ok {
+			manifest.Inputs = Inputs(manifest.Flags, manifest.Args, manifest.Outputs())
+			key = manifest.Hash()
+			keys[names] = key
+		}
+		if run.Manifest.Key != key {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(run.Dir, "stdout")); err != nil {
+			continue
+		}
+		if err := run.Replay(); err != nil {
+			panic(err)
+		}
+		slog.Info("reused run", "dir", run.Dir)
+		return true
+	}
+	return false
+}
+
+// Copy copies a file
+func Copy(from, to string) error {
+	input, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	output, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
@@ -0,0 +1,321 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	text "text/template"
+	"time"
+)
+
+const (
+	// FormatMarkdown is markdown output
+	FormatMarkdown = "markdown"
+	// FormatHTML is html output
+	FormatHTML = "html"
+	// CollapsedStdDev is the standard deviation below which a weight of the statistics has collapsed
+	CollapsedStdDev = 1e-3
+)
+
+//go:embed ui/card.html
+var card string
+
+// CardTemplate is the template of the html model card
+var CardTemplate = template.Must(template.New("card").Funcs(template.FuncMap{"hex": Hex}).Parse(card))
+
+// CardMarkdown is the template of the markdown model card
+var CardMarkdown = text.Must(text.New("card").Parse(`# Model card: {{.Name}}
+
+| | |
+|---|---|
+| file | {{.Name}} |
+| size | {{.Size}} bytes |
+| sha256 | {{.Checksum}} |
+
+## Architecture
+
+| parameter | value |
+|---|---|
+{{range .Architecture}}| {{.Name}} | {{.Value}} |
+{{end}}
+## Training
+{{if .Trained}}
+| | |
+|---|---|
+| started | {{.Provenance.Start.Format "2006-01-02 15:04:05 MST"}} |
+| duration | {{.Duration}} |
+| epochs | {{.Provenance.Epochs}} |
+| symbols | {{.Provenance.Symbols}} |
+| updates | {{.Provenance.Updates}} |
+| code version | {{.Provenance.Version}} |
+
+| corpus file | size | sha256 |
+|---|---|---|
+{{range .Provenance.Corpus}}| {{.Name}} | {{.Size}} | {{.Checksum}} |
+{{end}}
+### Hyperparameters
+
+| flag | value |
+|---|---|
+{{range .Hyperparameters}}| {{.Name}} | {{.Value}} |
+{{end}}{{else}}
+The model doesn't record how it was trained.
+{{end}}
+## Metrics
+
+| metric | value |
+|---|---|
+{{range .Metrics}}| {{.Name}} | {{.Value}} |
+{{end}}
+## Code distribution{{if .Evaluation}} on {{.Evaluation}}{{end}}
+
+| code | count | share |
+|---|---|---|
+{{range .Codes}}| {{.Code}} | {{.Count}} | {{printf "%.4f" .Share}} |
+{{end}}
+## Stability
+
+| indicator | value |
+|---|---|
+{{range .Stability}}| {{.Name}} | {{.Value}} |
+{{end}}
+## Known limitations
+{{range .Limitations}}
+- {{.}}{{end}}
+`))
+
+// Field is a named value of a model card
+type Field struct {
+	Name  string
+	Value string
+}
+
+// CodeShare is the share of a code of the coloring of a corpus
+type CodeShare struct {
+	Code  int
+	Count int
+	Share float64
+}
+
+// Percent is the share as a percentage
+func (c CodeShare) Percent() float64 {
+	return 100 * c.Share
+}
+
+// Card is a human readable report of a model
+type Card struct {
+	Name            string
+	Size            int64
+	Checksum        string
+	Architecture    []Field
+	Trained         bool
+	Provenance      Provenance
+	Hyperparameters []Field
+	Metrics         []Field
+	Evaluation      string
+	Codes           []CodeShare
+	Stability       []Field
+	Limitations     []string
+}
+
+// Duration is the training duration of the model
+func (c Card) Duration() string {
+	return time.Duration(c.Provenance.Duration * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// Shares computes the shares of the codes of a histogram
+func Shares(histogram []int) []CodeShare {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+	shares := []CodeShare{}
+	for code, count := range histogram {
+		if total > 0 {
+			shares = append(shares, CodeShare{Code: code, Count: count, Share: float64(count) / float64(total)})
+		}
+	}
+	return shares
+}
+
+// NewCard makes the model card of a model file, evaluating the frozen model on the corpus if it isn't empty
+func NewCard(model, corpus string) Card {
+	info, err := os.Stat(model)
+	if err != nil {
+		panic(err)
+	}
+	checksum, err := Checksum(model)
+	if err != nil {
+		panic(err)
+	}
+	checkpoint, err := LoadCheckpoint(model)
+	if err != nil {
+		panic(err)
+	}
+	net, err := LoadNet(model)
+	if err != nil {
+		panic(err)
+	}
+	net.Frozen = true
+	c := Card{
+		Name:       filepath.Base(model),
+		Size:       info.Size(),
+		Checksum:   checksum,
+		Provenance: checkpoint.Provenance,
+		Trained:    len(checkpoint.Provenance.Corpus) > 0,
+	}
+	add := func(fields *[]Field, name string, format string, a ...interface{}) {
+		*fields = append(*fields, Field{Name: name, Value: fmt.Sprintf(format, a...)})
+	}
+	decoder := checkpoint.Decoder
+	if decoder == "" {
+		decoder = "sign"
+	}
+	add(&c.Architecture, "inputs", "%d", net.Inputs)
+	add(&c.Architecture, "outputs (code bits)", "%d", net.Outputs)
+	add(&c.Architecture, "embedding size", "%d", net.EmbeddingSize())
+	add(&c.Architecture, "embedding", "%s", EmbedDescription())
+	add(&c.Architecture, "context", "%d %s", net.Context, net.ContextMode)
+	add(&c.Architecture, "recurrent", "%t", net.Recurrence.Enabled)
+	add(&c.Architecture, "layers", "%d", len(net.Layers)+1)
+	add(&c.Architecture, "window", "%d", checkpoint.Window)
+	add(&c.Architecture, "decoder", "%s", decoder)
+	add(&c.Architecture, "mapping", "%s", net.Mapping)
+	weights := net.Sampling.Weights
+	if weights == "" {
+		weights = WeightsBinary
+	}
+	add(&c.Architecture, "weights", "%s", weights)
+	add(&c.Architecture, "top k", "%d %s", net.TopK, net.TopKWeight)
+	add(&c.Architecture, "selection", "%s", net.Selection)
+	add(&c.Architecture, "objective", "%s", net.Objective.Mode)
+
+	names := make([]string, 0, len(c.Provenance.Flags))
+	for name := range c.Provenance.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := c.Provenance.Flags[name]
+		if f := flag.Lookup(name); f != nil && f.DefValue == value {
+			continue
+		}
+		add(&c.Hyperparameters, name, "%s", value)
+	}
+
+	histogram := c.Provenance.Codes
+	if c.Trained {
+		add(&c.Metrics, "training mean entropy", "%f", c.Provenance.Entropy)
+		add(&c.Metrics, "training code entropy", "%f bits", Bits(histogram))
+	}
+	if corpus != "" {
+		data := Load(corpus)
+		histogram = make([]int, net.Codes())
+		entropy := 0.0
+		Color(&net, data, 0, nil, func(symbol Symbol) {
+			histogram[symbol.Code]++
+			entropy += float64(symbol.Entropy)
+		})
+		c.Evaluation = filepath.Base(corpus)
+		if len(data) > 0 {
+			add(&c.Metrics, "evaluation mean entropy", "%f", entropy/float64(len(data)))
+		}
+		add(&c.Metrics, "evaluation code entropy", "%f bits", Bits(histogram))
+	}
+	c.Codes = Shares(histogram)
+
+	stddev, collapsed, count := net.MeanStdDev(), 0, 0
+	for _, set := range [...]Set{net.Q, net.K, net.V} {
+		for _, row := range set {
+			for _, random := range row {
+				if random.StdDev < CollapsedStdDev {
+					collapsed++
+				}
+				count++
+			}
+		}
+	}
+	add(&c.Stability, "mean standard deviation of the statistics", "%g", stddev)
+	add(&c.Stability, "collapsed weights", "%d of %d", collapsed, count)
+	unused := 0
+	for _, share := range c.Codes {
+		if share.Count == 0 {
+			unused++
+		}
+	}
+	add(&c.Stability, "unused codes", "%d of %d", unused, len(c.Codes))
+	if len(c.Codes) > 0 {
+		add(&c.Stability, "code balance", "%f", Bits(histogram)/math.Log2(float64(len(c.Codes))))
+	}
+
+	c.Limitations = append(c.Limitations,
+		"The codes are unsupervised, their meaning has to be established by inspecting the colored text.",
+		"The statistics are updated online, a frozen model colors differently than the network that trained it.",
+		fmt.Sprintf("The embeddings are %s, the model has to be used with the same -embed, -ngram, -positional and -size.",
+			EmbedDescription()))
+	if !c.Trained {
+		c.Limitations = append(c.Limitations, "The corpus and hyperparameters of the training are unknown.")
+	} else if c.Provenance.Symbols < 1<<20 {
+		c.Limitations = append(c.Limitations, fmt.Sprintf("The model was trained on only %d symbols.", c.Provenance.Symbols))
+	}
+	if count > 0 && collapsed == count {
+		c.Limitations = append(c.Limitations, "The statistics have collapsed, the sampled weights no longer vary.")
+	}
+	if unused > 0 {
+		c.Limitations = append(c.Limitations, fmt.Sprintf("%d of the codes are never used.", unused))
+	}
+	return c
+}
+
+// Write writes the card in the format
+func (c Card) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatMarkdown:
+		return CardMarkdown.Execute(w, c)
+	case FormatHTML:
+		return CardTemplate.Execute(w, c)
+	}
+	return fmt.Errorf("unknown format %s", format)
+}
+
+// CardCommand writes the model card of a model
+func CardCommand(args []string) {
+	flags := flag.NewFlagSet("card", flag.ExitOnError)
+	model := flags.String("model", "", "the model to describe")
+	corpus := flags.String("f", "", "the corpus the frozen model is evaluated on, no evaluation when empty")
+	output := OutputFlag(flags, "o", "card.md", "the file the card is written to")
+	format := flags.String("format", "", "the format of the card: markdown or html, from the extension of the output when empty")
+	flags.Parse(args)
+	if *model == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = FormatMarkdown
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".html" || ext == ".htm" {
+			*format = FormatHTML
+		}
+	}
+
+	c := NewCard(*model, *corpus)
+	out, err := os.Create(*output)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	if err := c.Write(out, *format); err != nil {
+		panic(err)
+	}
+	fmt.Printf("wrote the card of %s to %s\n", *model, *output)
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/fatih/color"
+)
+
+const (
+	// SeriesEntropy detects shifts of the mean of the entropy
+	SeriesEntropy = "entropy"
+	// SeriesCode detects shifts of the distribution of the codes
+	SeriesCode = "code"
+)
+
+// Changepoint is a structural break of a series
+type Changepoint struct {
+	// Position is the position of the first symbol after the break
+	Position int
+	// Score is the likelihood ratio statistic of the break
+	Score float64
+	// Confidence grows from 0 to 1 as the score exceeds the threshold
+	Confidence float64
+}
+
+// SegmentCost is the negative log likelihood of the segment [begin, end) of a series
+type SegmentCost func(begin, end int) float64
+
+// GaussianCost is the cost of a series with a piecewise constant mean and a constant variance,
+// the variance is estimated from the differences of consecutive values so that it isn't inflated by the breaks.
+// The cost has 1 degree of freedom per break, it is nil if the series is constant
+func GaussianCost(series []float64) (SegmentCost, int) {
+	sums, squares := make([]float64, len(series)+1), make([]float64, len(series)+1)
+	for i, v := range series {
+		sums[i+1], squares[i+1] = sums[i]+v, squares[i]+v*v
+	}
+	differences := make([]float64, 0, len(series))
+	for i := 1; i < len(series); i++ {
+		differences = append(differences, math.Abs(series[i]-series[i-1]))
+	}
+	sort.Float64s(differences)
+	variance := 0.0
+	if len(differences) > 0 {
+		sigma := differences[len(differences)/2] / (.6745 * math.Sqrt2)
+		variance = sigma * sigma
+	}
+	if variance == 0 && len(series) > 0 {
+		mean := sums[len(series)] / float64(len(series))
+		variance = squares[len(series)]/float64(len(series)) - mean*mean
+	}
+	if variance <= 0 {
+		return nil, 1
+	}
+	return func(begin, end int) float64 {
+		n := float64(end - begin)
+		sum := sums[end] - sums[begin]
+		return (squares[end] - squares[begin] - sum*sum/n) / (2 * variance)
+	}, 1
+}
+
+// MultinomialCost is the cost of a series of codes with a piecewise constant distribution,
+// the cost has a degree of freedom per code less one per break. The cumulative counts of the codes are only kept
+// every count positions, so they take about as much memory as the codes, and the counts in between are recounted
+func MultinomialCost(codes []int) (SegmentCost, int) {
+	count := 0
+	for _, code := range codes {
+		count = max(count, code+1)
+	}
+	stride := max(count, 1)
+	prefix, running := make([]int32, (len(codes)/stride+1)*count), make([]int32, count)
+	for i, code := range codes {
+		if i%stride == 0 {
+			copy(prefix[i/stride*count:], running)
+		}
+		running[code]++
+	}
+	if len(codes)%stride == 0 {
+		copy(prefix[len(codes)/stride*count:], running)
+	}
+	counts := make([]int32, count)
+	return func(begin, end int) float64 {
+		b, e := begin/stride, end/stride
+		for code := range counts {
+			counts[code] = prefix[e*count+code] - prefix[b*count+code]
+		}
+		for _, code := range codes[e*stride : end] {
+			counts[code]++
+		}
+		for _, code := range codes[b*stride : begin] {
+			counts[code]--
+		}
+		n, cost := float64(end-begin), 0.0
+		for _, c := range counts {
+			if c > 0 {
+				cost -= float64(c) * math.Log(float64(c)/n)
+			}
+		}
+		return cost
+	}, max(count-1, 1)
+}
+
+// BinarySegmentation recursively splits the segments of a series of length n at the break that most reduces the cost,
+// while the likelihood ratio statistic of the break exceeds penalty times the degrees of freedom times log n.
+// Segments are at least minimum long, the changepoints are in order of position
+func BinarySegmentation(n int, cost SegmentCost, df int, penalty float64, minimum int) []Changepoint {
+	changepoints := []Changepoint{}
+	if cost == nil || n < 2 {
+		return changepoints
+	}
+	minimum = max(minimum, 1)
+	threshold := penalty * float64(df) * math.Log(float64(n))
+	segments := [][2]int{{0, n}}
+	for len(segments) > 0 {
+		segment := segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+		begin, end := segment[0], segment[1]
+		whole, best, split := cost(begin, end), 0.0, -1
+		for s := begin + minimum; s <= end-minimum; s++ {
+			if gain := whole - cost(begin, s) - cost(s, end); gain > best {
+				best, split = gain, s
+			}
+		}
+		score := 2 * best
+		if split < 0 || score <= threshold {
+			continue
+		}
+		changepoints = append(changepoints, Changepoint{
+			Position:   split,
+			Score:      score,
+			Confidence: 1 - math.Exp(-(score-threshold)/2),
+		})
+		segments = append(segments, [2]int{begin, split}, [2]int{split, end})
+	}
+	sort.Slice(changepoints, func(i, j int) bool {
+		return changepoints[i].Position < changepoints[j].Position
+	})
+	return changepoints
+}
+
+// Changepoints detects the changepoints of the entropy or code series
+func Changepoints(series string, codes []int, entropies []float32, penalty float64, minimum int) []Changepoint {
+	switch series {
+	case SeriesEntropy:
+		values := make([]float64, len(entropies))
+		for i, entropy := range entropies {
+			values[i] = float64(entropy)
+		}
+		cost, df := GaussianCost(values)
+		return BinarySegmentation(len(values), cost, df, penalty, minimum)
+	case SeriesCode:
+		cost, df := MultinomialCost(codes)
+		return BinarySegmentation(len(codes), cost, df, penalty, minimum)
+	}
+	panic(fmt.Errorf("unknown series %s", series))
+}
+
+// ChangepointCommand detects the structural breaks of the entropy or code series of the corpus
+func ChangepointCommand(args []string) {
+	flags := flag.NewFlagSet("changepoints", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	length := flags.Int("length", 0, "length of the slice of the corpus, 0 for the whole corpus")
+	series := flags.String("series", SeriesEntropy, "the series the breaks are detected in: entropy or code")
+	penalty := flags.Float64("penalty", 3, "penalty of a break in units of the degrees of freedom times the log of the length")
+	minimum := flags.Int("min", 64, "minimum length of a segment")
+	output := OutputFlag(flags, "o", "", "the csv file the changepoints are written to, none when empty")
+	text := flags.Bool("text", false, "print the colored corpus with the breaks marked")
+	flags.Parse(args)
+
+	data := Load(*file)
+	if *length > 0 && *length < len(data) {
+		data = data[:*length]
+	}
+	codes, entropies := Colorings(*model, data)
+	changepoints := Changepoints(*series, codes, entropies, *penalty, *minimum)
+
+	if *text {
+		out := NewOutput("")
+		marker, next := color.New(color.ReverseVideo), 0
+		for i, symbol := range data {
+			if next < len(changepoints) && changepoints[next].Position == i {
+				fmt.Fprint(out, marker.Sprint("|"))
+				next++
+			}
+			fmt.Fprint(out, Colors[codes[i]](string(rune(symbol))))
+		}
+		fmt.Fprintln(out)
+		out.Close()
+	}
+	rows := [][]string{}
+	for _, changepoint := range changepoints {
+		fmt.Printf("position %8d score %12.3f confidence %f\n", changepoint.Position, changepoint.Score, changepoint.Confidence)
+		rows = append(rows, []string{strconv.Itoa(changepoint.Position), strconv.FormatFloat(changepoint.Score, 'g', -1, 64),
+			strconv.FormatFloat(changepoint.Confidence, 'g', -1, 64)})
+	}
+	fmt.Printf("%d changepoints in %d symbols\n", len(changepoints), len(data))
+	Metric("changepoints", float64(len(changepoints)))
+	if *output != "" {
+		WriteCSV(*output, []string{"position", "score", "confidence"}, rows)
+	}
+}
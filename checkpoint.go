@@ -0,0 +1,282 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	// FlagCheckpoint is the checkpoint file written on interrupt
+	FlagCheckpoint = OutputFlag(flag.CommandLine, "checkpoint", "testament.checkpoint", "checkpoint file written on interrupt")
+	// FlagResume resumes from the checkpoint file
+	FlagResume = flag.Bool("resume", false, "resume from the checkpoint file")
+)
+
+// Checkpoint is the saved state of a run
+type Checkpoint struct {
+	Position    int
+	Window      int64
+	Inputs      int
+	Outputs     int
+	Q           Set
+	K           Set
+	V           Set
+	Thresholds  []float32
+	Normalize   bool
+	Means       []float32
+	Variances   []float32
+	Mapping     string
+	Projection  Projection
+	Context     int
+	ContextMode string
+	// Curriculum is the alphabet of each epoch of training with a curriculum
+	Curriculum []string
+	// Decoder is the name of the decoder
+	Decoder string
+	// DecoderState is the serialized state of the decoder
+	DecoderState []byte
+	// Recurrence is the recurrent state
+	Recurrence Recurrence
+	// Layers are the stacked layers
+	Layers []Checkpoint
+	// Sampling is how the sampled weights are quantized
+	Sampling Sampling
+	// TopK is the number of lowest entropy systems the output is averaged over
+	TopK int
+	// TopKWeight is how the outputs of the top k systems are weighted
+	TopKWeight string
+	// Selection is how the samples of the window are weighted in the statistics update
+	Selection string
+	// Objective is the direction of the self entropy objective
+	Objective Objective
+	// Provenance is how a trained model was trained
+	Provenance Provenance
+	// Offset and Limit are the offset and limit flags of the range of the files the position is in
+	Offset int
+	Limit  int
+	// Walkers are the checkpoints of the other walkers of a wander, the network is left out when it is shared
+	Walkers []Checkpoint
+	// Seen are the positions a wander visited
+	Seen []int
+	// Embed is the embedding scheme of the bytes and Ngram the number of bytes the ngram embedding hashes together
+	Embed string
+	Ngram int
+	// Positional is the positional encoding mixed into the embeddings and PositionalWeight its relative length
+	Positional       string
+	PositionalWeight float64
+}
+
+// Checkpoint captures the state of the network at position
+func (n *Net) Checkpoint(position int) Checkpoint {
+	decoder, state := MarshalDecoder(n.Decoder)
+	layers := []Checkpoint{}
+	for i := range n.Layers {
+		layers = append(layers, n.Layers[i].Checkpoint(position))
+	}
+	return Checkpoint{
+		Position:         position,
+		Offset:           *FlagOffset,
+		Limit:            *FlagLimit,
+		Window:           atomic.LoadInt64(&n.window),
+		Inputs:           n.Inputs,
+		Outputs:          n.Outputs,
+		Q:                n.Q,
+		K:                n.K,
+		V:                n.V,
+		Thresholds:       n.Thresholds,
+		Normalize:        n.Normalize,
+		Means:            n.Means,
+		Variances:        n.Variances,
+		Mapping:          n.Mapping,
+		Projection:       n.Projection,
+		Context:          n.Context,
+		ContextMode:      n.ContextMode,
+		Decoder:          decoder,
+		DecoderState:     state,
+		Recurrence:       n.Recurrence,
+		Layers:           layers,
+		Sampling:         n.Sampling,
+		TopK:             n.TopK,
+		TopKWeight:       n.TopKWeight,
+		Selection:        n.Selection,
+		Objective:        n.Objective,
+		Embed:            *FlagEmbed,
+		Ngram:            *FlagNgram,
+		Positional:       *FlagPositional,
+		PositionalWeight: *FlagPositionalWeight,
+	}
+}
+
+// CheckEmbedding checks the network of the checkpoint was trained with the embedding flags,
+// checkpoints from before the embedding was recorded aren't checked
+func (c *Checkpoint) CheckEmbedding() error {
+	if c.Embed == "" {
+		return nil
+	}
+	if c.Embed != *FlagEmbed || (c.Embed == EmbedNgram && c.Ngram != *FlagNgram) {
+		return fmt.Errorf("the checkpoint is of -embed %s -ngram %d, not -embed %s -ngram %d",
+			c.Embed, c.Ngram, *FlagEmbed, *FlagNgram)
+	}
+	if c.Positional != *FlagPositional || (c.Positional != PositionalNone && c.PositionalWeight != *FlagPositionalWeight) {
+		return fmt.Errorf("the checkpoint is of -positional %s -positional-weight %g, not -positional %s -positional-weight %g",
+			c.Positional, c.PositionalWeight, *FlagPositional, *FlagPositionalWeight)
+	}
+	return nil
+}
+
+// Restore restores the state of the network from the checkpoint
+func (n *Net) Restore(checkpoint Checkpoint) {
+	n.SetWindow(checkpoint.Window)
+	n.Inputs = checkpoint.Inputs
+	n.Context = checkpoint.Context
+	n.ContextMode = checkpoint.ContextMode
+	n.Recurrence = checkpoint.Recurrence
+	n.Layers = n.Layers[:0]
+	for i, layer := range checkpoint.Layers {
+		net := NewNet(*FlagSeed+int64(i+1), layer.Window, n.Samples, layer.Inputs, layer.Outputs)
+		net.Restore(layer)
+		n.Layers = append(n.Layers, net)
+	}
+	if checkpoint.Decoder != "" {
+		decoder, err := UnmarshalDecoder(checkpoint.Decoder, checkpoint.DecoderState)
+		if err != nil {
+			panic(err)
+		}
+		n.Decoder = decoder
+	}
+	n.Outputs = checkpoint.Outputs
+	n.Q = checkpoint.Q
+	n.K = checkpoint.K
+	n.V = checkpoint.V
+	n.Thresholds = checkpoint.Thresholds
+	if checkpoint.Normalize {
+		n.Normalize = true
+		n.Means = checkpoint.Means
+		n.Variances = checkpoint.Variances
+	}
+	if checkpoint.Mapping != "" {
+		n.Mapping = checkpoint.Mapping
+		n.Projection = checkpoint.Projection
+	}
+	if checkpoint.Sampling != (Sampling{}) {
+		n.Sampling = checkpoint.Sampling
+	}
+	if checkpoint.TopK > 1 {
+		n.TopK, n.TopKWeight = checkpoint.TopK, checkpoint.TopKWeight
+	}
+	if checkpoint.Selection != "" {
+		n.Selection = checkpoint.Selection
+	}
+	if checkpoint.Objective.Mode != "" {
+		n.Objective = checkpoint.Objective
+	}
+	n.scratch = NewScratch(n.Samples, n.Inputs, n.Outputs)
+}
+
+// Save saves the checkpoint to a file
+func (c Checkpoint) Save(file string) error {
+	output, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	if err := gob.NewEncoder(output).Encode(c); err != nil {
+		return err
+	}
+	Events.Publish(Event{Type: EventCheckpoint, Position: c.Position, Data: map[string]interface{}{
+		"file": file,
+	}})
+	return nil
+}
+
+// LoadCheckpoint loads a checkpoint from a file
+func LoadCheckpoint(file string) (Checkpoint, error) {
+	checkpoint := Checkpoint{}
+	input, err := os.Open(file)
+	if err != nil {
+		return checkpoint, err
+	}
+	defer input.Close()
+	err = gob.NewDecoder(input).Decode(&checkpoint)
+	return checkpoint, err
+}
+
+// LoadNet loads a network from a checkpoint file
+func LoadNet(file string) (Net, error) {
+	net := NewFlagNet(3)
+	checkpoint, err := LoadCheckpoint(file)
+	if err != nil {
+		return net, err
+	}
+	if err := checkpoint.CheckEmbedding(); err != nil {
+		return net, err
+	}
+	net.Restore(checkpoint)
+	return net, nil
+}
+
+// Resume restores the network from the checkpoint file when resuming, returning the position to resume from
+func Resume(net *Net) int {
+	checkpoint, _ := ResumeCheckpoint(net)
+	return checkpoint.Position
+}
+
+// ResumeCheckpoint restores the network from the checkpoint file when resuming, returning the checkpoint
+// and whether it resumed
+func ResumeCheckpoint(net *Net) (Checkpoint, bool) {
+	if !*FlagResume {
+		return Checkpoint{}, false
+	}
+	checkpoint, err := LoadCheckpoint(*FlagCheckpoint)
+	if err != nil {
+		panic(err)
+	}
+	if checkpoint.Offset != *FlagOffset || checkpoint.Limit != *FlagLimit {
+		panic(fmt.Errorf("the checkpoint is of the range at offset %d limit %d, not offset %d limit %d",
+			checkpoint.Offset, checkpoint.Limit, *FlagOffset, *FlagLimit))
+	}
+	if err := checkpoint.CheckEmbedding(); err != nil {
+		panic(err)
+	}
+	net.Restore(checkpoint)
+	return checkpoint, true
+}
+
+// Interrupt writes the checkpoint of an interrupted network
+func Interrupt(net *Net, position int) {
+	SaveInterrupt(net.Checkpoint(position))
+}
+
+// SaveInterrupt writes the checkpoint of an interrupted run
+func SaveInterrupt(checkpoint Checkpoint) {
+	if CurrentRun != nil {
+		CurrentRun.Manifest.Interrupted = true
+	}
+	fmt.Println()
+	if err := checkpoint.Save(*FlagCheckpoint); err != nil {
+		panic(err)
+	}
+	fmt.Println("interrupted at position", checkpoint.Position, "checkpoint written to", *FlagCheckpoint)
+}
+
+// Interrupted returns a channel that is closed on SIGINT or SIGTERM
+func Interrupted() <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		close(done)
+	}()
+	return done
+}
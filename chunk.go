@@ -0,0 +1,138 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Chunk is a content defined chunk of the corpus
+type Chunk struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Hash   string `json:"hash"`
+	Meta   Meta   `json:"meta,omitempty"`
+}
+
+// Chunker cuts the corpus where the code sequence matches a pattern
+type Chunker struct {
+	Pattern []int
+	Min     int
+	Max     int
+	Codes   []int
+	Begin   int
+}
+
+// Next adds the code of the symbol at position and reports whether a chunk ends after it
+func (c *Chunker) Next(position, code int) bool {
+	c.Codes = append(c.Codes, code)
+	if len(c.Codes) > len(c.Pattern) {
+		c.Codes = c.Codes[1:]
+	}
+	length := position + 1 - c.Begin
+	if length < c.Min {
+		return false
+	}
+	cut := length >= c.Max
+	if !cut && len(c.Codes) == len(c.Pattern) {
+		cut = true
+		for i, code := range c.Pattern {
+			if c.Codes[i] != code {
+				cut = false
+				break
+			}
+		}
+	}
+	if cut {
+		c.Begin = position + 1
+		c.Codes = c.Codes[:0]
+	}
+	return cut
+}
+
+// ChunkCorpus splits the corpus into content defined chunks keyed by output codes
+func ChunkCorpus(args []string) {
+	flags := flag.NewFlagSet("chunk", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "the frozen model to color with, a new network when empty")
+	pattern := flags.String("pattern", "0,7", "comma separated code sequence that ends a chunk")
+	minimum := flags.Int("min", 64, "minimum chunk length")
+	maximum := flags.Int("max", 4096, "maximum chunk length")
+	output := OutputFlag(flags, "o", "", "file to write the chunks to as json lines, stdout when empty")
+	flags.Parse(args)
+
+	chunker := Chunker{
+		Min: *minimum,
+		Max: *maximum,
+	}
+	for _, code := range strings.Split(*pattern, ",") {
+		c, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil {
+			panic(fmt.Errorf("invalid pattern %s: %v", *pattern, err))
+		}
+		chunker.Pattern = append(chunker.Pattern, c)
+	}
+	if len(chunker.Pattern) == 0 || chunker.Min < 1 || chunker.Max < chunker.Min {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		out, err := os.Create(*output)
+		if err != nil {
+			panic(err)
+		}
+		defer out.Close()
+		writer = out
+	}
+	encoder := json.NewEncoder(writer)
+
+	data := Load(*file)
+	meta := AnnotateBytes(data, *file)
+	chunks, unique, duplicate := 0, make(map[string]bool), 0
+	emit := func(begin, end int) {
+		hash := sha256.Sum256(data[begin:end])
+		chunk := Chunk{
+			Offset: begin,
+			Length: end - begin,
+			Hash:   hex.EncodeToString(hash[:]),
+			Meta:   meta(begin),
+		}
+		if unique[chunk.Hash] {
+			duplicate += chunk.Length
+		}
+		unique[chunk.Hash] = true
+		chunks++
+		if err := encoder.Encode(chunk); err != nil {
+			panic(err)
+		}
+	}
+	fn := func(symbol Symbol) {
+		begin := chunker.Begin
+		if chunker.Next(symbol.Position, symbol.Code) {
+			emit(begin, symbol.Position+1)
+		}
+	}
+	if *model != "" {
+		Score(*model, data, fn)
+	} else {
+		net := NewFlagNet(3)
+		Color(&net, data, 0, nil, fn)
+	}
+	if chunker.Begin < len(data) {
+		emit(chunker.Begin, len(data))
+	}
+	slog.Info("chunked", "chunks", chunks, "unique", len(unique), "duplicate bytes", duplicate)
+}
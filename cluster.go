@@ -0,0 +1,192 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// UnitByte aggregates the codes of each byte
+	UnitByte = "byte"
+	// UnitRune aggregates the codes of the bytes of each rune
+	UnitRune = "rune"
+	// UnitWord aggregates the codes of the bytes of each word
+	UnitWord = "word"
+	// ClusterIterations is the most iterations of the k-means clustering of the symbols
+	ClusterIterations = 100
+)
+
+// Distribution is the distribution of the output codes a symbol received
+type Distribution struct {
+	Symbol string
+	Count  int
+	Codes  []float64
+}
+
+// Distributions aggregates the codes the bytes of the data received by the distinct bytes, runes or words they belong to,
+// the symbols occurring less than minimum times are left out. The distributions are ordered from the most frequent symbol
+func Distributions(data []byte, codes []int, unit string, minimum int) []Distribution {
+	width := 0
+	for _, code := range codes {
+		width = max(width, code+1)
+	}
+	histograms, occurrences := make(map[string][]float64), make(map[string]int)
+	add := func(symbol string, begin, end int) {
+		histogram := histograms[symbol]
+		if histogram == nil {
+			histogram = make([]float64, width)
+			histograms[symbol] = histogram
+		}
+		occurrences[symbol]++
+		for _, code := range codes[begin:end] {
+			histogram[code]++
+		}
+	}
+	for i := 0; i < len(data); {
+		switch unit {
+		case UnitByte:
+			add(string(data[i:i+1]), i, i+1)
+			i++
+		case UnitRune:
+			_, size := utf8.DecodeRune(data[i:])
+			add(string(data[i:i+size]), i, i+size)
+			i += size
+		case UnitWord:
+			end := i
+			for end < len(data) {
+				r, size := utf8.DecodeRune(data[end:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				end += size
+			}
+			if end == i {
+				_, size := utf8.DecodeRune(data[i:])
+				i += size
+				continue
+			}
+			add(string(data[i:end]), i, end)
+			i = end
+		default:
+			panic(fmt.Errorf("unknown unit %s", unit))
+		}
+	}
+	distributions := []Distribution{}
+	for symbol, histogram := range histograms {
+		if occurrences[symbol] < minimum {
+			continue
+		}
+		total := 0.0
+		for _, count := range histogram {
+			total += count
+		}
+		for code := range histogram {
+			histogram[code] /= total
+		}
+		distributions = append(distributions, Distribution{Symbol: symbol, Count: occurrences[symbol], Codes: histogram})
+	}
+	sort.Slice(distributions, func(i, j int) bool {
+		if distributions[i].Count != distributions[j].Count {
+			return distributions[i].Count > distributions[j].Count
+		}
+		return distributions[i].Symbol < distributions[j].Symbol
+	})
+	return distributions
+}
+
+// Hellinger is the hellinger distance between two distributions
+func Hellinger(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		d := math.Sqrt(a[i]) - math.Sqrt(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum / 2)
+}
+
+// Cluster clusters the distributions into k clusters with k-means++ under the hellinger distance,
+// the centroids are the means of the square roots of the distributions. It returns the cluster of each distribution
+func Cluster(distributions []Distribution, k int, seed int64) []int {
+	k = min(k, len(distributions))
+	clusters := make([]int, len(distributions))
+	if k == 0 {
+		return clusters
+	}
+	rng := rand.New(rand.NewSource(seed))
+	points := make([][]float64, len(distributions))
+	for i, distribution := range distributions {
+		points[i] = make([]float64, len(distribution.Codes))
+		for j, p := range distribution.Codes {
+			points[i][j] = math.Sqrt(p)
+		}
+	}
+	distance := func(a, b []float64) float64 {
+		sum := 0.0
+		for i := range a {
+			sum += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		return sum
+	}
+	centroids := [][]float64{append([]float64{}, points[rng.Intn(len(points))]...)}
+	nearest := make([]float64, len(points))
+	for len(centroids) < k {
+		total := 0.0
+		for i, point := range points {
+			nearest[i] = math.Inf(1)
+			for _, centroid := range centroids {
+				nearest[i] = math.Min(nearest[i], distance(point, centroid))
+			}
+			total += nearest[i]
+		}
+		pick, target := len(points)-1, rng.Float64()*total
+		for i, d := range nearest {
+			if target -= d; target <= 0 {
+				pick = i
+				break
+			}
+		}
+		centroids = append(centroids, append([]float64{}, points[pick]...))
+	}
+	for iteration := 0; iteration < ClusterIterations; iteration++ {
+		changed := false
+		for i, point := range points {
+			best := 0
+			for c := range centroids {
+				if distance(point, centroids[c]) < distance(point, centroids[best]) {
+					best = c
+				}
+			}
+			changed = changed || clusters[i] != best
+			clusters[i] = best
+		}
+		if !changed && iteration > 0 {
+			break
+		}
+		// an empty cluster keeps its centroid
+		sums, sizes := make([][]float64, k), make([]int, k)
+		for i, point := range points {
+			c := clusters[i]
+			if sums[c] == nil {
+				sums[c] = make([]float64, len(point))
+			}
+			sizes[c]++
+			for j, v := range point {
+				sums[c][j] += v
+			}
+		}
+		for c, sum := range sums {
+			for j := range sum {
+				centroids[c][j] = sum[j] / float64(sizes[c])
+			}
+		}
+	}
+	return clusters
+}
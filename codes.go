@@ -0,0 +1,218 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+
+	ansi "github.com/fatih/color"
+)
+
+const (
+	// MaxCodeBits is the largest number of code bits that are colored distinctly, wider codes share colors
+	MaxCodeBits = 8
+	// MaxCodes is the largest number of distinct colors
+	MaxCodes = 1 << MaxCodeBits
+)
+
+const (
+	// PaletteBasic colors the codes with the 16 terminal colors, combining foreground and background colors for wide codes
+	PaletteBasic = "basic"
+	// Palette256 colors the codes with the nearest of the xterm 256 colors
+	Palette256 = "256"
+	// PaletteTruecolor colors the codes with 24 bit colors
+	PaletteTruecolor = "truecolor"
+	// PaletteAuto picks the widest palette the terminal supports
+	PaletteAuto = "auto"
+)
+
+// FlagPalette is the palette of the terminal colors of the codes
+var FlagPalette = flag.String("palette", PaletteBasic, "palette of the terminal colors of the codes: basic, 256, truecolor or auto")
+
+// Foregrounds are the terminal foreground colors of the codes, the first 8 are the colors of 3 bit codes
+var Foregrounds = [16]ansi.Attribute{
+	ansi.FgBlack, ansi.FgBlue, ansi.FgRed, ansi.FgGreen, ansi.FgCyan, ansi.FgYellow, ansi.FgMagenta, ansi.FgHiMagenta,
+	ansi.FgHiBlack, ansi.FgHiBlue, ansi.FgHiRed, ansi.FgHiGreen, ansi.FgHiCyan, ansi.FgHiYellow, ansi.FgWhite, ansi.FgHiWhite,
+}
+
+// Backgrounds are the terminal background colors of the codes wider than 4 bits, the first is the default background
+var Backgrounds = [16]ansi.Attribute{
+	0, ansi.BgWhite, ansi.BgHiBlack, ansi.BgBlue, ansi.BgRed, ansi.BgGreen, ansi.BgCyan, ansi.BgYellow,
+	ansi.BgMagenta, ansi.BgHiBlue, ansi.BgHiRed, ansi.BgHiGreen, ansi.BgHiCyan, ansi.BgHiYellow, ansi.BgHiMagenta, ansi.BgBlack,
+}
+
+// NewColors makes the terminal colors of the codes with the palette, the 256 and truecolor palettes fall back
+// to the basic palette on dumb terminals
+func NewColors(palette string) (colors [MaxCodes]func(format string, a ...interface{}) string) {
+	palette = ResolvePalette(palette)
+	for code := range colors {
+		switch palette {
+		case PaletteBasic:
+			colors[code] = BasicColor(code)
+		case Palette256:
+			colors[code] = Escape(fmt.Sprintf("38;5;%d", XTerm(Palette[code])))
+		case PaletteTruecolor:
+			c := Palette[code]
+			colors[code] = Escape(fmt.Sprintf("38;2;%d;%d;%d", c.R, c.G, c.B))
+		default:
+			panic(fmt.Errorf("unknown palette %s", palette))
+		}
+	}
+	return colors
+}
+
+// ResolvePalette resolves the auto palette to the palette the terminal supports and falls back to the basic palette
+// on dumb terminals
+func ResolvePalette(palette string) string {
+	if palette == PaletteAuto {
+		palette = TerminalPalette()
+	}
+	if os.Getenv("TERM") == "dumb" {
+		palette = PaletteBasic
+	}
+	return palette
+}
+
+// TerminalPalette is the widest palette the terminal advertises support for
+func TerminalPalette() string {
+	switch colorterm := os.Getenv("COLORTERM"); {
+	case colorterm == "truecolor" || colorterm == "24bit":
+		return PaletteTruecolor
+	case strings.Contains(os.Getenv("TERM"), "256color"):
+		return Palette256
+	}
+	return PaletteBasic
+}
+
+// BasicColor is the basic terminal color of a code. Codes up to 4 bits have their own foreground color,
+// wider codes combine the foreground color of the low 4 bits with the background color of the high 4 bits
+func BasicColor(code int) func(format string, a ...interface{}) string {
+	attributes := []ansi.Attribute{Foregrounds[code%16]}
+	if background := Backgrounds[code/16]; background != 0 {
+		attributes = append(attributes, background)
+	}
+	return Paint(attributes...)
+}
+
+// Paint colors text with the attributes of the color package, like the color package the format
+// is only formatted when there are arguments
+func Paint(attributes ...ansi.Attribute) func(format string, a ...interface{}) string {
+	c := ansi.New(attributes...)
+	return func(format string, a ...interface{}) string {
+		if len(a) == 0 {
+			return c.Sprint(format)
+		}
+		return c.Sprintf(format, a...)
+	}
+}
+
+// Escape colors text with an ansi escape sequence, unless the color package has color disabled
+func Escape(sequence string) func(format string, a ...interface{}) string {
+	return func(format string, a ...interface{}) string {
+		text := format
+		if len(a) > 0 {
+			text = fmt.Sprintf(format, a...)
+		}
+		if ansi.NoColor {
+			return text
+		}
+		return "\x1b[" + sequence + "m" + text + "\x1b[0m"
+	}
+}
+
+// XTerm is the nearest of the xterm 256 colors to the rgb value, from the 6x6x6 color cube or the gray ramp
+func XTerm(c color.RGBA) int {
+	levels := [6]int{0, 95, 135, 175, 215, 255}
+	nearest := func(v uint8) int {
+		best := 0
+		for i, level := range levels {
+			if abs(int(v)-level) < abs(int(v)-levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	r, g, b := nearest(c.R), nearest(c.G), nearest(c.B)
+	distance := func(r, g, b int) int {
+		dr, dg, db := int(c.R)-r, int(c.G)-g, int(c.B)-b
+		return dr*dr + dg*dg + db*db
+	}
+	cube := 16 + 36*r + 6*g + b
+	gray := min(max((int(c.R)+int(c.G)+int(c.B))/3-8+5, 0)/10, 23)
+	level := 8 + 10*gray
+	if distance(level, level, level) < distance(levels[r], levels[g], levels[b]) {
+		return 232 + gray
+	}
+	return cube
+}
+
+// abs is the absolute value of an integer
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Codes is the number of distinct colors of the codes of the network
+func (n *Net) Codes() int {
+	return 1 << min(n.Outputs, MaxCodeBits)
+}
+
+// Hue is the color of a code wider than 3 bits, the hues are spread by the golden angle so that
+// consecutive codes have distinct colors
+func Hue(code int) color.RGBA {
+	h := math.Mod(float64(code)*137.508, 360) / 60
+	const s, l = .7, .45
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := l - c/2
+	return color.RGBA{uint8(math.Round((r + m) * 255)), uint8(math.Round((g + m) * 255)), uint8(math.Round((b + m) * 255)), 0xff}
+}
+
+// NewPalette makes the rgb values of the codes, the first 8 are the terminal colors of 3 bit codes
+func NewPalette() (palette [MaxCodes]color.RGBA) {
+	base := [8]color.RGBA{
+		{0x00, 0x00, 0x00, 0xff},
+		{0x00, 0x00, 0xcd, 0xff},
+		{0xcd, 0x00, 0x00, 0xff},
+		{0x00, 0xcd, 0x00, 0xff},
+		{0x00, 0xcd, 0xcd, 0xff},
+		{0xcd, 0xcd, 0x00, 0xff},
+		{0xcd, 0x00, 0xcd, 0xff},
+		{0xff, 0x00, 0xff, 0xff},
+	}
+	copy(palette[:], base[:])
+	for code := len(base); code < len(palette); code++ {
+		palette[code] = Hue(code)
+	}
+	return palette
+}
+
+// Hex is the html hex value of the rgb value of a code
+func Hex(code int) string {
+	c := Palette[code%MaxCodes]
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
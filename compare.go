@@ -0,0 +1,149 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// CompareBar is the width of the bars of the divergence of the regions
+const CompareBar = 16
+
+// Trained is a network trained on the data over epochs with its statistics frozen afterwards
+func Trained(data []byte, epochs int) Net {
+	net := NewFlagNet(3)
+	for epoch := 0; epoch < epochs; epoch++ {
+		net.Reset()
+		Color(&net, data, 0, nil, func(symbol Symbol) {})
+	}
+	net.Frozen = true
+	return net
+}
+
+// Entropies are the entropies of the symbols of the data under the frozen network
+func Entropies(net *Net, data []byte) []float32 {
+	entropies := make([]float32, 0, len(data))
+	net.Reset()
+	Color(net, data, 0, nil, func(symbol Symbol) {
+		entropies = append(entropies, symbol.Entropy)
+	})
+	return entropies
+}
+
+// Mean is the mean of the entropies
+func Mean(entropies []float32) float64 {
+	sum := 0.0
+	for _, entropy := range entropies {
+		sum += float64(entropy)
+	}
+	return sum / float64(max(len(entropies), 1))
+}
+
+// Divergences are the differences of the mean entropies of the regions of a text under the network of the other text
+// and under its own network, the cross entropy in excess of the text's own entropy
+func Divergences(cross, own []float32, regions int) []float64 {
+	divergences := make([]float64, regions)
+	for i := range divergences {
+		begin, end := i*len(own)/regions, (i+1)*len(own)/regions
+		if begin < end {
+			divergences[i] = Mean(cross[begin:end]) - Mean(own[begin:end])
+		}
+	}
+	return divergences
+}
+
+// PlotDivergences plots the divergences of the regions of both texts over their relative positions
+func PlotDivergences(file, a, b string, ab, ba []float64) {
+	p := plot.New()
+	p.Title.Text = "divergence of the regions"
+	p.X.Label.Text = "relative position"
+	p.Y.Label.Text = "cross entropy - entropy"
+	p.Legend.Top = true
+	for i, series := range []struct {
+		name        string
+		divergences []float64
+	}{{b + " under " + a, ab}, {a + " under " + b, ba}} {
+		points := make(plotter.XYs, len(series.divergences))
+		for j, divergence := range series.divergences {
+			points[j] = plotter.XY{X: (float64(j) + .5) / float64(len(series.divergences)), Y: divergence}
+		}
+		line, err := plotter.NewLine(points)
+		if err != nil {
+			panic(err)
+		}
+		if i > 0 {
+			line.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+		}
+		p.Add(line)
+		p.Legend.Add(series.name, line)
+	}
+	if err := p.Save(8*vg.Inch, 4*vg.Inch, file); err != nil {
+		panic(err)
+	}
+}
+
+// CompareCommand trains a network on each of two texts and scores each text under the network of the other,
+// reporting the asymmetric cross entropies and the divergence along the regions of the texts
+func CompareCommand(args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	epochs := flags.Int("epochs", 1, "number of passes over a text to train its network")
+	regions := flags.Int("regions", 16, "number of regions the divergence along the texts is reported for")
+	image := OutputFlag(flags, "plot", "", "the png or svg file the divergence of the regions is plotted to, no plot when empty")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: compare [flags] a.txt b.txt\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 || *epochs < 1 || *regions < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	a, b := flags.Arg(0), flags.Arg(1)
+	dataA, dataB := Load(a), Load(b)
+	netA, netB := Trained(dataA, *epochs), Trained(dataB, *epochs)
+	aa, ba := Entropies(&netA, dataA), Entropies(&netA, dataB)
+	bb, ab := Entropies(&netB, dataB), Entropies(&netB, dataA)
+
+	fmt.Printf("%-10s %12s %12s\n", "", "model a", "model b")
+	fmt.Printf("%-10s %12f %12f\n", "text a", Mean(aa), Mean(ab))
+	fmt.Printf("%-10s %12f %12f\n", "text b", Mean(ba), Mean(bb))
+	fmt.Printf("a: %s\nb: %s\n", a, b)
+	fmt.Printf("b under a exceeds its own entropy by %f\n", Mean(ba)-Mean(bb))
+	fmt.Printf("a under b exceeds its own entropy by %f\n", Mean(ab)-Mean(aa))
+	Metric("divergence_b_a", Mean(ba)-Mean(bb))
+	Metric("divergence_a_b", Mean(ab)-Mean(aa))
+
+	divergencesB, divergencesA := Divergences(ba, bb, *regions), Divergences(ab, aa, *regions)
+	most := 0.0
+	for i := range divergencesB {
+		most = math.Max(most, math.Max(math.Abs(divergencesB[i]), math.Abs(divergencesA[i])))
+	}
+	bar := func(divergence float64) string {
+		length := 0
+		if most > 0 {
+			length = int(math.Round(math.Abs(divergence) / most * CompareBar))
+		}
+		if divergence < 0 {
+			return strings.Repeat(" ", CompareBar-length) + strings.Repeat("█", length) + "|" + strings.Repeat(" ", CompareBar)
+		}
+		return strings.Repeat(" ", CompareBar) + "|" + strings.Repeat("█", length) + strings.Repeat(" ", CompareBar-length)
+	}
+	fmt.Printf("\n%6s %10s %10s\n", "region", "b under a", "a under b")
+	for i := range divergencesB {
+		fmt.Printf("%6d %10f %10f %s\n", i, divergencesB[i], divergencesA[i], strings.TrimRight(bar(divergencesB[i])+" "+bar(divergencesA[i]), " "))
+	}
+	if *image != "" {
+		PlotDivergences(*image, a, b, divergencesB, divergencesA)
+	}
+}
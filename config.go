@@ -0,0 +1,75 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// FlagConfig is the configuration file
+var FlagConfig = flag.String("config", "", "toml configuration file, command line flags override it")
+
+// Configure applies the configuration file to the flags that weren't set on the command line
+// and returns the command line arguments. Top level keys are flags, the command key selects
+// the command when none is given, and tables hold the flags of commands.
+func Configure() []string {
+	args := flag.Args()
+	if *FlagConfig == "" {
+		return args
+	}
+	config := make(map[string]interface{})
+	if _, err := toml.DecodeFile(*FlagConfig, &config); err != nil {
+		panic(err)
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := config[key]
+		if _, ok := value.(map[string]interface{}); ok || key == "command" || set[key] {
+			continue
+		}
+		if flag.Lookup(key) == nil {
+			panic(fmt.Errorf("unknown flag %s in %s", key, *FlagConfig))
+		}
+		if err := flag.Set(key, fmt.Sprint(value)); err != nil {
+			panic(fmt.Errorf("%s in %s: %v", key, *FlagConfig, err))
+		}
+	}
+
+	if len(args) == 0 {
+		if command, ok := config["command"].(string); ok && command != "" {
+			args = []string{command}
+		}
+	}
+	if len(args) == 0 {
+		return args
+	}
+	table, ok := config[args[0]].(map[string]interface{})
+	if !ok {
+		return args
+	}
+	keys = keys[:0]
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	configured := []string{args[0]}
+	for _, key := range keys {
+		configured = append(configured, fmt.Sprintf("-%s=%v", key, table[key]))
+	}
+	return append(configured, args[1:]...)
+}
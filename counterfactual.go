@@ -0,0 +1,185 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Substitution is the change of the codes and entropies of a span of the corpus when the symbol
+// at a position is substituted
+type Substitution struct {
+	Symbol byte
+	// Bits is the number of code bits that changed over the span
+	Bits int
+	// Entropy is the summed absolute change of the entropy over the span
+	Entropy float64
+}
+
+// Disruption orders substitutions from the most to the least disruptive
+func Disruption(a, b Substitution) bool {
+	if a.Bits != b.Bits {
+		return a.Bits > b.Bits
+	}
+	return a.Entropy > b.Entropy
+}
+
+// Reseed reseeds the random number generators of the network and its layers, so that the same weights are sampled again
+func (n *Net) Reseed(seed int64) {
+	n.Rng.Seed(seed)
+	for i := range n.Rngs {
+		for _, rng := range n.Rngs[i] {
+			rng.Seed(n.Rng.Int63())
+		}
+	}
+	for i := range n.Layers {
+		n.Layers[i].Reseed(seed + int64(i) + 1)
+	}
+}
+
+// Counterfactual substitutes each of the alternatives for the symbol at position and measures how the codes and
+// entropies of the symbol and the following symbols that have it in their context change. The network is frozen
+// and reseeded for every substitution, so only the input differs. The substitutions are returned along with the
+// code and entropy of the symbol as it is
+func (n *Net) Counterfactual(data []byte, position int, alternatives []byte, seed int64) ([]Substitution, int, float32) {
+	frozen, state := n.Frozen, append([]float32{}, n.Recurrence.State...)
+	n.Frozen = true
+	defer func() {
+		copy(n.Recurrence.State, state)
+		n.Frozen = frozen
+	}()
+	span := min(n.Context+1, len(data)-position)
+	input, corpus := NewInput(n), append([]byte{}, data[:position+span]...)
+	trial := func(symbol byte) ([]int, []float32) {
+		corpus[position] = symbol
+		copy(n.Recurrence.State, state)
+		n.Reseed(seed)
+		codes, entropies := make([]int, span), make([]float32, span)
+		for i := range codes {
+			n.Input(input, corpus, position+i)
+			out, entropy := n.Fire(input)
+			codes[i], entropies[i] = n.Decode(out).Color, entropy
+		}
+		return codes, entropies
+	}
+	original := data[position]
+	codes, entropies := trial(original)
+	substitutions := make([]Substitution, 0, len(alternatives))
+	for _, symbol := range alternatives {
+		if symbol == original {
+			continue
+		}
+		c, e := trial(symbol)
+		substitution := Substitution{Symbol: symbol}
+		for i := range c {
+			substitution.Bits += bits.OnesCount(uint(c[i] ^ codes[i]))
+			substitution.Entropy += math.Abs(float64(e[i] - entropies[i]))
+		}
+		substitutions = append(substitutions, substitution)
+	}
+	sort.SliceStable(substitutions, func(i, j int) bool {
+		return Disruption(substitutions[i], substitutions[j])
+	})
+	return substitutions, codes[0], entropies[0]
+}
+
+// Alternatives are the substitute symbols, the printable ascii symbols or every byte
+func Alternatives(printable bool) []byte {
+	alternatives := []byte{}
+	for i := 0; i < 256; i++ {
+		if !printable || (i >= ' ' && i <= '~') {
+			alternatives = append(alternatives, byte(i))
+		}
+	}
+	return alternatives
+}
+
+// ParsePositions parses a comma separated list of positions
+func ParsePositions(list string) []int {
+	positions := []int{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		position, err := strconv.Atoi(field)
+		if err != nil {
+			panic(fmt.Errorf("invalid position %s", field))
+		}
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// CounterfactualCommand reports the most and least disruptive substitutions of the symbols at selected positions
+func CounterfactualCommand(args []string) {
+	flags := flag.NewFlagSet("counterfactual", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to probe, empty for a new network that colors the corpus up to each position")
+	list := flags.String("positions", "", "comma separated positions to substitute")
+	every := flags.Int("every", 0, "substitute every n positions when there are no positions")
+	printable := flags.Bool("printable", false, "only substitute printable ascii symbols")
+	top := flags.Int("top", 5, "number of the most and least disruptive substitutions reported")
+	flags.Parse(args)
+
+	data := Load(*file)
+	positions := ParsePositions(*list)
+	if len(positions) == 0 && *every > 0 {
+		for position := 0; position < len(data); position += *every {
+			positions = append(positions, position)
+		}
+	}
+	if len(positions) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	net := NewFlagNet(3)
+	if *model != "" {
+		var err error
+		net, err = LoadNet(*model)
+		if err != nil {
+			panic(err)
+		}
+		net.Frozen = true
+	}
+	alternatives, done := Alternatives(*printable), Interrupted()
+	quote := func(symbol byte) string {
+		return strconv.QuoteToASCII(string([]byte{symbol}))
+	}
+	colored := 0
+	for _, position := range positions {
+		if position < 0 || position >= len(data) {
+			panic(fmt.Errorf("position %d is outside of the corpus of %d symbols", position, len(data)))
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if *model == "" && colored < position {
+			colored = Color(&net, data[:position], colored, done, func(symbol Symbol) {})
+		}
+		substitutions, code, entropy := net.Counterfactual(data, position, alternatives, *FlagSeed+int64(position))
+		fmt.Printf("position %d %s code %s entropy %f\n", position, quote(data[position]), Colors[code]("%d", code), entropy)
+		count := min(*top, len(substitutions)/2)
+		report := func(name string, substitution Substitution) {
+			fmt.Printf("  %-5s %-8s %3d bits %10f entropy\n", name, quote(substitution.Symbol), substitution.Bits, substitution.Entropy)
+		}
+		for _, substitution := range substitutions[:count] {
+			report("most", substitution)
+		}
+		for i := len(substitutions) - 1; i >= len(substitutions)-count; i-- {
+			report("least", substitutions[i])
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// CrossColor colors document a with the queries drawn from a and the keys and values drawn from
+// document b at the proportionally aligned position, so the entropy is how surprising a is in the context of b
+func CrossColor(net *Net, a, b []byte, done <-chan struct{}, fn func(symbol Symbol)) int {
+	net.Rewind()
+	query, memory := NewInput(net), NewInput(net)
+	for position := range a {
+		select {
+		case <-done:
+			return position
+		default:
+		}
+		net.Input(query, a, position)
+		net.Input(memory, b, position*len(b)/len(a))
+		out, entropy := net.FireCross(query, memory)
+		decoded := net.Decode(out)
+		symbol := Symbol{
+			Position: position,
+			Offset:   position,
+			Symbol:   a[position],
+			Code:     decoded.Color,
+			Label:    decoded.Label,
+			Entropy:  entropy,
+			Head:     Head(out),
+		}
+		fn(symbol)
+		net.Step(symbol)
+		net.Observe(ByteText[a[position]])
+	}
+	return len(a)
+}
+
+// Cross colors a document by how surprising it is in the context of a second document
+func Cross(args []string) {
+	flags := flag.NewFlagSet("cross", flag.ExitOnError)
+	a := flags.String("a", "", "the document the queries are drawn from")
+	b := flags.String("b", "", "the document the keys and values are drawn from")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	out := OutputFlag(flags, "o", "", "the file the output is written to, stdout when empty")
+	flags.Parse(args)
+	if *a == "" || *b == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	dataA, dataB := Load(*a), Load(*b)
+	if len(dataA) == 0 || len(dataB) == 0 {
+		return
+	}
+	net := NewFlagNet(3)
+	if *model != "" {
+		var err error
+		net, err = LoadNet(*model)
+		if err != nil {
+			panic(err)
+		}
+		net.Frozen = true
+	}
+	output := NewOutput(*out)
+	defer output.Close()
+	count, entropy := 0, 0.0
+	CrossColor(&net, dataA, dataB, Interrupted(), func(symbol Symbol) {
+		fmt.Fprint(output, Colors[symbol.Code](symbol.String()))
+		count++
+		entropy += float64(symbol.Entropy)
+	})
+	if count > 0 {
+		fmt.Fprintf(output, "\nsymbols %d cross entropy %f\n", count, entropy/float64(count))
+		Metric("symbols", float64(count))
+		Metric("entropy", entropy/float64(count))
+	}
+}
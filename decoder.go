@@ -0,0 +1,216 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	. "github.com/pointlander/matrix"
+)
+
+// FlagDecoder is the decoder of the outputs
+var FlagDecoder = flag.String("decoder", "sign", "decoder of the outputs: "+strings.Join(DecoderNames(), ", "))
+
+// Decoded is a decoded output
+type Decoded struct {
+	// Label is the label of the output
+	Label int
+	// Color is the index of the color the output is displayed with
+	Color int
+}
+
+// Decoder decodes the outputs of the network
+type Decoder interface {
+	// Name is the name of the decoder
+	Name() string
+	// Decode decodes the output, learning from it when the network isn't frozen
+	Decode(net *Net, out Matrix) Decoded
+}
+
+// Decoders make new decoders by name
+var Decoders = map[string]func() Decoder{
+	"sign": func() Decoder {
+		return &SignDecoder{}
+	},
+	"kmeans": func() Decoder {
+		return &KMeansDecoder{Rate: .01}
+	},
+	"percentile": func() Decoder {
+		return &PercentileDecoder{Rate: .01}
+	},
+	"argmax": func() Decoder {
+		return &ArgmaxDecoder{}
+	},
+}
+
+// DecoderNames are the sorted names of the decoders
+func DecoderNames() []string {
+	names := make([]string, 0, len(Decoders))
+	for name := range Decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewDecoder makes a new decoder by name
+func NewDecoder(name string) Decoder {
+	decoder, ok := Decoders[name]
+	if !ok {
+		panic(fmt.Errorf("unknown decoder %s", name))
+	}
+	return decoder()
+}
+
+// MarshalDecoder serializes the state of a decoder
+func MarshalDecoder(decoder Decoder) (string, []byte) {
+	if decoder == nil {
+		return "", nil
+	}
+	state, err := json.Marshal(decoder)
+	if err != nil {
+		panic(err)
+	}
+	return decoder.Name(), state
+}
+
+// UnmarshalDecoder deserializes the state of a decoder
+func UnmarshalDecoder(name string, state []byte) (Decoder, error) {
+	decoder, ok := Decoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown decoder %s", name)
+	}
+	d := decoder()
+	if err := json.Unmarshal(state, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Decode decodes the output with the decoder of the network, the sign decoder by default
+func (n *Net) Decode(out Matrix) Decoded {
+	if n.Decoder == nil {
+		n.Decoder = &SignDecoder{}
+	}
+	return n.Decoder.Decode(n, out)
+}
+
+// SignDecoder decodes the sign bits of the output into a code mapped to a color
+type SignDecoder struct{}
+
+// Name is the name of the decoder
+func (d *SignDecoder) Name() string {
+	return "sign"
+}
+
+// Decode decodes the output
+func (d *SignDecoder) Decode(net *Net, out Matrix) Decoded {
+	code := net.Code(out)
+	return Decoded{Label: code, Color: net.Map(out, code, net.Codes())}
+}
+
+// KMeansDecoder decodes the output into the nearest of a cluster of centroids learned with online k-means
+type KMeansDecoder struct {
+	Rate      float32
+	Centroids [][]float32
+	Counts    []int
+}
+
+// Name is the name of the decoder
+func (d *KMeansDecoder) Name() string {
+	return "kmeans"
+}
+
+// Decode decodes the output
+func (d *KMeansDecoder) Decode(net *Net, out Matrix) Decoded {
+	nearest, distance := -1, float32(math.MaxFloat32)
+	for i, centroid := range d.Centroids {
+		sum := float32(0)
+		for j, v := range out.Data {
+			diff := v - centroid[j]
+			sum += diff * diff
+		}
+		if sum < distance {
+			nearest, distance = i, sum
+		}
+	}
+	if !net.Frozen {
+		if len(d.Centroids) < net.Codes() && (nearest < 0 || distance > 0) {
+			d.Centroids = append(d.Centroids, append([]float32{}, out.Data...))
+			d.Counts = append(d.Counts, 1)
+			nearest = len(d.Centroids) - 1
+		} else {
+			d.Counts[nearest]++
+			rate := max(d.Rate, 1/float32(d.Counts[nearest]))
+			for j, v := range out.Data {
+				d.Centroids[nearest][j] += rate * (v - d.Centroids[nearest][j])
+			}
+		}
+	}
+	if nearest < 0 {
+		nearest = 0
+	}
+	return Decoded{Label: nearest, Color: nearest % net.Codes()}
+}
+
+// PercentileDecoder decodes the mean activation of the output into percentile buckets,
+// tracking the bucket boundaries with stochastic quantile estimation
+type PercentileDecoder struct {
+	Rate       float32
+	Boundaries []float32
+}
+
+// Name is the name of the decoder
+func (d *PercentileDecoder) Name() string {
+	return "percentile"
+}
+
+// Decode decodes the output
+func (d *PercentileDecoder) Decode(net *Net, out Matrix) Decoded {
+	if len(d.Boundaries) == 0 {
+		d.Boundaries = make([]float32, net.Codes()-1)
+	}
+	mean := float32(0)
+	for _, v := range out.Data {
+		mean += v
+	}
+	mean /= float32(len(out.Data))
+	bucket := sort.Search(len(d.Boundaries), func(i int) bool {
+		return mean < d.Boundaries[i]
+	})
+	if !net.Frozen {
+		for i := range d.Boundaries {
+			quantile := float32(i+1) / float32(len(d.Boundaries)+1)
+			if mean < d.Boundaries[i] {
+				d.Boundaries[i] -= d.Rate * (1 - quantile)
+			} else {
+				d.Boundaries[i] += d.Rate * quantile
+			}
+		}
+		sort.Slice(d.Boundaries, func(i, j int) bool {
+			return d.Boundaries[i] < d.Boundaries[j]
+		})
+	}
+	return Decoded{Label: bucket, Color: bucket}
+}
+
+// ArgmaxDecoder decodes the output into the dimension with the largest softmax probability
+type ArgmaxDecoder struct{}
+
+// Name is the name of the decoder
+func (d *ArgmaxDecoder) Name() string {
+	return "argmax"
+}
+
+// Decode decodes the output
+func (d *ArgmaxDecoder) Decode(net *Net, out Matrix) Decoded {
+	head := Head(out)
+	return Decoded{Label: head, Color: head % net.Codes()}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+//go:embed ui/demo.html
+var demo []byte
+
+// Broadcaster broadcasts symbols to many viewers
+type Broadcaster struct {
+	sync.Mutex
+	Viewers map[chan Symbol]bool
+}
+
+// NewBroadcaster makes a new broadcaster
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		Viewers: make(map[chan Symbol]bool),
+	}
+}
+
+// Subscribe adds a viewer
+func (b *Broadcaster) Subscribe() chan Symbol {
+	viewer := make(chan Symbol, 1024)
+	b.Lock()
+	b.Viewers[viewer] = true
+	b.Unlock()
+	return viewer
+}
+
+// Unsubscribe removes a viewer
+func (b *Broadcaster) Unsubscribe(viewer chan Symbol) {
+	b.Lock()
+	delete(b.Viewers, viewer)
+	b.Unlock()
+}
+
+// Broadcast sends a symbol to every viewer, dropping it for viewers that are behind
+func (b *Broadcaster) Broadcast(symbol Symbol) {
+	b.Lock()
+	defer b.Unlock()
+	for viewer := range b.Viewers {
+		select {
+		case viewer <- symbol:
+		default:
+		}
+	}
+}
+
+// ServeHTTP streams the symbols to a viewer as server sent events
+func (b *Broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	viewer := b.Subscribe()
+	defer b.Unsubscribe(viewer)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case symbol := <-viewer:
+			data, err := json.Marshal(symbol)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			if len(viewer) == 0 {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// DemoCommand broadcasts the coloring of the corpus
+func DemoCommand(args []string) {
+	flags := flag.NewFlagSet("demo", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "address to broadcast the live demo on")
+	file := flags.String("f", *FlagFile, "the file to process")
+	flags.Parse(args)
+	Demo(*addr, *file, Load(*file), Interrupted())
+}
+
+// Demo colors the data while broadcasting the symbols to every connected browser
+func Demo(addr, source string, data []byte, done <-chan struct{}) {
+	broadcaster := NewBroadcaster()
+	mux := http.NewServeMux()
+	mux.Handle("/events", broadcaster)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(demo)
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+	fmt.Println("broadcasting on", addr)
+	net := NewFlagNet(3)
+	meta := AnnotateBytes(data, source)
+	position := Color(&net, data, 0, done, func(symbol Symbol) {
+		symbol.Meta = meta(symbol.Position)
+		broadcaster.Broadcast(symbol)
+	})
+	fmt.Println("demo finished at position", position)
+	<-done
+	server.Close()
+}
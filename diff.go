@@ -0,0 +1,91 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/fatih/color"
+)
+
+// Diff colors the corpus by the sliding window entropy under model a minus model b
+func Diff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	a := flags.String("a", "", "the first model")
+	b := flags.String("b", "", "the second model")
+	file := flags.String("f", *FlagFile, "the file to process")
+	span := flags.Int("span", 64, "width of the sliding window")
+	out := OutputFlag(flags, "o", "", "the file the output is written to, stdout when empty")
+	flags.Parse(args)
+	if *a == "" || *b == "" || *span < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data := Load(*file)
+	if len(data) == 0 {
+		return
+	}
+	differences := make([]float64, len(data))
+	meanA, meanB := 0.0, 0.0
+	Score(*a, data, func(symbol Symbol) {
+		differences[symbol.Position] += float64(symbol.Entropy)
+		meanA += float64(symbol.Entropy)
+	})
+	Score(*b, data, func(symbol Symbol) {
+		differences[symbol.Position] -= float64(symbol.Entropy)
+		meanB += float64(symbol.Entropy)
+	})
+	meanA /= float64(len(data))
+	meanB /= float64(len(data))
+
+	profile := make([]float64, len(data))
+	sum, half := 0.0, *span/2
+	for i := 0; i < len(data)+half; i++ {
+		if i < len(data) {
+			sum += differences[i]
+		}
+		if i >= *span {
+			sum -= differences[i-*span]
+		}
+		if center := i - half; center >= 0 {
+			begin, end := i-*span+1, i+1
+			if begin < 0 {
+				begin = 0
+			}
+			if end > len(data) {
+				end = len(data)
+			}
+			profile[center] = sum / float64(end-begin)
+		}
+	}
+
+	variance := 0.0
+	for _, v := range profile {
+		variance += v * v
+	}
+	deviation := math.Sqrt(variance / float64(len(profile)))
+
+	output := NewOutput(*out)
+	defer output.Close()
+	for i, v := range profile {
+		symbol := string(data[i])
+		switch {
+		case v < -deviation:
+			symbol = color.HiBlueString(symbol)
+		case v < -deviation/4:
+			symbol = color.BlueString(symbol)
+		case v > deviation:
+			symbol = color.HiRedString(symbol)
+		case v > deviation/4:
+			symbol = color.RedString(symbol)
+		}
+		fmt.Fprint(output, symbol)
+	}
+	fmt.Fprintf(output, "\nmean entropy a %f b %f, blue is lower entropy under a and red is lower entropy under b\n", meanA, meanB)
+}
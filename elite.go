@@ -0,0 +1,75 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+
+	. "github.com/pointlander/matrix"
+)
+
+const (
+	// EliteUniform averages the outputs of the elite systems uniformly
+	EliteUniform = "uniform"
+	// EliteEntropy weights the outputs of the elite systems by the softmax of their negative entropies,
+	// of their entropies when maximizing
+	EliteEntropy = "entropy"
+)
+
+var (
+	// FlagTopK is the number of lowest entropy systems the output is averaged over
+	FlagTopK = flag.Int("topk", 1, "number of lowest entropy systems the output is averaged over")
+	// FlagTopKWeight is how the outputs of the elite systems are weighted
+	FlagTopKWeight = flag.String("topk-weight", EliteUniform, "how the outputs of the top k systems are weighted: uniform or entropy")
+)
+
+// Elite combines the outputs of the k best systems, which are sorted by ascending entropy when minimizing
+// and by descending entropy when maximizing, returning the combined output and entropy
+func (n *Net) Elite(systems []Sample, maximize bool) (Matrix, float32) {
+	k := min(n.TopK, len(systems))
+	if k <= 1 {
+		return systems[0].Outputs, systems[0].Entropy
+	}
+	weights := make([]float64, k)
+	switch n.TopKWeight {
+	case EliteEntropy:
+		sign := 1.0
+		if maximize {
+			sign = -1
+		}
+		sum := 0.0
+		for i := range weights {
+			weights[i] = math.Exp(sign * float64(systems[0].Entropy-systems[i].Entropy))
+			sum += weights[i]
+		}
+		for i := range weights {
+			weights[i] /= sum
+		}
+	case EliteUniform, "":
+		for i := range weights {
+			weights[i] = 1 / float64(k)
+		}
+	default:
+		panic(fmt.Errorf("unknown top k weight %s", n.TopKWeight))
+	}
+	elite := &n.scratch.Elite
+	if len(elite.Data) != len(systems[0].Outputs.Data) {
+		*elite = NewMatrix(0, systems[0].Outputs.Cols, systems[0].Outputs.Rows)
+		elite.Data = elite.Data[:cap(elite.Data)]
+	}
+	for i := range elite.Data {
+		elite.Data[i] = 0
+	}
+	entropy := 0.0
+	for i, weight := range weights {
+		for j, v := range systems[i].Outputs.Data {
+			elite.Data[j] += float32(weight) * v
+		}
+		entropy += weight * float64(systems[i].Entropy)
+	}
+	return *elite, float32(entropy)
+}
@@ -0,0 +1,342 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// EmbedHash embeds each byte as a random unit vector seeded by its hash
+	EmbedHash = "hash"
+	// EmbedOnehot embeds each byte as a 256 wide indicator vector
+	EmbedOnehot = "onehot"
+	// EmbedBytes embeds each byte as its value and the values of the bytes before it scaled between -1 and 1
+	EmbedBytes = "bytes"
+	// EmbedNgram embeds each byte as a random unit vector seeded by the hash of it and the bytes before it
+	EmbedNgram = "ngram"
+)
+
+const (
+	// PositionalNone doesn't encode the positions
+	PositionalNone = "none"
+	// PositionalSinusoidal encodes the positions with sines and cosines of geometrically increasing wavelengths
+	PositionalSinusoidal = "sinusoidal"
+	// PositionalHashed encodes each position with a pseudo random vector seeded by the position
+	PositionalHashed = "hashed"
+	// PositionalBase is the base of the wavelengths of the sinusoidal encoding
+	PositionalBase = 10000
+)
+
+var (
+	// FlagEmbed is the embedding scheme of the bytes
+	FlagEmbed = flag.String("embed", EmbedHash, "embedding scheme of the bytes: hash, onehot, bytes or ngram")
+	// FlagNgram is the number of bytes the ngram embedding hashes together
+	FlagNgram = flag.Int("ngram", 3, "number of bytes the ngram embedding hashes together, the byte and the bytes before it")
+	// FlagPositional is the positional encoding mixed into the embeddings
+	FlagPositional = flag.String("positional", PositionalNone, "positional encoding mixed into the embedding of each symbol: none, sinusoidal or hashed")
+	// FlagPositionalWeight is the length of the positional encoding relative to the length of the embedding it is mixed into
+	FlagPositionalWeight = flag.Float64("positional-weight", .5, "length of the positional encoding relative to the length of the embedding it is mixed into")
+)
+
+// Embedder embeds the bytes of the data
+type Embedder interface {
+	// Size is the width of the embeddings
+	Size() int
+	// Embed is the embedding of the byte at position of the data
+	Embed(data []byte, position int) []float32
+	// Reach is the number of bytes ending at a position that the embedding of the byte at the position reads
+	Reach() int
+}
+
+// Embeddings is the table of byte embeddings
+var Embeddings = NewEmbeddings(32)
+
+// Embed is the embedder of the bytes, the table of byte embeddings by default
+var Embed Embedder = TableEmbedder{}
+
+// TableEmbedder embeds each byte independently of the bytes around it with the table of byte embeddings
+type TableEmbedder struct{}
+
+// Size is the width of the embeddings
+func (TableEmbedder) Size() int {
+	return len(Embeddings[0])
+}
+
+// Reach is the number of bytes the embedding of a byte reads, only the byte
+func (TableEmbedder) Reach() int {
+	return 1
+}
+
+// Embed is the embedding of the byte at position of the data
+func (TableEmbedder) Embed(data []byte, position int) []float32 {
+	return Embeddings[data[position]]
+}
+
+// NgramCache is the largest number of ngram embeddings cached, the cache is emptied when it is full
+const NgramCache = 1 << 16
+
+// NgramEmbedder embeds each byte by the hash of the n bytes ending at it, the embeddings of the recent ngrams are cached
+type NgramEmbedder struct {
+	N     int
+	Width int
+	sync.Mutex
+	cache map[string][]float32
+}
+
+// NewNgramEmbedder makes an embedder of the n bytes ending at each byte
+func NewNgramEmbedder(n, width int) *NgramEmbedder {
+	return &NgramEmbedder{N: n, Width: width, cache: make(map[string][]float32)}
+}
+
+// Size is the width of the embeddings
+func (e *NgramEmbedder) Size() int {
+	return e.Width
+}
+
+// Reach is the number of bytes the embedding of a byte reads, the ngram ending at it
+func (e *NgramEmbedder) Reach() int {
+	return e.N
+}
+
+// Embed is the embedding of the byte at position of the data, the ngrams at the start of the data are shorter
+func (e *NgramEmbedder) Embed(data []byte, position int) []float32 {
+	ngram := data[max(0, position-e.N+1) : position+1]
+	e.Lock()
+	embedding, ok := e.cache[string(ngram)]
+	e.Unlock()
+	if ok {
+		return embedding
+	}
+	embedding = append([]float32(nil), Embedding(fnv.New32(), ngram, e.Width)[:e.Width]...)
+	e.Lock()
+	if len(e.cache) >= NgramCache {
+		clear(e.cache)
+	}
+	e.cache[string(ngram)] = embedding
+	e.Unlock()
+	return embedding
+}
+
+// NewEmbeddings computes the embedding of every byte, the pretrained embedding when there is one
+func NewEmbeddings(size int) (embeddings [256][]float32) {
+	h := fnv.New32()
+	for i := range embeddings {
+		if embedding, ok := PretrainedByte(byte(i)); ok {
+			embeddings[i] = embedding
+			continue
+		}
+		embeddings[i] = Hashed(h, []byte{byte(i)}, size)
+	}
+	return embeddings
+}
+
+// EmbedDescription describes the embeddings of the embedding flags
+func EmbedDescription() string {
+	var description string
+	switch *FlagEmbed {
+	case EmbedHash:
+		description = "random unit vectors seeded by the hashes of the bytes"
+	case EmbedOnehot:
+		description = "256 wide indicator vectors of the bytes"
+	case EmbedBytes:
+		description = fmt.Sprintf("the values of each byte and the %d bytes before it", *FlagSize-1)
+	case EmbedNgram:
+		description = fmt.Sprintf("random unit vectors seeded by the hashes of the %d byte ngrams ending at the bytes", *FlagNgram)
+	default:
+		description = *FlagEmbed
+	}
+	if *FlagPositional != PositionalNone {
+		description += fmt.Sprintf(" with a %s positional encoding of weight %g", *FlagPositional, *FlagPositionalWeight)
+	}
+	return description
+}
+
+// ByteEmbeddings are the embeddings of the bytes by the embedder, each byte embedded on its own
+func ByteEmbeddings() (embeddings [256][]float32) {
+	for i := range embeddings {
+		embeddings[i] = Embed.Embed([]byte{byte(i)}, 0)
+	}
+	return embeddings
+}
+
+// OnehotEmbeddings are the 256 wide indicator vectors of the bytes
+func OnehotEmbeddings() (embeddings [256][]float32) {
+	for i := range embeddings {
+		embeddings[i] = make([]float32, 256)
+		embeddings[i][i] = 1
+	}
+	return embeddings
+}
+
+// BytesEmbedder embeds each byte as the raw values of the width bytes ending at it scaled between -1 and 1,
+// the latest byte first. The values before the start of the data are 0
+type BytesEmbedder struct {
+	Width int
+}
+
+// Size is the width of the embeddings
+func (e BytesEmbedder) Size() int {
+	return e.Width
+}
+
+// Reach is the number of bytes the embedding of a byte reads, the byte and the bytes before it
+func (e BytesEmbedder) Reach() int {
+	return e.Width
+}
+
+// Embed is the embedding of the byte at position of the data
+func (e BytesEmbedder) Embed(data []byte, position int) []float32 {
+	embedding := make([]float32, e.Width)
+	for i := range embedding {
+		if position-i < 0 {
+			break
+		}
+		embedding[i] = float32(data[position-i])/127.5 - 1
+	}
+	return embedding
+}
+
+// SetupEmbeddings sets the table of byte embeddings and the embedder up for the embedding scheme, the size becomes
+// the width of the onehot embeddings. The table stays hashed for the schemes that embed a byte along with the bytes before it.
+// With a transliteration the embedder transliterates the runes it embeds
+func SetupEmbeddings(scheme string) {
+	if Pretrained != nil && scheme != EmbedHash {
+		panic(fmt.Errorf("pretrained embeddings need the hash embedding instead of %s", scheme))
+	}
+	switch *FlagPositional {
+	case PositionalNone, PositionalSinusoidal, PositionalHashed:
+	default:
+		panic(fmt.Errorf("unknown positional encoding %s", *FlagPositional))
+	}
+	switch scheme {
+	case EmbedHash:
+		if *FlagSize != 32 || Pretrained != nil {
+			Embeddings = NewEmbeddings(*FlagSize)
+		}
+	case EmbedOnehot:
+		Embeddings, *FlagSize = OnehotEmbeddings(), 256
+	case EmbedBytes:
+		Embeddings = NewEmbeddings(*FlagSize)
+		Embed = BytesEmbedder{Width: *FlagSize}
+	case EmbedNgram:
+		if *FlagNgram < 1 {
+			panic(fmt.Errorf("the ngram length %d is less than 1", *FlagNgram))
+		}
+		Embeddings = NewEmbeddings(*FlagSize)
+		Embed = NewNgramEmbedder(*FlagNgram, *FlagSize)
+	default:
+		panic(fmt.Errorf("unknown embedding %s", scheme))
+	}
+	if t := CurrentTransliteration(); t != nil {
+		Embed = NewTranslitEmbedder(Embed, t)
+	}
+}
+
+// Sinusoid are the wavelengths of the pairs of dimensions of the sinusoidal encoding of a width
+type Sinusoid struct {
+	Width       int
+	Wavelengths []float64
+}
+
+// sinusoid is the sinusoid of the width last encoded
+var sinusoid atomic.Pointer[Sinusoid]
+
+// Wavelengths are the wavelengths of the pairs of dimensions of the sinusoidal encoding of the width,
+// they are only computed again when the width changes
+func Wavelengths(width int) []float64 {
+	if s := sinusoid.Load(); s != nil && s.Width == width {
+		return s.Wavelengths
+	}
+	s := &Sinusoid{Width: width, Wavelengths: make([]float64, (width+1)/2)}
+	for i := range s.Wavelengths {
+		s.Wavelengths[i] = math.Pow(PositionalBase, float64(2*i)/float64(width))
+	}
+	sinusoid.Store(s)
+	return s.Wavelengths
+}
+
+// Encode writes the positional encoding of the position into the encoding, the width of the encoding is that of the embeddings
+func Encode(scheme string, position int, encoding []float32) {
+	width := len(encoding)
+	switch scheme {
+	case PositionalSinusoidal:
+		for i, wavelength := range Wavelengths(width) {
+			sin, cos := math.Sincos(float64(position) / wavelength)
+			encoding[2*i] = float32(sin)
+			if 2*i+1 < width {
+				encoding[2*i+1] = float32(cos)
+			}
+		}
+	case PositionalHashed:
+		// splitmix64 of the position and the dimension mapped between -1 and 1
+		for i := range encoding {
+			x := uint64(position)*uint64(width) + uint64(i) + 0x9e3779b97f4a7c15
+			x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+			x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+			x ^= x >> 31
+			encoding[i] = float32(x>>11)/(1<<52) - 1
+		}
+	default:
+		clear(encoding)
+	}
+}
+
+// Positioned mixes the positional encoding into the embedding of the symbol at position, the encoding is scaled to the
+// positional weight times the length of the embedding so that it doesn't drown out the symbol whatever the embedding scheme.
+// The mix is written to the scratch space of the network and is only valid until the next call
+func (n *Net) Positioned(embedding []float32, position int) []float32 {
+	scheme := *FlagPositional
+	if scheme == PositionalNone || embedding == nil {
+		return embedding
+	}
+	if len(n.scratch.Positional) < len(embedding) {
+		n.scratch.Positional = make([]float32, len(embedding))
+	}
+	mixed := n.scratch.Positional[:len(embedding)]
+	Encode(scheme, position, mixed)
+	length, norm := 0.0, 0.0
+	for i, v := range embedding {
+		length += float64(v) * float64(v)
+		norm += float64(mixed[i]) * float64(mixed[i])
+	}
+	scale := float32(0)
+	if norm > 0 {
+		scale = float32(*FlagPositionalWeight * math.Sqrt(length/norm))
+	}
+	for i, v := range embedding {
+		mixed[i] = v + scale*mixed[i]
+	}
+	return mixed
+}
+
+// Embedding computes the embedding of the bytes of a symbol, at least 256 wide
+func Embedding(h hash.Hash32, symbol []byte, size int) []float32 {
+	h.Reset()
+	h.Write(symbol)
+	rng := rand.New(rand.NewSource(int64(h.Sum32())))
+	if size < 256 {
+		size = 256
+	}
+	embedding := make([]float32, size)
+	sum := 0.0
+	for i := range embedding {
+		v := rng.NormFloat64()
+		sum += v * v
+		embedding[i] = float32(v)
+	}
+	length := float32(math.Sqrt(sum))
+	for i, v := range embedding {
+		embedding[i] = v / length
+	}
+	return embedding
+}
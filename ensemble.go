@@ -0,0 +1,159 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+)
+
+const (
+	// VoteMajority picks the code most of the networks agree on
+	VoteMajority = "majority"
+	// VoteAverage sets each bit of the code that most of the networks set, with the sign decoder only
+	VoteAverage = "average"
+)
+
+var (
+	// FlagEnsemble is the number of networks with independent seeds the codes are voted over
+	FlagEnsemble = flag.Int("ensemble", 1, "number of networks with independent seeds the codes are voted over")
+	// FlagVote is how the codes of the ensemble are combined
+	FlagVote = flag.String("vote", VoteMajority, "how the codes of the ensemble are combined: majority or average, average votes bit by bit with -decoder sign and by majority otherwise")
+)
+
+// Ensemble is a set of networks with independent seeds that vote on the codes
+type Ensemble struct {
+	Nets []Net
+	Vote string
+}
+
+// NewFlagEnsemble makes the ensemble configured by the command line flags, the first network is net.
+// The seeds are spaced by the number of layers so the layers of the networks don't share seeds
+func NewFlagEnsemble(net Net, outputs int) Ensemble {
+	if *FlagVote != VoteMajority && *FlagVote != VoteAverage {
+		panic(fmt.Errorf("unknown vote %s", *FlagVote))
+	}
+	ensemble := Ensemble{Nets: []Net{net}, Vote: *FlagVote}
+	for i := 1; i < *FlagEnsemble; i++ {
+		ensemble.Nets = append(ensemble.Nets, NewSeededNet(*FlagSeed+int64(i**FlagLayers), outputs))
+	}
+	return ensemble
+}
+
+// Bitwise is true when the codes are voted bit by bit, which is only meaningful when every network decodes
+// the signs of its outputs. The codes of the other decoders are indices that are voted on by majority
+func (e *Ensemble) Bitwise() bool {
+	if e.Vote != VoteAverage {
+		return false
+	}
+	for i := range e.Nets {
+		if decoder := e.Nets[i].Decoder; decoder != nil && decoder.Name() != "sign" {
+			return false
+		}
+	}
+	return true
+}
+
+// Majority is the value most of the values agree on, the earliest value to reach the most votes on a tie
+func Majority(values []int) int {
+	votes, best := make(map[int]int, len(values)), values[0]
+	for _, value := range values {
+		votes[value]++
+		if votes[value] > votes[best] {
+			best = value
+		}
+	}
+	return best
+}
+
+// BitMajority sets each bit that most of the values set
+func BitMajority(values []int) int {
+	all := 0
+	for _, value := range values {
+		all |= value
+	}
+	result := 0
+	for bit := 1; bit != 0 && bit <= all; bit <<= 1 {
+		set := 0
+		for _, value := range values {
+			if value&bit != 0 {
+				set++
+			}
+		}
+		if 2*set > len(values) {
+			result |= bit
+		}
+	}
+	return result
+}
+
+// Combine combines the symbols of the networks into one symbol, the codes and the labels are voted on separately
+func (e *Ensemble) Combine(symbols []Symbol) Symbol {
+	combined, entropy := symbols[0], float32(0)
+	codes, labels := make([]int, len(symbols)), make([]int, len(symbols))
+	for i, symbol := range symbols {
+		entropy += symbol.Entropy
+		codes[i], labels[i] = symbol.Code, symbol.Label
+	}
+	combined.Entropy = entropy / float32(len(symbols))
+	if e.Bitwise() {
+		combined.Code, combined.Label = BitMajority(codes), BitMajority(labels)
+	} else {
+		combined.Code, combined.Label = Majority(codes), Majority(labels)
+	}
+	return combined
+}
+
+// ColorTokens colors the tokens of a tokenizer made by tokenizer with each network in parallel and combines
+// the symbols by voting, returning the final position. A single network colors directly
+func (e *Ensemble) ColorTokens(tokenizer func() Tokenizer, position int, done <-chan struct{}, fn func(symbol Symbol)) int {
+	if len(e.Nets) == 1 {
+		return ColorTokens(&e.Nets[0], tokenizer(), position, done, fn)
+	}
+	// the networks are waited for after they are stopped, so they aren't firing when the caller checkpoints them
+	stop, wait := make(chan struct{}), sync.WaitGroup{}
+	defer wait.Wait()
+	defer close(stop)
+	streams := make([]chan Symbol, len(e.Nets))
+	for i := range e.Nets {
+		streams[i] = make(chan Symbol, 64)
+		wait.Add(1)
+		go func(net *Net, stream chan<- Symbol) {
+			defer wait.Done()
+			defer close(stream)
+			ColorTokens(net, tokenizer(), position, stop, func(symbol Symbol) {
+				select {
+				case stream <- symbol:
+				case <-stop:
+				}
+			})
+		}(&e.Nets[i], streams[i])
+	}
+	symbols := make([]Symbol, len(e.Nets))
+	for {
+		select {
+		case <-done:
+			return position
+		default:
+		}
+		for i, stream := range streams {
+			symbol, ok := <-stream
+			if !ok {
+				return position
+			}
+			symbols[i] = symbol
+		}
+		fn(e.Combine(symbols))
+		position = symbols[0].Position + 1
+	}
+}
+
+// Reset resets the recurrent state of the networks
+func (e *Ensemble) Reset() {
+	for i := range e.Nets {
+		e.Nets[i].Reset()
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+)
+
+// Predictor predicts the next symbol from the code of the current symbol with per code next symbol histograms,
+// learned online so every prediction is made before the symbol is seen
+type Predictor struct {
+	Histograms [][256]int
+	Totals     []int
+	Count      int
+	Correct    int
+	Loss       float64
+}
+
+// NewPredictor makes a predictor for codes codes
+func NewPredictor(codes int) *Predictor {
+	return &Predictor{
+		Histograms: make([][256]int, codes),
+		Totals:     make([]int, codes),
+	}
+}
+
+// Observe scores the prediction of the next symbol from the code and then learns from it
+func (p *Predictor) Observe(code int, next byte) {
+	histogram := &p.Histograms[code]
+	best := 0
+	for symbol, count := range histogram {
+		if count > histogram[best] {
+			best = symbol
+		}
+	}
+	if p.Totals[code] > 0 && byte(best) == next {
+		p.Correct++
+	}
+	probability := float64(histogram[next]+1) / float64(p.Totals[code]+256)
+	p.Loss -= math.Log(probability)
+	p.Count++
+	histogram[next]++
+	p.Totals[code]++
+}
+
+// Accuracy is the fraction of correct predictions
+func (p *Predictor) Accuracy() float64 {
+	return float64(p.Correct) / float64(p.Count)
+}
+
+// Perplexity is the perplexity of the predictions
+func (p *Predictor) Perplexity() float64 {
+	return math.Exp(p.Loss / float64(p.Count))
+}
+
+// Eval scores how well the output codes predict the next symbol
+func Eval(args []string) {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to evaluate, empty for a new network")
+	length := flags.Int("length", 0, "length of the slice of the corpus, 0 for the whole corpus")
+	flags.Parse(args)
+
+	data := Load(*file)
+	if *length > 0 && *length < len(data) {
+		data = data[:*length]
+	}
+	if len(data) < 2 {
+		return
+	}
+	codes, _ := Colorings(*model, data)
+	predictor, unigram := NewPredictor(len(Colors)), NewPredictor(1)
+	for i, code := range codes[:len(codes)-1] {
+		predictor.Observe(code, data[i+1])
+		unigram.Observe(0, data[i+1])
+	}
+	fmt.Printf("%-8s %10s %12s\n", "", "accuracy", "perplexity")
+	fmt.Printf("%-8s %10f %12f\n", "codes", predictor.Accuracy(), predictor.Perplexity())
+	fmt.Printf("%-8s %10f %12f\n", "unigram", unigram.Accuracy(), unigram.Perplexity())
+	Metric("accuracy", predictor.Accuracy())
+	Metric("perplexity", predictor.Perplexity())
+}
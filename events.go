@@ -0,0 +1,172 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// EventStep is published after each symbol is colored
+	EventStep = "step"
+	// EventCheckpoint is published when a checkpoint is written
+	EventCheckpoint = "checkpoint"
+	// EventConvergence is published once when the statistics of a network converge
+	EventConvergence = "convergence"
+	// EventAnomaly is published when the entropy of a symbol is far from the running mean
+	EventAnomaly = "anomaly"
+)
+
+const (
+	// ConvergenceStdDev is the mean standard deviation of the statistics below which a network has converged
+	ConvergenceStdDev = 1e-3
+	// AnomalyDeviations is the number of standard deviations from the running mean entropy that is anomalous
+	AnomalyDeviations = 4
+	// AnomalyWarmup is the number of symbols before anomalies are flagged
+	AnomalyWarmup = 64
+	// AnomalyRate is the rate the running mean and variance of the entropy adapt at
+	AnomalyRate = .01
+)
+
+// FlagEvents is the json lines file the lifecycle events are written to
+var FlagEvents = OutputFlag(flag.CommandLine, "events", "", "json lines file the lifecycle events are written to")
+
+// Event is a lifecycle event
+type Event struct {
+	Type     string                 `json:"type"`
+	Time     time.Time              `json:"time"`
+	Position int                    `json:"position"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// Bus dispatches events to the subscribers
+type Bus struct {
+	sync.RWMutex
+	next        int
+	subscribers map[int]func(event Event)
+}
+
+// Events is the bus of the lifecycle events
+var Events = &Bus{}
+
+// Subscribe registers a subscriber, returning a function that unsubscribes it
+func (b *Bus) Subscribe(fn func(event Event)) func() {
+	b.Lock()
+	defer b.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[int]func(event Event))
+	}
+	id := b.next
+	b.next++
+	b.subscribers[id] = fn
+	return func() {
+		b.Lock()
+		defer b.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Active is true if there are subscribers
+func (b *Bus) Active() bool {
+	b.RLock()
+	defer b.RUnlock()
+	return len(b.subscribers) > 0
+}
+
+// Publish publishes an event to the subscribers, which are called outside of the lock so that they can subscribe and unsubscribe
+func (b *Bus) Publish(event Event) {
+	b.RLock()
+	subscribers := make([]func(event Event), 0, len(b.subscribers))
+	for _, fn := range b.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	b.RUnlock()
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// Watch is the state a network keeps to detect convergence and anomalies
+type Watch struct {
+	Converged bool
+	Count     int
+	Mean      float64
+	Variance  float64
+}
+
+// Step publishes the step event of a colored symbol, along with the convergence of the network and anomalous entropies
+func (n *Net) Step(symbol Symbol) {
+	if !Events.Active() {
+		return
+	}
+	entropy := float64(symbol.Entropy)
+	Events.Publish(Event{Type: EventStep, Position: symbol.Position, Data: map[string]interface{}{
+		"code":    symbol.Code,
+		"entropy": entropy,
+	}})
+	w := &n.Watch
+	if !w.Converged {
+		if stddev := n.MeanStdDev(); stddev < ConvergenceStdDev {
+			w.Converged = true
+			Events.Publish(Event{Type: EventConvergence, Position: symbol.Position, Data: map[string]interface{}{
+				"stddev": stddev,
+			}})
+		}
+	}
+	if math.IsNaN(entropy) {
+		Events.Publish(Event{Type: EventAnomaly, Position: symbol.Position, Data: map[string]interface{}{
+			"reason": "nan entropy",
+		}})
+		return
+	}
+	if w.Count >= AnomalyWarmup {
+		if z := (entropy - w.Mean) / math.Sqrt(w.Variance+1e-12); math.Abs(z) > AnomalyDeviations {
+			Events.Publish(Event{Type: EventAnomaly, Position: symbol.Position, Data: map[string]interface{}{
+				"reason":  "entropy",
+				"entropy": entropy,
+				"z":       z,
+			}})
+		}
+	}
+	w.Count++
+	if w.Count == 1 {
+		w.Mean = entropy
+		return
+	}
+	diff := entropy - w.Mean
+	w.Mean += AnomalyRate * diff
+	w.Variance += AnomalyRate * (diff*diff - w.Variance)
+}
+
+// StartEvents writes the events to the events file if it is set, returning a function that closes the file
+func StartEvents() func() {
+	if *FlagEvents == "" {
+		return func() {}
+	}
+	output, err := os.Create(*FlagEvents)
+	if err != nil {
+		panic(err)
+	}
+	encoder, mutex := json.NewEncoder(output), sync.Mutex{}
+	unsubscribe := Events.Subscribe(func(event Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err := encoder.Encode(event); err != nil {
+			panic(err)
+		}
+	})
+	return func() {
+		unsubscribe()
+		output.Close()
+	}
+}
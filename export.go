@@ -0,0 +1,112 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FlagExport is the file the colored symbols are exported to
+var FlagExport = OutputFlag(flag.CommandLine, "export", "", "export a record of each colored symbol to a jsonl or csv file, none when empty")
+
+// Record is the exported record of a colored symbol
+type Record struct {
+	// Position is the byte of the file the symbol begins at
+	Position int       `json:"position"`
+	Symbol   byte      `json:"symbol"`
+	Text     string    `json:"text"`
+	Code     int       `json:"code"`
+	Entropy  float32   `json:"entropy"`
+	Outputs  []float32 `json:"outputs"`
+}
+
+// Exporter writes a record of each colored symbol to a jsonl or csv file
+type Exporter struct {
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	csv     *csv.Writer
+	header  bool
+}
+
+// NewExporter makes an exporter writing to file, csv if the extension is .csv and jsonl otherwise
+func NewExporter(file string) *Exporter {
+	output, err := os.Create(file)
+	if err != nil {
+		panic(err)
+	}
+	e := &Exporter{file: output, writer: bufio.NewWriter(output)}
+	if strings.ToLower(filepath.Ext(file)) == ".csv" {
+		e.csv = csv.NewWriter(e.writer)
+	} else {
+		e.encoder = json.NewEncoder(e.writer)
+	}
+	return e
+}
+
+// NewFlagExporter makes an exporter from the export flag, nil when there is no export
+func NewFlagExporter() *Exporter {
+	if *FlagExport == "" {
+		return nil
+	}
+	return NewExporter(*FlagExport)
+}
+
+// Write writes the record of a symbol, the csv header is written with the first record
+func (e *Exporter) Write(symbol Symbol) {
+	record := Record{
+		Position: symbol.Offset,
+		Symbol:   symbol.Symbol,
+		Text:     symbol.String(),
+		Code:     symbol.Code,
+		Entropy:  symbol.Entropy,
+		Outputs:  symbol.Outputs,
+	}
+	if e.encoder != nil {
+		if err := e.encoder.Encode(record); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if !e.header {
+		header := []string{"position", "symbol", "text", "code", "entropy"}
+		for i := range record.Outputs {
+			header = append(header, "output"+strconv.Itoa(i))
+		}
+		if err := e.csv.Write(header); err != nil {
+			panic(err)
+		}
+		e.header = true
+	}
+	row := []string{strconv.Itoa(record.Position), strconv.Itoa(int(record.Symbol)), record.Text, strconv.Itoa(record.Code),
+		strconv.FormatFloat(float64(record.Entropy), 'g', -1, 32)}
+	for _, v := range record.Outputs {
+		row = append(row, strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	if err := e.csv.Write(row); err != nil {
+		panic(err)
+	}
+}
+
+// Close flushes and closes the export file
+func (e *Exporter) Close() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := e.writer.Flush(); err != nil {
+		return err
+	}
+	return e.file.Close()
+}
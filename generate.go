@@ -0,0 +1,80 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// GenerateCommand generates symbols by feeding the symbol addressed by each output code back into the network
+func GenerateCommand(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file the alphabet is taken from")
+	model := flags.String("model", "", "the frozen model to generate with, a new network when empty")
+	prime := flags.String("prime", "In the beginning", "text the network is primed with")
+	count := flags.Int("n", 256, "number of symbols to generate")
+	out := OutputFlag(flags, "o", "", "the file the output is written to, stdout when empty")
+	flags.Parse(args)
+
+	alphabet, seen := []byte{}, [256]bool{}
+	for _, symbol := range Load(*file) {
+		seen[symbol] = true
+	}
+	for symbol, ok := range seen {
+		if ok {
+			alphabet = append(alphabet, byte(symbol))
+		}
+	}
+	if len(alphabet) == 0 || *prime == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	net := NewFlagNet(8)
+	if *model != "" {
+		var err error
+		net, err = LoadNet(*model)
+		if err != nil {
+			panic(err)
+		}
+		net.Frozen = true
+	}
+	output := NewOutput(*out)
+	defer output.Close()
+	fmt.Fprint(output, *prime)
+	Generate(&net, alphabet, []byte(*prime), *count, nil, func(symbol byte, code int) {
+		fmt.Fprint(output, string(symbol))
+	})
+	fmt.Fprintln(output)
+}
+
+// Generate primes the network with the prime and then generates count symbols of the alphabet,
+// each addressed by the output code for the symbol before it, calling fn with each symbol and its code until done is closed
+func Generate(net *Net, alphabet, prime []byte, count int, done <-chan struct{}, fn func(symbol byte, code int)) {
+	in := NewInput(net)
+	text := append([]byte{}, prime...)
+	symbol, code := byte(0), 0
+	for i := range text {
+		net.Input(in, text, i)
+		out, _ := net.Fire(in)
+		code = net.Decode(out).Label
+		symbol = alphabet[code%len(alphabet)]
+	}
+	for i := 0; i < count; i++ {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		fn(symbol, code)
+		text = append(text, symbol)
+		net.Input(in, text, len(text)-1)
+		out, _ := net.Fire(in)
+		code = net.Decode(out).Label
+		symbol = alphabet[code%len(alphabet)]
+	}
+}
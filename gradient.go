@@ -0,0 +1,77 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+
+	ansi "github.com/fatih/color"
+)
+
+const (
+	// ColoringCode colors the symbols by their output code
+	ColoringCode = "code"
+	// ColoringEntropy colors the symbols on a cold to hot gradient by their entropy
+	ColoringEntropy = "entropy"
+	// GradientLevels is the number of colors of the gradient
+	GradientLevels = 32
+	// ThermometerRate is the rate the running mean and variance of the entropy of the gradient adapt at
+	ThermometerRate = .01
+)
+
+// FlagColoring is what the symbols are colored by
+var FlagColoring = flag.String("coloring", ColoringCode, "what the symbols are colored by: code or entropy, a cold to hot gradient")
+
+// Ramp are the basic terminal colors of the gradient from cold to hot
+var Ramp = [...]ansi.Attribute{ansi.FgBlue, ansi.FgCyan, ansi.FgGreen, ansi.FgYellow, ansi.FgRed}
+
+// NewGradient makes the terminal colors of the levels of the cold to hot gradient with the palette,
+// the basic palette has a color per step of the ramp
+func NewGradient(palette string) (gradient [GradientLevels]func(format string, a ...interface{}) string) {
+	palette = ResolvePalette(palette)
+	for level := range gradient {
+		heat := Heat(float64(level) / (GradientLevels - 1))
+		switch palette {
+		case PaletteBasic:
+			gradient[level] = Paint(Ramp[level*len(Ramp)/GradientLevels])
+		case Palette256:
+			gradient[level] = Escape(fmt.Sprintf("38;5;%d", XTerm(heat)))
+		case PaletteTruecolor:
+			gradient[level] = Escape(fmt.Sprintf("38;2;%d;%d;%d", heat.R, heat.G, heat.B))
+		default:
+			panic(fmt.Errorf("unknown palette %s", palette))
+		}
+	}
+	return gradient
+}
+
+// Thermometer maps the entropy to a level of the gradient by its quantile under the running mean and variance
+// of the entropy, so the gradient adapts to the range of the entropy of the network
+type Thermometer struct {
+	Count    int
+	Mean     float64
+	Variance float64
+}
+
+// Level is the level of the gradient of the entropy
+func (t *Thermometer) Level(entropy float32) int {
+	v := float64(entropy)
+	if math.IsNaN(v) {
+		return GradientLevels - 1
+	}
+	t.Count++
+	if t.Count == 1 {
+		t.Mean = v
+		return GradientLevels / 2
+	}
+	diff := v - t.Mean
+	t.Mean += ThermometerRate * diff
+	t.Variance += ThermometerRate * (diff*diff - t.Variance)
+	z := diff / math.Sqrt(t.Variance+1e-12)
+	quantile := .5 * (1 + math.Erf(z/math.Sqrt2))
+	return min(int(quantile*GradientLevels), GradientLevels-1)
+}
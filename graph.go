@@ -0,0 +1,137 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// NodesPosition makes a node of each position
+	NodesPosition = "position"
+	// NodesLine collapses the positions of a line into a node
+	NodesLine = "line"
+	// NodesSentence collapses the positions of a sentence into a node
+	NodesSentence = "sentence"
+	// GraphLabel is the longest label of a node in runes
+	GraphLabel = 32
+)
+
+// Edge is a transition between two nodes of the graph
+type Edge struct {
+	From, To int
+}
+
+// Graph is the digraph of the transitions of a wander between the nodes the positions are collapsed into
+type Graph struct {
+	// Node is the node of each position
+	Node []int
+	// Labels are the labels of the nodes
+	Labels []string
+	// Edges are the number of transitions of each edge
+	Edges map[Edge]int
+	// Teleports are the number of transitions of each edge that were teleports
+	Teleports map[Edge]int
+}
+
+// NewGraph makes a graph of the tokens with the positions collapsed into nodes: position, line or sentence
+func NewGraph(tokens []Token, nodes string) *Graph {
+	g := &Graph{
+		Node:      make([]int, len(tokens)),
+		Edges:     make(map[Edge]int),
+		Teleports: make(map[Edge]int),
+	}
+	label := strings.Builder{}
+	end := func() {
+		text := strings.Join(strings.Fields(Printable(label.String())), " ")
+		if text == "" {
+			text = strings.Trim(strconv.Quote(label.String()), `"`)
+		}
+		if runes := []rune(text); len(runes) > GraphLabel {
+			text = string(runes[:GraphLabel-1]) + "…"
+		}
+		g.Labels = append(g.Labels, text)
+		label.Reset()
+	}
+	for position, token := range tokens {
+		g.Node[position] = len(g.Labels)
+		label.WriteString(token.Text)
+		switch nodes {
+		case NodesPosition:
+			end()
+		case NodesLine:
+			if strings.HasSuffix(token.Text, "\n") {
+				end()
+			}
+		case NodesSentence:
+			if strings.ContainsAny(strings.TrimSpace(token.Text), ".!?") {
+				end()
+			}
+		default:
+			panic(fmt.Errorf("unknown graph nodes %s", nodes))
+		}
+	}
+	if label.Len() > 0 {
+		end()
+	}
+	return g
+}
+
+// Add adds the transition of a jump
+func (g *Graph) Add(jump Jump) {
+	edge := Edge{From: g.Node[jump.From], To: g.Node[jump.To]}
+	g.Edges[edge]++
+	if jump.Teleport {
+		g.Teleports[edge]++
+	}
+}
+
+// quote quotes a label for dot
+func quote(label string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(label) + `"`
+}
+
+// Write writes the graph in the graphviz dot language, the nodes without transitions are left out.
+// The label of an edge is its number of transitions and an edge that was only teleported along is dashed
+func (g *Graph) Write(w io.Writer) error {
+	edges, nodes := make([]Edge, 0, len(g.Edges)), make(map[int]bool)
+	for edge := range g.Edges {
+		edges = append(edges, edge)
+		nodes[edge.From], nodes[edge.To] = true, true
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	ids := make([]int, 0, len(nodes))
+	for node := range nodes {
+		ids = append(ids, node)
+	}
+	sort.Ints(ids)
+
+	output := bufio.NewWriter(w)
+	fmt.Fprintln(output, "digraph wander {")
+	fmt.Fprintln(output, "\tnode [shape=box, fontname=monospace];")
+	for _, node := range ids {
+		fmt.Fprintf(output, "\tn%d [label=%s];\n", node, quote(g.Labels[node]))
+	}
+	for _, edge := range edges {
+		count := g.Edges[edge]
+		fmt.Fprintf(output, "\tn%d -> n%d [label=%d", edge.From, edge.To, count)
+		if g.Teleports[edge] == count {
+			fmt.Fprint(output, ", style=dashed")
+		}
+		fmt.Fprintln(output, "];")
+	}
+	fmt.Fprintln(output, "}")
+	return output.Flush()
+}
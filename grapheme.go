@@ -0,0 +1,201 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FlagGraphemes displays whole grapheme clusters so the coloring never splits a user perceived character
+var FlagGraphemes = flag.Bool("graphemes", false, "display whole grapheme clusters in the color of their first symbol")
+
+// GraphemeBreak is the grapheme cluster break property of a rune from unicode tr29
+type GraphemeBreak int
+
+const (
+	// BreakOther is any other rune
+	BreakOther GraphemeBreak = iota
+	// BreakCR is a carriage return
+	BreakCR
+	// BreakLF is a line feed
+	BreakLF
+	// BreakControl is a control rune
+	BreakControl
+	// BreakExtend is a combining mark or other extending rune
+	BreakExtend
+	// BreakZWJ is the zero width joiner
+	BreakZWJ
+	// BreakRegionalIndicator is a regional indicator, pairs of them are flags
+	BreakRegionalIndicator
+	// BreakPrepend is a rune that joins the following rune
+	BreakPrepend
+	// BreakSpacingMark is a spacing combining mark
+	BreakSpacingMark
+	// BreakL is a hangul leading consonant
+	BreakL
+	// BreakV is a hangul vowel
+	BreakV
+	// BreakT is a hangul trailing consonant
+	BreakT
+	// BreakLV is a hangul syllable without a trailing consonant
+	BreakLV
+	// BreakLVT is a hangul syllable with a trailing consonant
+	BreakLVT
+	// BreakPictographic is an extended pictographic rune, an emoji
+	BreakPictographic
+)
+
+// Pictographic are the ranges of the extended pictographic runes
+var Pictographic = [][2]rune{
+	{0x00a9, 0x00a9}, {0x00ae, 0x00ae}, {0x203c, 0x203c}, {0x2049, 0x2049}, {0x2122, 0x2122},
+	{0x2139, 0x2139}, {0x2194, 0x2199}, {0x21a9, 0x21aa}, {0x231a, 0x231b}, {0x2328, 0x2328},
+	{0x23cf, 0x23cf}, {0x23e9, 0x23f3}, {0x23f8, 0x23fa}, {0x24c2, 0x24c2}, {0x25aa, 0x25ab},
+	{0x25b6, 0x25b6}, {0x25c0, 0x25c0}, {0x25fb, 0x25fe}, {0x2600, 0x27bf}, {0x2934, 0x2935},
+	{0x2b05, 0x2b07}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x3030, 0x3030},
+	{0x303d, 0x303d}, {0x3297, 0x3297}, {0x3299, 0x3299}, {0x1f000, 0x1f1e5}, {0x1f200, 0x1f3fa},
+	{0x1f400, 0x1faff},
+}
+
+// Break computes the grapheme cluster break property of a rune
+func Break(r rune) GraphemeBreak {
+	switch {
+	case r == '\r':
+		return BreakCR
+	case r == '\n':
+		return BreakLF
+	case r == 0x200d:
+		return BreakZWJ
+	case r == 0x200c, r >= 0xff9e && r <= 0xff9f, r >= 0x1f3fb && r <= 0x1f3ff, r >= 0xe0020 && r <= 0xe007f,
+		unicode.In(r, unicode.Mn, unicode.Me):
+		return BreakExtend
+	case r >= 0x1f1e6 && r <= 0x1f1ff:
+		return BreakRegionalIndicator
+	case r >= 0x0600 && r <= 0x0605, r == 0x06dd, r == 0x070f, r == 0x0890, r == 0x0891, r == 0x08e2,
+		r == 0x110bd, r == 0x110cd:
+		return BreakPrepend
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return BreakControl
+	case unicode.Is(unicode.Mc, r):
+		return BreakSpacingMark
+	case r >= 0x1100 && r <= 0x115f, r >= 0xa960 && r <= 0xa97c:
+		return BreakL
+	case r >= 0x1160 && r <= 0x11a7, r >= 0xd7b0 && r <= 0xd7c6:
+		return BreakV
+	case r >= 0x11a8 && r <= 0x11ff, r >= 0xd7cb && r <= 0xd7fb:
+		return BreakT
+	case r >= 0xac00 && r <= 0xd7a3:
+		if (r-0xac00)%28 == 0 {
+			return BreakLV
+		}
+		return BreakLVT
+	}
+	for _, span := range Pictographic {
+		if r >= span[0] && r <= span[1] {
+			return BreakPictographic
+		}
+	}
+	return BreakOther
+}
+
+// Graphemes groups the text of the colored symbols into grapheme clusters, each cluster is emitted
+// with the code of its first symbol once the rune following it is seen
+type Graphemes struct {
+	// Emit is called with each grapheme cluster and its code
+	Emit func(cluster string, code int)
+
+	raw      []byte
+	cluster  []byte
+	code     int
+	pending  int
+	last     GraphemeBreak
+	regional int
+	emoji    bool
+}
+
+// Write adds the bytes of a symbol with its code, the bytes of a rune can be split across symbols
+func (g *Graphemes) Write(text []byte, code int) {
+	if len(g.raw) == 0 {
+		g.pending = code
+	}
+	g.raw = append(g.raw, text...)
+	for len(g.raw) > 0 && utf8.FullRune(g.raw) {
+		r, size := utf8.DecodeRune(g.raw)
+		g.add(r, g.raw[:size], g.pending)
+		g.raw, g.pending = g.raw[size:], code
+	}
+}
+
+func (g *Graphemes) add(r rune, text []byte, code int) {
+	current := Break(r)
+	if len(g.cluster) > 0 && g.boundary(current) {
+		g.Emit(string(g.cluster), g.code)
+		g.cluster = g.cluster[:0]
+	}
+	if len(g.cluster) == 0 {
+		g.code = code
+	}
+	switch {
+	case current == BreakPictographic:
+		g.emoji = true
+	case current != BreakExtend && current != BreakZWJ:
+		g.emoji = false
+	}
+	if current == BreakRegionalIndicator {
+		g.regional++
+	} else {
+		g.regional = 0
+	}
+	g.cluster = append(g.cluster, text...)
+	g.last = current
+}
+
+// boundary applies the grapheme cluster boundary rules between the last rune and a rune with the break property
+func (g *Graphemes) boundary(next GraphemeBreak) bool {
+	last := g.last
+	switch {
+	case last == BreakCR && next == BreakLF:
+		return false
+	case last == BreakCR || last == BreakLF || last == BreakControl:
+		return true
+	case next == BreakCR || next == BreakLF || next == BreakControl:
+		return true
+	case last == BreakL && (next == BreakL || next == BreakV || next == BreakLV || next == BreakLVT):
+		return false
+	case (last == BreakLV || last == BreakV) && (next == BreakV || next == BreakT):
+		return false
+	case (last == BreakLVT || last == BreakT) && next == BreakT:
+		return false
+	case next == BreakExtend || next == BreakZWJ || next == BreakSpacingMark || last == BreakPrepend:
+		return false
+	case last == BreakZWJ && next == BreakPictographic && g.emoji:
+		return false
+	case last == BreakRegionalIndicator && next == BreakRegionalIndicator:
+		return g.regional%2 == 0
+	}
+	return true
+}
+
+// Flush emits the final grapheme cluster, along with any incomplete utf-8
+func (g *Graphemes) Flush() {
+	if len(g.cluster) == 0 {
+		g.code = g.pending
+	}
+	g.cluster = append(g.cluster, g.raw...)
+	if len(g.cluster) > 0 {
+		g.Emit(string(g.cluster), g.code)
+	}
+	g.raw, g.cluster, g.regional, g.emoji = g.raw[:0], g.cluster[:0], 0, false
+}
+
+// SymbolBytes are the bytes of the corpus a symbol covers, a byte symbol is its raw byte so
+// the runes split across byte symbols can be put back together
+func SymbolBytes(symbol Symbol) []byte {
+	if *FlagToken == "byte" && !*FlagRunes {
+		return []byte{symbol.Symbol}
+	}
+	return []byte(symbol.String())
+}
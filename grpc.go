@@ -0,0 +1,142 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pointlander/testament/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCCount is the number of symbols generated when a generate request doesn't set the count
+const GRPCCount = 256
+
+// FlagGRPC is the address the grpc api is served on
+var FlagGRPC = ServeFlags.String("grpc", "", "address the grpc api is served on, disabled when empty")
+
+// API is the grpc api, streaming the codes of the served models as they are computed
+type API struct{}
+
+// model loads the named model, a new network with outputs when the name is empty
+func (API) model(name string, outputs int) (Net, error) {
+	if name == "" {
+		return NewFlagNet(outputs), nil
+	}
+	net, err := LoadModel(name)
+	if err != nil {
+		return net, status.Error(codes.NotFound, err.Error())
+	}
+	return net, nil
+}
+
+// send calls run with a done channel and a send function, done is closed when a send fails or the client goes away
+func send[T any](stream grpc.ServerStreamingServer[T], run func(done <-chan struct{}, send func(*T))) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	var failed error
+	run(ctx.Done(), func(message *T) {
+		if failed != nil {
+			return
+		}
+		if failed = stream.Send(message); failed != nil {
+			cancel()
+		}
+	})
+	if failed != nil {
+		return failed
+	}
+	return stream.Context().Err()
+}
+
+// Colorize colors the text, streaming the code of each symbol
+func (a API) Colorize(in *rpc.ColorizeRequest, stream grpc.ServerStreamingServer[rpc.Code]) error {
+	model, err := a.model(in.Model, 3)
+	if err != nil {
+		return err
+	}
+	return send(stream, func(done <-chan struct{}, send func(*rpc.Code)) {
+		Color(&model, in.Text, 0, done, func(symbol Symbol) {
+			send(&rpc.Code{
+				Position: int64(symbol.Position),
+				Symbol:   uint32(symbol.Symbol),
+				Code:     int32(symbol.Code),
+				Entropy:  symbol.Entropy,
+				Label:    int32(symbol.Label),
+			})
+		})
+	})
+}
+
+// Wander follows the output codes of the network around the text, streaming each jump
+func (a API) Wander(in *rpc.WanderRequest, stream grpc.ServerStreamingServer[rpc.Step]) error {
+	if len(in.Text) == 0 {
+		return status.Error(codes.InvalidArgument, "the text is empty")
+	}
+	model, err := a.model(in.Model, 16)
+	if err != nil {
+		return err
+	}
+	tokens := Tokenize(NewByteTokenizer(in.Text))
+	return send(stream, func(done <-chan struct{}, send func(*rpc.Step)) {
+		walkers := NewWalkers(&model, 1, 0, len(tokens), false)
+		Wander(walkers, tokens, Walk{StopOnRevisit: true}, done, func(jump Jump) {
+			send(&rpc.Step{
+				Position: int64(jump.To),
+				Code:     int32(jump.Code),
+				Token:    []byte(tokens[jump.To].Text),
+			})
+		})
+	})
+}
+
+// Generate primes the network and then streams the generated symbols
+func (a API) Generate(in *rpc.GenerateRequest, stream grpc.ServerStreamingServer[rpc.Generated]) error {
+	if len(in.Prime) == 0 {
+		return status.Error(codes.InvalidArgument, "the prime is empty")
+	}
+	alphabet := in.Alphabet
+	if len(alphabet) == 0 {
+		seen := [256]bool{}
+		for _, symbol := range in.Prime {
+			if !seen[symbol] {
+				seen[symbol] = true
+				alphabet = append(alphabet, symbol)
+			}
+		}
+	}
+	count := int(in.Count)
+	if count <= 0 {
+		count = GRPCCount
+	}
+	model, err := a.model(in.Model, 8)
+	if err != nil {
+		return err
+	}
+	model.Frozen = in.Model != ""
+	return send(stream, func(done <-chan struct{}, send func(*rpc.Generated)) {
+		Generate(&model, alphabet, in.Prime, count, done, func(symbol byte, code int) {
+			send(&rpc.Generated{Symbol: uint32(symbol), Code: int32(code)})
+		})
+	})
+}
+
+// ServeGRPC serves the grpc api
+func ServeGRPC(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	server := rpc.NewServer()
+	rpc.RegisterTestamentServer(server, API{})
+	fmt.Println("serving grpc on", addr)
+	if err := server.Serve(listener); err != nil {
+		panic(err)
+	}
+}
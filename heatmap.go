@@ -0,0 +1,105 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// HeatmapWidth is the number of positions per row of a heatmap image
+	HeatmapWidth = 256
+	// HeatmapScale is the size of the pixel of a position in a heatmap image
+	HeatmapScale = 2
+	// HeatmapColumns is the number of positions per row of the bar view
+	HeatmapColumns = 80
+	// HeatmapBar is the width of the bars of the bar view
+	HeatmapBar = 16
+)
+
+// Visits are the number of times the codes of a wander addressed each position,
+// including the addresses that were diverted to an unvisited position
+type Visits []int
+
+// Add counts the position addressed by the code of the jump
+func (v Visits) Add(jump Jump) {
+	v[jump.Addressed]++
+}
+
+// Heat is the heat of each position between 0 and 1, the log of its visits relative to the most visited position
+func (v Visits) Heat() []float64 {
+	most := 0
+	for _, count := range v {
+		most = max(most, count)
+	}
+	heat := make([]float64, len(v))
+	if most == 0 {
+		return heat
+	}
+	for i, count := range v {
+		heat[i] = math.Log1p(float64(count)) / math.Log1p(float64(most))
+	}
+	return heat
+}
+
+// Rendering lays the heat of the positions of the tokens out with width positions per row, starting a new row at each newline
+func (v Visits) Rendering(tokens []Token, width int) Rendering {
+	r := Rendering{Texts: make([]string, len(tokens)), Fills: make([]color.RGBA, len(tokens)), Columns: width}
+	for i, heat := range v.Heat() {
+		r.Texts[i], r.Fills[i] = tokens[i].Text, Heat(heat)
+	}
+	r.Cells, r.Rows = Layout(r.Texts, width, true)
+	return r
+}
+
+// Bars writes a row of the text per line, each after a bar of the visits of the row and with the text colored by its heat
+func (v Visits) Bars(w io.Writer, tokens []Token) {
+	r := v.Rendering(tokens, HeatmapColumns)
+	heat, gradient := v.Heat(), NewGradient(*FlagPalette)
+	sums, texts := make([]int, r.Rows), make([]strings.Builder, r.Rows)
+	for i, cell := range r.Cells {
+		sums[cell.Y] += v[i]
+		if cell.X < 0 {
+			continue
+		}
+		level := int(heat[i] * (GradientLevels - 1))
+		texts[cell.Y].WriteString(gradient[level](Printable(r.Texts[i])))
+	}
+	most := 1
+	for _, sum := range sums {
+		most = max(most, sum)
+	}
+	for y := range sums {
+		length := (sums[y]*HeatmapBar + most - 1) / most
+		bar := strings.Repeat("█", length) + strings.Repeat(" ", HeatmapBar-length)
+		fmt.Fprintf(w, "%6d %s %s\n", sums[y], bar, texts[y].String())
+	}
+}
+
+// Write writes the heatmap to a png or svg file, or as the bar view to w when the file is -
+func (v Visits) Write(file string, tokens []Token, w io.Writer) {
+	if file == "-" {
+		v.Bars(w, tokens)
+		return
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	r := v.Rendering(tokens, HeatmapWidth)
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".svg":
+		r.SVG(out, RenderPixel, HeatmapScale)
+	default:
+		r.PNG(out, RenderPixel, HeatmapScale)
+	}
+}
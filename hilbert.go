@@ -0,0 +1,96 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+)
+
+// Palette are the rgb values of the colors
+var Palette = NewPalette()
+
+// Hilbert converts a distance along a hilbert curve filling a square with side n into coordinates
+func Hilbert(n, d int) (x, y int) {
+	for s := 1; s < n; s *= 2 {
+		rx := 1 & (d / 2)
+		ry := 1 & (d ^ rx)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = s-1-x, s-1-y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		d /= 4
+	}
+	return x, y
+}
+
+// Heat maps a value between 0 and 1 to a blue to red heat color
+func Heat(value float64) color.RGBA {
+	value = math.Max(0, math.Min(1, value))
+	return color.RGBA{uint8(255 * value), 0, uint8(255 * (1 - value)), 0xff}
+}
+
+// HilbertMap lays the corpus out along a hilbert curve into an image
+func HilbertMap(args []string) {
+	flags := flag.NewFlagSet("hilbert", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	mode := flags.String("mode", "code", "pixel color: code or entropy")
+	output := OutputFlag(flags, "o", "hilbert.png", "the png file to write")
+	flags.Parse(args)
+
+	if *mode != "code" && *mode != "entropy" {
+		panic(fmt.Errorf("unknown mode %s", *mode))
+	}
+	data := Load(*file)
+	net := NewFlagNet(3)
+	if *model != "" {
+		var err error
+		net, err = LoadNet(*model)
+		if err != nil {
+			panic(err)
+		}
+		net.Frozen = true
+	}
+	symbols := make([]Symbol, 0, len(data))
+	low, high := float32(math.MaxFloat32), float32(-math.MaxFloat32)
+	Color(&net, data, 0, nil, func(symbol Symbol) {
+		symbols = append(symbols, symbol)
+		low, high = min(low, symbol.Entropy), max(high, symbol.Entropy)
+	})
+
+	side := 1
+	for side*side < len(symbols) {
+		side *= 2
+	}
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	for _, symbol := range symbols {
+		x, y := Hilbert(side, symbol.Position)
+		if *mode == "code" {
+			img.SetRGBA(x, y, Palette[symbol.Code])
+		} else if high > low {
+			img.SetRGBA(x, y, Heat(float64((symbol.Entropy-low)/(high-low))))
+		}
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	err = png.Encode(out, img)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("wrote %dx%d map of %d symbols to %s\n", side, side, len(symbols), *output)
+}
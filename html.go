@@ -0,0 +1,96 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"html/template"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed ui/report.html
+var report string
+
+// ReportTemplate is the template of the html report
+var ReportTemplate = template.Must(template.New("report").Parse(report))
+
+// Report is the data of the html report
+type Report struct {
+	Name      string
+	Text      string
+	Codes     []int
+	Entropies []float32
+	Heads     []int
+	Metas     []Meta
+	MetaIndex []int
+	// RTL are the runs of right to left symbols
+	RTL [][2]int
+	// Changepoints are the structural breaks of the series
+	Changepoints []Changepoint
+	bidi         Bidi
+}
+
+// Add adds a symbol to the report
+func (r *Report) Add(text *strings.Builder, symbol Symbol) {
+	text.WriteString(symbol.String())
+	r.bidi.Add(len(r.Codes), symbol.String())
+	r.Codes = append(r.Codes, symbol.Code)
+	r.Entropies = append(r.Entropies, symbol.Entropy)
+	r.Heads = append(r.Heads, symbol.Head)
+	if len(r.Metas) == 0 || !maps.Equal(r.Metas[len(r.Metas)-1], symbol.Meta) {
+		r.Metas = append(r.Metas, symbol.Meta)
+	}
+	r.MetaIndex = append(r.MetaIndex, len(r.Metas)-1)
+}
+
+// HTMLReport writes a self contained interactive html report of the corpus
+func HTMLReport(args []string) {
+	flags := flag.NewFlagSet("html", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	output := OutputFlag(flags, "o", "report.html", "the html file to write")
+	series := flags.String("changepoints", "", "mark the breaks of the entropy or code series, none when empty")
+	penalty := flags.Float64("penalty", 3, "penalty of a break in units of the degrees of freedom times the log of the length")
+	minimum := flags.Int("min", 64, "minimum length of a segment between breaks")
+	flags.Parse(args)
+
+	net := NewFlagNet(3)
+	if *model != "" {
+		var err error
+		net, err = LoadNet(*model)
+		if err != nil {
+			panic(err)
+		}
+		net.Frozen = true
+	}
+	r := Report{Name: filepath.Base(*file)}
+	text := strings.Builder{}
+	add := func(symbol Symbol) {
+		r.Add(&text, symbol)
+	}
+	ColorTokens(&net, NewTokenizer(*file), 0, nil, add)
+	r.Text = text.String()
+	r.bidi.Close()
+	r.RTL = r.bidi.Runs
+	if *series != "" {
+		r.Changepoints = Changepoints(*series, r.Codes, r.Entropies, *penalty, *minimum)
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	err = ReportTemplate.Execute(out, r)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("wrote report of %d symbols to %s\n", len(r.Codes), *output)
+}
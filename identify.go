@@ -0,0 +1,125 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Candidate is the score of the input under one of the models of an identification
+type Candidate struct {
+	// Name is the name of the model, the language or author it was trained on
+	Name string
+	// Model is the file of the model
+	Model string
+	// Entropy is the mean entropy of the input under the frozen model
+	Entropy float64
+	// Confidence is the probability the model is the best match, the mean over the symbols of the probability
+	// the model is the least surprised by the symbol
+	Confidence float64
+	// entropies are the entropies of the symbols
+	entropies []float64
+}
+
+// Identify scores the data under each of the frozen models, the candidates are ordered from the best match, the lowest
+// mean entropy, to the worst. The probabilities of a symbol are the softmax of its negative entropies under the models
+// over the temperature times the mean spread of the entropies of a symbol, the confidences are the means of the
+// probabilities over the symbols so they don't saturate with the length of the data
+func Identify(models map[string]string, data []byte, temperature float64) []Candidate {
+	candidates := []Candidate{}
+	for name, model := range models {
+		candidate := Candidate{Name: name, Model: model}
+		Score(model, data, func(symbol Symbol) {
+			candidate.Entropy += float64(symbol.Entropy)
+			candidate.entropies = append(candidate.entropies, float64(symbol.Entropy))
+		})
+		candidate.Entropy /= float64(max(len(data), 1))
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Entropy != candidates[j].Entropy {
+			return candidates[i].Entropy < candidates[j].Entropy
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	symbols := len(candidates[0].entropies)
+	if symbols == 0 {
+		for i := range candidates {
+			candidates[i].Confidence = 1 / float64(len(candidates))
+		}
+		return candidates
+	}
+	spread := 0.0
+	for s := 0; s < symbols; s++ {
+		lowest, highest := math.Inf(1), math.Inf(-1)
+		for _, candidate := range candidates {
+			lowest, highest = math.Min(lowest, candidate.entropies[s]), math.Max(highest, candidate.entropies[s])
+		}
+		spread += (highest - lowest) / float64(symbols)
+	}
+	if spread > 0 {
+		temperature *= spread
+	}
+	probabilities := make([]float64, len(candidates))
+	for s := 0; s < symbols; s++ {
+		lowest, sum := math.Inf(1), 0.0
+		for _, candidate := range candidates {
+			lowest = math.Min(lowest, candidate.entropies[s])
+		}
+		for i, candidate := range candidates {
+			probabilities[i] = math.Exp(-(candidate.entropies[s] - lowest) / temperature)
+			sum += probabilities[i]
+		}
+		for i := range candidates {
+			candidates[i].Confidence += probabilities[i] / sum / float64(symbols)
+		}
+	}
+	return candidates
+}
+
+// IdentifyCommand identifies the language or author of the corpus by which of the models, one trained per
+// language or author, is least surprised by it
+func IdentifyCommand(args []string) {
+	flags := flag.NewFlagSet("identify", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to identify")
+	temperature := flags.Float64("temperature", 1, "temperature of the softmax of the entropies of each symbol under the models giving the confidences, relative to their mean spread")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: identify [flags] [name=]model...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 || *temperature <= 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	models := make(map[string]string)
+	for _, arg := range flags.Args() {
+		name, model, found := strings.Cut(arg, "=")
+		if !found {
+			model = arg
+			name = strings.TrimSuffix(filepath.Base(model), filepath.Ext(model))
+		}
+		if _, ok := models[name]; ok {
+			panic(fmt.Errorf("model %s is given more than once", name))
+		}
+		models[name] = model
+	}
+	data := Load(*file)
+	candidates := Identify(models, data, *temperature)
+	fmt.Printf("%-16s %12s %12s %s\n", "name", "entropy", "confidence", "model")
+	for _, candidate := range candidates {
+		fmt.Printf("%-16s %12f %12f %s\n", candidate.Name, candidate.Entropy, candidate.Confidence, candidate.Model)
+	}
+	best := candidates[0]
+	fmt.Printf("best match %s with confidence %f\n", best.Name, best.Confidence)
+	Metric("confidence", best.Confidence)
+}
@@ -0,0 +1,284 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	// FlagCache is the directory downloaded files are cached in
+	FlagCache = flag.String("cache", "", "directory downloaded files are cached in, defaults to the user cache directory")
+	// FlagOffset is the byte of each file the processing starts at
+	FlagOffset = flag.Int("offset", 0, "the byte of each file the processing starts at, negative counts back from the end")
+	// FlagLimit is the number of bytes of each file processed
+	FlagLimit = flag.Int("limit", 0, "the number of bytes of each file processed from the offset, 0 for the rest of the file")
+)
+
+// Decompressor is a decompression format
+type Decompressor struct {
+	Extension string
+	Magic     []byte
+	Reader    func(input io.Reader) (io.Reader, error)
+}
+
+// Decompressors are the supported decompression formats
+var Decompressors = []Decompressor{
+	{".bz2", []byte("BZh"), func(input io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(input), nil
+	}},
+	{".gz", []byte{0x1f, 0x8b}, func(input io.Reader) (io.Reader, error) {
+		return gzip.NewReader(input)
+	}},
+	{".xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, func(input io.Reader) (io.Reader, error) {
+		return xz.NewReader(input)
+	}},
+	{".zst", []byte{0x28, 0xb5, 0x2f, 0xfd}, func(input io.Reader) (io.Reader, error) {
+		decoder, err := zstd.NewReader(input)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}},
+}
+
+// Compression is the decompression format of the file detected by its magic bytes or its extension, nil when it isn't compressed
+func Compression(file string, magic []byte) *Decompressor {
+	for i := range Decompressors {
+		if bytes.HasPrefix(magic, Decompressors[i].Magic) {
+			return &Decompressors[i]
+		}
+	}
+	extension := filepath.Ext(file)
+	for i := range Decompressors {
+		if Decompressors[i].Extension == extension {
+			return &Decompressors[i]
+		}
+	}
+	return nil
+}
+
+// Decompress detects the compression of the input by its magic bytes or the extension of the file,
+// returning the decompressed reader and whether the input was compressed
+func Decompress(file string, input io.Reader) (io.Reader, bool, error) {
+	buffered := bufio.NewReader(input)
+	magic, _ := buffered.Peek(8)
+	if decompressor := Compression(file, magic); decompressor != nil {
+		reader, err := decompressor.Reader(buffered)
+		return reader, true, err
+	}
+	return buffered, false, nil
+}
+
+// IsURL is true if the file is an http(s) url
+func IsURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// CacheDir is the directory downloaded files are cached in
+func CacheDir() (string, error) {
+	if *FlagCache != "" {
+		return *FlagCache, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "testament"), nil
+}
+
+// Fetch downloads the url into the cache directory if it isn't already cached, returning the cached file
+func Fetch(address string) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(address))
+	name := filepath.Join(dir, hex.EncodeToString(hash[:8])+"-"+path.Base(u.Path))
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	response, err := http.Get(address)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", address, response.Status)
+	}
+	output, err := os.CreateTemp(dir, "download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(output.Name())
+	_, err = io.Copy(output, response.Body)
+	if err == nil {
+		err = output.Close()
+	} else {
+		output.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	return name, os.Rename(output.Name(), name)
+}
+
+// Files expands a directory or glob into the sorted list of files it matches,
+// anything else is a single file
+func Files(pattern string) []string {
+	if pattern == "" || pattern == "-" || IsURL(pattern) {
+		return []string{pattern}
+	}
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		files := []string{}
+		err := filepath.WalkDir(pattern, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			panic(err)
+		}
+		return files
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			panic(err)
+		}
+		if len(files) == 0 {
+			panic(fmt.Errorf("no files match %s", pattern))
+		}
+		return files
+	}
+	return []string{pattern}
+}
+
+// Open opens a file, an empty file or - is stdin and an http(s) url is downloaded into the cache
+func Open(file string) (io.ReadCloser, error) {
+	if file == "" || file == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if IsURL(file) {
+		cached, err := Fetch(file)
+		if err != nil {
+			return nil, err
+		}
+		file = cached
+	}
+	return os.Open(file)
+}
+
+// Read reads a file, decompressing compressed files, and returns whether it was compressed
+func Read(file string) ([]byte, bool) {
+	input, err := Open(file)
+	if err != nil {
+		panic(err)
+	}
+	defer input.Close()
+	reader, compressed, err := Decompress(file, input)
+	if err != nil {
+		panic(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		panic(err)
+	}
+	return data, compressed
+}
+
+// Range is the range of length bytes selected by the offset and limit flags
+func Range(length int) (begin, end int) {
+	if *FlagLimit < 0 {
+		panic(fmt.Errorf("the limit %d is negative", *FlagLimit))
+	}
+	begin = *FlagOffset
+	if begin < 0 {
+		begin += length
+	}
+	begin, end = min(max(begin, 0), length), length
+	if *FlagLimit > 0 {
+		end = min(begin+*FlagLimit, length)
+	}
+	return begin, end
+}
+
+// LoadRawAt loads the range of a file selected by the offset and limit flags, decompressing compressed files.
+// The range is moved forward to the boundaries of the runes so no rune is cut in half,
+// the byte of the file the range begins at is returned with it
+func LoadRawAt(file string) ([]byte, int) {
+	data, _ := Read(file)
+	begin, end := Range(len(data))
+	for begin < end && !utf8.RuneStart(data[begin]) {
+		begin++
+	}
+	for end < len(data) && end > begin && !utf8.RuneStart(data[end]) {
+		end--
+	}
+	return data[begin:end], begin
+}
+
+// LoadAt loads a file, decompressing compressed files and dropping their runes that don't fit in a byte.
+// With a transliteration the runes of compressed files are kept, they are transliterated as they are embedded.
+// The range selected by the offset and limit flags is returned with the byte of the loaded file it begins at
+func LoadAt(file string) ([]byte, int) {
+	d, compressed := Read(file)
+	if !compressed || CurrentTransliteration() != nil {
+		begin, end := Range(len(d))
+		return d[begin:end], begin
+	}
+	slog.Debug("decompressed", "file", file, "length", len(d))
+	data := []byte{}
+	runes := []rune(string(d))
+	count := 0
+	for _, v := range runes {
+		if v < 256 {
+			data = append(data, byte(v))
+		} else {
+			count++
+		}
+	}
+	slog.Debug("dropped the runes that don't fit in a byte", "file", file, "count", count)
+	begin, end := Range(len(data))
+	return data[begin:end], begin
+}
+
+// Load loads the range of a file selected by the offset and limit flags like LoadAt
+func Load(file string) []byte {
+	data, _ := LoadAt(file)
+	return data
+}
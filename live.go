@@ -0,0 +1,103 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// FlagLive is the book colored for each viewer of the live websocket
+var FlagLive = ServeFlags.String("live", "", "the book colored for each viewer of the /live websocket, the viewers send the text to color when empty")
+
+//go:embed ui/live.html
+var livePage []byte
+
+// LiveError is sent to a viewer of the live websocket when the coloring can't start
+type LiveError struct {
+	Error string `json:"error"`
+}
+
+// LiveStream pushes the symbols of the book to each viewer of the websocket as the network reads it,
+// or with no book the symbols of each text message sent by the viewer.
+// The network of a viewer is warm across its messages and the viewer picks the model with the model parameter
+func LiveStream(book []byte) websocket.Server {
+	stream := func(ws *websocket.Conn) {
+		defer ws.Close()
+		net, err := LoadModel(ws.Request().URL.Query().Get("model"))
+		if err != nil {
+			websocket.JSON.Send(ws, LiveError{Error: err.Error()})
+			return
+		}
+		ctx, cancel := context.WithCancel(ws.Request().Context())
+		defer cancel()
+		offset := 0
+		send := func(symbol Symbol) {
+			symbol.Position += offset
+			if websocket.JSON.Send(ws, symbol) != nil {
+				cancel()
+			}
+		}
+		if len(book) > 0 {
+			go func() {
+				io.Copy(io.Discard, ws)
+				cancel()
+			}()
+			Color(&net, book, 0, ctx.Done(), send)
+			return
+		}
+		for {
+			var text string
+			if err := websocket.Message.Receive(ws, &text); err != nil {
+				return
+			}
+			offset += Color(&net, []byte(text), 0, ctx.Done(), send)
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+	}
+	return websocket.Server{Handshake: SameOrigin, Handler: stream}
+}
+
+// SameOrigin accepts the websocket handshakes of the pages served by this server, and of clients that aren't browsers
+// and send no origin, so that other sites can't open the websocket with the credentials of a viewer
+func SameOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(parsed.Host, r.Host) {
+		return fmt.Errorf("origin %s is not %s", origin, r.Host)
+	}
+	config.Origin = parsed
+	return nil
+}
+
+// LiveHandler serves the live page, upgrading the requests of the page to the live websocket
+func LiveHandler(book []byte) http.Handler {
+	stream := LiveStream(book)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			stream.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(livePage)
+	})
+}
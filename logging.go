@@ -0,0 +1,66 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const (
+	// LogText logs human readable key value pairs
+	LogText = "text"
+	// LogJSON logs a json object per line
+	LogJSON = "json"
+	// LevelTrace is the level of the per symbol diagnostics, below debug
+	LevelTrace = slog.Level(-8)
+)
+
+var (
+	// FlagVerbose logs the debug diagnostics
+	FlagVerbose = flag.Bool("v", false, "log the debug diagnostics")
+	// FlagVeryVerbose logs the per symbol diagnostics
+	FlagVeryVerbose = flag.Bool("vv", false, "log the debug and per symbol diagnostics")
+	// FlagLogFormat is the format of the log
+	FlagLogFormat = flag.String("log-format", LogText, "the format of the log written to stderr: text or json")
+)
+
+// SetupLogging sets the default logger from the logging flags
+func SetupLogging() {
+	level := slog.LevelInfo
+	switch {
+	case *FlagVeryVerbose:
+		level = LevelTrace
+	case *FlagVerbose:
+		level = slog.LevelDebug
+	}
+	options := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == LevelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	}
+	var handler slog.Handler
+	switch *FlagLogFormat {
+	case LogText:
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case LogJSON:
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		panic(fmt.Errorf("unknown log format %s", *FlagLogFormat))
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// Trace logs a per symbol diagnostic
+func Trace(msg string, args ...any) {
+	slog.Log(context.Background(), LevelTrace, msg, args...)
+}
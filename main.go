@@ -5,29 +5,32 @@
 package main
 
 import (
-	"compress/bzip2"
+	"bufio"
 	"flag"
 	"fmt"
-	"hash/fnv"
-	"io/ioutil"
+	"io"
+	"log/slog"
 	"math"
 	"math/rand"
 	"os"
-	"sort"
-	"strings"
+	"path/filepath"
+	"slices"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/fatih/color"
 	. "github.com/pointlander/matrix"
+	"github.com/pointlander/matrix/vector"
 )
 
 const (
-	// Batch is the batch size
-	Batch = 1
-	// Samples is the number of samples per batch
-	Samples = 256 / Batch
-	// Size is the size of the embedding
-	Size = 32
+	// Chunks is the number of parallel chunks the samples of each branch are split into
+	Chunks = 16
+	// ContextConcat concatenates the embeddings of the context
+	ContextConcat = "concat"
+	// ContextAverage averages the embeddings of the context weighted by their closeness
+	ContextAverage = "average"
 )
 
 // Random is a random variable
@@ -53,326 +56,1094 @@ func NewStatistics(inputs, outputs int) Set {
 	return statistics
 }
 
-// Sample samples from the statistics
-func (s Set) Sample(rng *rand.Rand, inputs, outputs int) []Matrix {
-	neurons := make([]Matrix, outputs)
+// Sample samples from the statistics into the neurons of the system, quantizing the weights with the sampling
+func (s Set) Sample(rng *rand.Rand, system *Sample, sampling Sampling) {
+	if sampling.Weights == WeightsTernary {
+		s.SampleTernary(rng, system, sampling)
+		return
+	}
+	neurons := system.Neurons
+	system.Support = nil
 	for j := range neurons {
-		neurons[j] = NewMatrix(0, inputs, 1)
-		for k := 0; k < inputs; k++ {
+		for k := range neurons[j].Data {
 			v := float32(rng.NormFloat64())*s[j][k].StdDev + s[j][k].Mean
-			if v > 0 {
-				v = 1
-			} else {
-				v = -1
-			}
-			neurons[j].Data = append(neurons[j].Data, v)
+			neurons[j].Data[k] = sampling.Quantize(rng, v)
 		}
 	}
-	return neurons
 }
 
 // Net is a net
 type Net struct {
 	window  int64
+	Samples int
 	Inputs  int
 	Outputs int
 	Rng     *rand.Rand
+	Rngs    [3][]*rand.Rand
+	Seed    int64
 	Q       Set
 	K       Set
 	V       Set
+	// Frozen is the inference only mode, the statistics of the sets are not recalculated and the thresholds,
+	// running normalization and decoder are not adapted, so the text the network scores leaves it as it was
+	Frozen bool
+	// Thresholds are the per dimension thresholds of the code
+	Thresholds []float32
+	// Balance is the target probability of each code bit being set, 0 disables balancing
+	Balance float32
+	// BalanceRate is the rate the thresholds adapt at
+	BalanceRate float32
+	// Normalize normalizes the outputs by the running mean and variance of each dimension
+	Normalize bool
+	// NormalizeRate is the rate the running mean and variance adapt at
+	NormalizeRate float32
+	// Means are the running means of the outputs
+	Means []float32
+	// Variances are the running variances of the outputs
+	Variances []float32
+	// Mapping is the mapping from codes to colors
+	Mapping string
+	// Projection is the learned projection of the projection mapping
+	Projection Projection
+	// Ablated are the components of the network that are disabled
+	Ablated Ablated
+	// Sampling is how the sampled weights are quantized
+	Sampling Sampling
+	// TopK is the number of lowest entropy systems the output is averaged over
+	TopK int
+	// TopKWeight is how the outputs of the top k systems are weighted
+	TopKWeight string
+	// Selection is how the samples of the window are weighted in the statistics update
+	Selection string
+	// Objective is the direction of the self entropy objective
+	Objective Objective
+	// Watch detects the convergence of the network and anomalous entropies for the events
+	Watch Watch
+	// Context is the number of previous symbols in the input of each symbol
+	Context int
+	// ContextMode is how the embeddings of the context are combined
+	ContextMode string
+	// Decoder decodes the outputs
+	Decoder Decoder
+	// Recurrence is the recurrent state fed back into the input
+	Recurrence Recurrence
+	// Layers are the layers stacked on top of the network, each takes the output of the layer below as input
+	Layers  []Net
+	input   Matrix
+	scratch *Scratch
+}
+
+// Ablated are the components of the network that can be disabled
+type Ablated struct {
+	// K uses the Q branch in place of the K branch
+	K bool
+	// V uses the Q branch in place of the V branch
+	V bool
+	// Binarize samples continuous weights instead of binary weights
+	Binarize bool
+	// Update doesn't update the statistics from the window of best samples
+	Update bool
+}
+
+// Branch is the reusable space of a Q, K, or V branch
+type Branch struct {
+	Outputs    Matrix
+	Systems    []Sample
+	Statistics Set
+}
+
+// Scratch is the reusable space of Fill and Fire
+type Scratch struct {
+	Wait      sync.WaitGroup
+	Branches  [3]Branch
+	Transpose []float32
+	Values    []float32
+	Counts    []float32
+	Entropies []float32
+	Results   []float32
+	Elite     Matrix
+	// Positional is where the positional encoding is mixed into an embedding
+	Positional []float32
+}
+
+// NewScratch allocates the reusable space of Fill and Fire
+func NewScratch(samples, inputs, outputs int) *Scratch {
+	s := &Scratch{
+		Transpose:  make([]float32, outputs*samples),
+		Values:     make([]float32, samples),
+		Counts:     make([]float32, outputs*inputs),
+		Entropies:  make([]float32, outputs),
+		Results:    make([]float32, samples),
+		Positional: make([]float32, inputs),
+	}
+	for i := range s.Branches {
+		branch := &s.Branches[i]
+		branch.Outputs = NewMatrix(0, outputs, samples)
+		branch.Outputs.Data = branch.Outputs.Data[:cap(branch.Outputs.Data)]
+		branch.Systems = make([]Sample, samples)
+		branch.Statistics = NewStatistics(inputs, outputs)
+		for j := range branch.Systems {
+			neurons := make([]Matrix, outputs)
+			for k := range neurons {
+				neurons[k] = NewMatrix(0, inputs, 1)
+				neurons[k].Data = neurons[k].Data[:cap(neurons[k].Data)]
+			}
+			out := NewMatrix(0, outputs, 1)
+			out.Data = out.Data[:cap(out.Data)]
+			branch.Systems[j] = Sample{
+				Neurons: neurons,
+				Outputs: out,
+			}
+		}
+	}
+	return s
+}
+
+// SelfEntropy computes SelfEntropy of Q, K, V in the scratch space
+func (s *Scratch) SelfEntropy(Q, K, V Matrix) []float32 {
+	transpose := s.Transpose[:0]
+	for i := 0; i < V.Cols; i++ {
+		for j := 0; j < V.Rows; j++ {
+			transpose = append(transpose, V.Data[j*V.Cols+i])
+		}
+	}
+	values, entropies, results := s.Values[:K.Rows], s.Entropies[:V.Cols], s.Results[:0]
+	for i := 0; i < K.Rows; i++ {
+		K := K.Data[i*K.Cols : (i+1)*K.Cols]
+		for j := 0; j < Q.Rows; j++ {
+			Q := Q.Data[j*Q.Cols : (j+1)*Q.Cols]
+			values[j] = vector.Dot(K, Q)
+		}
+		softmax(values)
+
+		for j := 0; j < V.Cols; j++ {
+			V := transpose[j*V.Rows : (j+1)*V.Rows]
+			entropies[j] = vector.Dot(values, V)
+		}
+		softmax(entropies)
+
+		entropy := 0.0
+		for _, e := range entropies {
+			entropy += float64(e) * math.Log(float64(e))
+		}
+		results = append(results, float32(-entropy))
+	}
+	return results
+}
+
+func softmax(values []float32) {
+	max := float32(0.0)
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	s := max * S
+	sum := float32(0.0)
+	for j, value := range values {
+		values[j] = float32(math.Exp(float64(value - s)))
+		sum += values[j]
+	}
+	for j, value := range values {
+		values[j] = value / sum
+	}
 }
 
 // NewNet makes a new network
-func NewNet(seed int64, window int64, inputs, outputs int) Net {
+func NewNet(seed int64, window int64, samples, inputs, outputs int) Net {
 	rng := rand.New(rand.NewSource(seed))
+	rngs := [3][]*rand.Rand{}
+	for i := range rngs {
+		for j := 0; j < Chunks; j++ {
+			rngs[i] = append(rngs[i], rand.New(rand.NewSource(rng.Int63())))
+		}
+	}
 	return Net{
 		window:  window,
+		Samples: samples,
 		Inputs:  inputs,
 		Outputs: outputs,
 		Rng:     rng,
+		Rngs:    rngs,
+		Seed:    seed,
 		Q:       NewStatistics(inputs, outputs),
 		K:       NewStatistics(inputs, outputs),
 		V:       NewStatistics(inputs, outputs),
+		scratch: NewScratch(samples, inputs, outputs),
 	}
 }
 
+// NewFlagNet makes a new network configured by the command line flags,
+// with outputs used when the outputs flag isn't set
+func NewFlagNet(outputs int) Net {
+	return NewSeededNet(*FlagSeed, outputs)
+}
+
+// NewSeededNet makes a new network configured by the command line flags with the seed instead of the seed flag,
+// the layers are seeded with the following seeds
+func NewSeededNet(seed int64, outputs int) Net {
+	if *FlagOutputs > 0 {
+		outputs = *FlagOutputs
+	}
+	inputs := Embed.Size()
+	if *FlagContextMode != ContextConcat && *FlagContextMode != ContextAverage {
+		panic(fmt.Errorf("unknown context mode %s", *FlagContextMode))
+	}
+	if *FlagContextMode == ContextConcat {
+		inputs *= *FlagContext + 1
+	}
+	if *FlagRecurrent {
+		inputs += outputs
+	}
+	net := NewNet(seed, *FlagWindow, *FlagSamples, inputs, outputs)
+	net.Context = *FlagContext
+	net.ContextMode = *FlagContextMode
+	net.Decoder = NewDecoder(*FlagDecoder)
+	net.Recurrence.Enabled = *FlagRecurrent
+	net.Recurrence.Boundary = *FlagBoundary
+	for i := 1; i < *FlagLayers; i++ {
+		net.Layers = append(net.Layers, NewNet(seed+int64(i), *FlagWindow, *FlagSamples, outputs, outputs))
+	}
+	net.Balance = float32(*FlagBalance)
+	net.BalanceRate = float32(*FlagBalanceRate)
+	net.Normalize = *FlagNormalize
+	net.NormalizeRate = float32(*FlagNormalizeRate)
+	net.Mapping = *FlagMapping
+	net.Projection.Rate = float32(*FlagMappingRate)
+	net.Sampling = NewFlagSampling()
+	net.TopK = *FlagTopK
+	net.TopKWeight = *FlagTopKWeight
+	net.Selection = *FlagSelection
+	net.Objective = Objective{Mode: *FlagObjective, Steps: *FlagAnneal}
+	return net
+}
+
 // Set window sets the window
 func (n *Net) SetWindow(window int64) {
 	atomic.StoreInt64(&n.window, window)
 }
 
+// Window is the window
+func (n *Net) Window() int64 {
+	return atomic.LoadInt64(&n.window)
+}
+
+// Rewind reseeds a frozen network with its seed and resets its recurrent state before it scores a text,
+// so scoring the same text again gives the same symbols
+func (n *Net) Rewind() {
+	if !n.Frozen {
+		return
+	}
+	n.Reseed(n.Seed)
+	n.Reset()
+}
+
 // Sample is a sample of a random neural network
 type Sample struct {
 	Entropy float32
 	Neurons []Matrix
+	// Support are the indices of the nonzero weights of each neuron with ternary weights, nil otherwise
+	Support [][]int
 	Outputs Matrix
 	Out     Matrix
 }
 
-// CalculateStatistics calculates the statistics of systems
-func (n Net) CalculateStatistics(systems []Sample) Set {
+// CalculateStatistics calculates the statistics of systems into statistics, the systems are sorted from the best entropy.
+// The statistics of ternary weights are calculated from the systems the weights aren't zero in, falling back to the previous statistics
+func (n Net) CalculateStatistics(systems []Sample, statistics, previous Set, maximize bool) Set {
 	window := atomic.LoadInt64(&n.window)
-	statistics := make(Set, n.Outputs)
 	for i := range statistics {
-		for j := 0; j < n.Inputs; j++ {
-			statistics[i] = append(statistics[i], Random{
+		for j := range statistics[i] {
+			statistics[i][j] = Random{
 				Mean:   0,
 				StdDev: 0,
-			})
+			}
+		}
+	}
+	weights, divisor := SelectionWeights(n.Selection, systems[:window], maximize), float32(window)
+	weight := func(i int) float32 {
+		if weights == nil {
+			return 1
 		}
+		return weights[i]
+	}
+	if weights != nil {
+		divisor = 1
+	}
+	if systems[0].Support != nil {
+		return n.SparseStatistics(systems[:window], statistics, previous, weight)
 	}
 	for i := range systems[:window] {
+		w := weight(i)
 		for j := range systems[i].Neurons {
 			for k, value := range systems[i].Neurons[j].Data {
-				statistics[j][k].Mean += value
+				statistics[j][k].Mean += w * value
 			}
 		}
 	}
 	for i := range statistics {
 		for j := range statistics[i] {
-			statistics[i][j].Mean /= float32(window)
+			statistics[i][j].Mean /= divisor
 		}
 	}
 	for i := range systems[:window] {
+		w := weight(i)
 		for j := range systems[i].Neurons {
 			for k, value := range systems[i].Neurons[j].Data {
 				diff := statistics[j][k].Mean - value
-				statistics[j][k].StdDev += diff * diff
+				statistics[j][k].StdDev += w * diff * diff
 			}
 		}
 	}
 	for i := range statistics {
 		for j := range statistics[i] {
-			statistics[i][j].StdDev /= float32(window)
+			statistics[i][j].StdDev /= divisor
 			statistics[i][j].StdDev = float32(math.Sqrt(float64(statistics[i][j].StdDev)))
 		}
 	}
 	return statistics
 }
 
-// Fire runs the network
-func (n *Net) Fire(input Matrix) Matrix {
-	q := NewMatrix(0, n.Outputs, Samples)
-	k := NewMatrix(0, n.Outputs, Samples)
-	v := NewMatrix(0, n.Outputs, Samples)
-	systemsQ := make([]Sample, 0, 8)
-	systemsK := make([]Sample, 0, 8)
-	systemsV := make([]Sample, 0, 8)
-	for i := 0; i < Samples; i++ {
-		neurons := n.Q.Sample(n.Rng, n.Inputs, n.Outputs)
-		outputs := NewMatrix(0, n.Outputs, 1)
-		for j := range neurons {
-			out := MulT(neurons[j], input)
-			q.Data = append(q.Data, out.Data[0])
-			outputs.Data = append(outputs.Data, out.Data[0])
-		}
-		systemsQ = append(systemsQ, Sample{
-			Neurons: neurons,
-			Outputs: outputs,
-		})
+// Task samples a chunk of the systems of a branch
+type Task struct {
+	Net    *Net
+	Set    Set
+	Rng    *rand.Rand
+	Input  Matrix
+	Branch *Branch
+	Begin  int
+	End    int
+}
+
+var (
+	// Tasks is the queue of tasks shared by the workers
+	Tasks = make(chan Task, 3*Chunks)
+	// workers starts the workers once
+	workers sync.Once
+)
+
+// Run runs the task, the output of a neuron is the mean of its outputs over the rows of the batch
+func (t Task) Run() {
+	in, cols, rows := t.Input.Data, t.Input.Cols, max(t.Input.Rows, 1)
+	outputs, sampling := t.Net.Outputs, t.Net.Sampling
+	if t.Net.Ablated.Binarize {
+		sampling.Weights = WeightsContinuous
 	}
-	for i := 0; i < Samples; i++ {
-		neurons := n.K.Sample(n.Rng, n.Inputs, n.Outputs)
-		outputs := NewMatrix(0, n.Outputs, 1)
-		for j := range neurons {
-			out := MulT(neurons[j], input)
-			k.Data = append(k.Data, out.Data[0])
-			outputs.Data = append(outputs.Data, out.Data[0])
-		}
-		systemsK = append(systemsK, Sample{
-			Neurons: neurons,
-			Outputs: outputs,
-		})
+	for i := t.Begin; i < t.End; i++ {
+		system := &t.Branch.Systems[i]
+		t.Set.Sample(t.Rng, system, sampling)
+		for j, neuron := range system.Neurons {
+			out := float32(0)
+			for r := 0; r < rows; r++ {
+				row := in[r*cols : (r+1)*cols]
+				if system.Support == nil {
+					out += vector.Dot(neuron.Data, row)
+					continue
+				}
+				for _, k := range system.Support[j] {
+					out += neuron.Data[k] * row[k]
+				}
+			}
+			out /= float32(rows)
+			system.Outputs.Data[j] = out
+			t.Branch.Outputs.Data[i*outputs+j] = out
+		}
 	}
-	for i := 0; i < Samples; i++ {
-		neurons := n.V.Sample(n.Rng, n.Inputs, n.Outputs)
-		outputs := NewMatrix(0, n.Outputs, 1)
-		for j := range neurons {
-			out := MulT(neurons[j], input)
-			v.Data = append(v.Data, out.Data[0])
-			outputs.Data = append(outputs.Data, out.Data[0])
-		}
-		systemsV = append(systemsV, Sample{
-			Neurons: neurons,
-			Outputs: outputs,
-		})
+	t.Net.scratch.Wait.Done()
+}
+
+// Fire runs the stack of layers of the network returning the output and entropy of the best system
+// of the last layer, the output is only valid until the next call to Fire
+func (n *Net) Fire(input Matrix) (Matrix, float32) {
+	if Monitor == nil {
+		return n.FireCross(input, input)
+	}
+	start := time.Now()
+	out, entropy := n.FireCross(input, input)
+	Monitor.Fire(n, entropy, time.Since(start))
+	return out, entropy
+}
+
+// FireCross runs the stack of layers with the first layer attending from the query input to the memory input,
+// the layers above attend to themselves
+func (n *Net) FireCross(query, memory Matrix) (Matrix, float32) {
+	out, entropy := n.attend(query, memory)
+	for i := range n.Layers {
+		layer := &n.Layers[i]
+		layer.Frozen, layer.Ablated, layer.Sampling = n.Frozen, n.Ablated, n.Sampling
+		layer.TopK, layer.TopKWeight, layer.Selection = n.TopK, n.TopKWeight, n.Selection
+		layer.Objective.Mode, layer.Objective.Steps = n.Objective.Mode, n.Objective.Steps
+		out, entropy = layer.fire(layer.Normalized(out))
+	}
+	n.Feedback(out)
+	return out, entropy
+}
+
+// Normalized copies the output of the layer below normalized to unit length, like the embeddings, into the input of the layer
+func (n *Net) Normalized(out Matrix) Matrix {
+	if len(n.input.Data) != len(out.Data) {
+		n.input = NewMatrix(0, out.Cols, out.Rows)
+		n.input.Data = n.input.Data[:cap(n.input.Data)]
+	}
+	sum := float32(0)
+	for _, v := range out.Data {
+		sum += v * v
+	}
+	length := float32(math.Sqrt(float64(sum)))
+	for i, v := range out.Data {
+		if length > 0 {
+			v /= length
+		}
+		n.input.Data[i] = v
+	}
+	return n.input
+}
+
+// fire runs a layer of the network returning the output and entropy of the best system
+func (n *Net) fire(input Matrix) (Matrix, float32) {
+	return n.attend(input, input)
+}
+
+// sample samples the systems of the branches on the workers of the tasks, the queries from the query input
+// and the keys and values from the memory input
+func (n *Net) sample(tasks chan<- Task, query, memory Matrix) {
+	scratch := n.scratch
+	for i, set := range [...]Set{n.Q, n.K, n.V} {
+		rngs, input := n.Rngs[i], memory
+		if i == 0 {
+			input = query
+		}
+		chunk := (n.Samples + len(rngs) - 1) / len(rngs)
+		scratch.Wait.Add(len(rngs))
+		for j, rng := range rngs {
+			begin, end := j*chunk, (j+1)*chunk
+			if end > n.Samples {
+				end = n.Samples
+			}
+			tasks <- Task{
+				Net:    n,
+				Set:    set,
+				Rng:    rng,
+				Input:  input,
+				Branch: &scratch.Branches[i],
+				Begin:  begin,
+				End:    end,
+			}
+		}
 	}
-	entropies := SelfEntropy(q, k, v)
+	scratch.Wait.Wait()
+}
+
+// attend fires one layer of the network with the queries sampled from the query input and the keys and values
+// sampled from the memory input
+func (n *Net) attend(query, memory Matrix) (Matrix, float32) {
+	StartWorkers()
+	n.sample(Tasks, query, memory)
+	scratch := n.scratch
+	q, k, v := &scratch.Branches[0], &scratch.Branches[1], &scratch.Branches[2]
+	K, V := k.Outputs, v.Outputs
+	if n.Ablated.K {
+		K = q.Outputs
+	}
+	if n.Ablated.V {
+		V = q.Outputs
+	}
+	entropies := scratch.SelfEntropy(q.Outputs, K, V)
 	for i, entropy := range entropies {
-		systemsQ[i].Entropy = entropy
-		systemsK[i].Entropy = entropy
-		systemsV[i].Entropy = entropy
+		q.Systems[i].Entropy = entropy
+		k.Systems[i].Entropy = entropy
+		v.Systems[i].Entropy = entropy
 	}
-	sort.Slice(systemsQ, func(i, j int) bool {
-		return systemsQ[i].Entropy < systemsQ[j].Entropy
-	})
-	sort.Slice(systemsK, func(i, j int) bool {
-		return systemsK[i].Entropy < systemsK[j].Entropy
-	})
-	sort.Slice(systemsV, func(i, j int) bool {
-		return systemsV[i].Entropy < systemsV[j].Entropy
-	})
+	order, maximize := compare, n.Maximize()
+	if maximize {
+		order = descending
+	}
+	slices.SortFunc(q.Systems, order)
+	slices.SortFunc(k.Systems, order)
+	slices.SortFunc(v.Systems, order)
+
+	if n.Frozen || n.Ablated.Update {
+		return n.Elite(v.Systems, maximize)
+	}
+	n.Q, q.Statistics = n.CalculateStatistics(q.Systems, q.Statistics, n.Q, maximize), n.Q
+	n.K, k.Statistics = n.CalculateStatistics(k.Systems, k.Statistics, n.K, maximize), n.K
+	n.V, v.Statistics = n.CalculateStatistics(v.Systems, v.Statistics, n.V, maximize), n.V
+	return n.Elite(v.Systems, maximize)
+}
+
+// compare orders samples by ascending entropy
+func compare(a, b Sample) int {
+	if a.Entropy < b.Entropy {
+		return -1
+	} else if a.Entropy > b.Entropy {
+		return 1
+	}
+	return 0
+}
+
+// Colors maps codes to colors
+var Colors = NewColors(PaletteBasic)
+
+// Symbol is a colored symbol
+type Symbol struct {
+	Position int     `json:"position"`
+	Symbol   byte    `json:"symbol"`
+	Code     int     `json:"code"`
+	Entropy  float32 `json:"entropy"`
+	Rune     rune    `json:"rune,omitempty"`
+	Head     int     `json:"head"`
+	Token    string  `json:"token,omitempty"`
+	Label    int     `json:"label"`
+	Meta     Meta    `json:"meta,omitempty"`
+	// Offset is the byte of the file the symbol begins at, the position counts the symbols of the range of the file
+	Offset int `json:"offset"`
+	// Outputs are the output values of the network, only kept when exporting
+	Outputs []float32 `json:"outputs,omitempty"`
+}
+
+// Head is the output dimension with the largest activation
+func Head(out Matrix) int {
+	head := 0
+	for i, v := range out.Data {
+		if v > out.Data[head] {
+			head = i
+		}
+	}
+	return head
+}
+
+// String is the printable character of the symbol
+func (s Symbol) String() string {
+	if s.Token != "" {
+		return s.Token
+	}
+	if s.Rune != 0 {
+		return string(s.Rune)
+	}
+	return string(rune(s.Symbol))
+}
+
+// NewInput makes a new input matrix for the network with the batch size flag
+func NewInput(net *Net) Matrix {
+	in := NewMatrix(0, net.Inputs, *FlagBatch)
+	in.Data = in.Data[:cap(in.Data)]
+	return in
+}
+
+// Fill fills a row of the input with the embedding of the symbol at position and, with context,
+// the embeddings of the symbols before it, followed by the recurrent state when recurrent.
+// embed returns nil for positions before the start of the corpus. The positional encoding is mixed into the embeddings
+func (n *Net) Fill(row []float32, position int, embed func(position int) []float32) {
+	if n.Recurrence.Enabled {
+		state := row[len(row)-n.Outputs:]
+		for i := range state {
+			state[i] = 0
+		}
+		copy(state, n.Recurrence.State)
+		row = row[:len(row)-n.Outputs]
+	}
+	if n.Context == 0 {
+		copy(row, n.Positioned(embed(position), position))
+		return
+	}
+	if n.ContextMode == ContextAverage {
+		for i := range row {
+			row[i] = 0
+		}
+		total := float32(0)
+		for k := 0; k <= n.Context; k++ {
+			embedding := n.Positioned(embed(position-k), position-k)
+			if embedding == nil {
+				continue
+			}
+			weight := 1 / float32(k+1)
+			total += weight
+			for i, v := range embedding {
+				row[i] += weight * v
+			}
+		}
+		if total == 0 {
+			return
+		}
+		for i := range row {
+			row[i] /= total
+		}
+		return
+	}
+	size := len(row) / (n.Context + 1)
+	for k := 0; k <= n.Context; k++ {
+		part := row[k*size : (k+1)*size]
+		embedding := n.Positioned(embed(position-k), position-k)
+		if embedding == nil {
+			for i := range part {
+				part[i] = 0
+			}
+			continue
+		}
+		copy(part, embedding)
+	}
+}
+
+// Input fills the input with the embeddings of the batch of symbols at position
+func (n *Net) Input(in Matrix, data []byte, position int) {
+	embed := func(position int) []float32 {
+		if position < 0 {
+			return nil
+		}
+		return Embed.Embed(data, position%len(data))
+	}
+	for i := 0; i < in.Rows; i++ {
+		n.Fill(in.Data[i*in.Cols:(i+1)*in.Cols], position+i, embed)
+	}
+}
+
+// Code computes the code of the output by thresholding each of its values,
+// normalizing the values when normalizing and adapting the thresholds towards the balance target when balancing
+func (n *Net) Code(out Matrix) int {
+	if n.Balance > 0 && len(n.Thresholds) < len(out.Data) {
+		n.Thresholds = append(n.Thresholds, make([]float32, len(out.Data)-len(n.Thresholds))...)
+	}
+	if n.Normalize {
+		for len(n.Means) < len(out.Data) {
+			n.Means = append(n.Means, 0)
+			n.Variances = append(n.Variances, 1)
+		}
+	}
+	c := 0
+	for i, v := range out.Data {
+		if n.Normalize {
+			if !n.Frozen {
+				diff := v - n.Means[i]
+				n.Means[i] += n.NormalizeRate * diff
+				n.Variances[i] += n.NormalizeRate * (diff*diff - n.Variances[i])
+			}
+			v = (v - n.Means[i]) / float32(math.Sqrt(float64(n.Variances[i])+1e-8))
+		}
+		threshold := float32(0)
+		if i < len(n.Thresholds) {
+			threshold = n.Thresholds[i]
+		}
+		set := v > threshold
+		if set {
+			c |= 1 << i
+		}
+		if n.Balance > 0 && !n.Frozen {
+			if set {
+				n.Thresholds[i] += n.BalanceRate * (1 - n.Balance)
+			} else {
+				n.Thresholds[i] -= n.BalanceRate * n.Balance
+			}
+		}
+	}
+	return c
+}
 
-	n.Q = n.CalculateStatistics(systemsQ)
-	n.K = n.CalculateStatistics(systemsK)
-	n.V = n.CalculateStatistics(systemsV)
-	return systemsV[0].Outputs
+// Colorize colors length symbols, embedded by embed, starting at position until done is closed, returning the final position
+func Colorize(net *Net, length int, embed func(position int) []float32, position int, done <-chan struct{}, fn func(symbol Symbol)) int {
+	net.Rewind()
+	in := NewInput(net)
+	context := func(position int) []float32 {
+		if position < 0 {
+			return nil
+		}
+		return embed(position % length)
+	}
+	for position < length {
+		select {
+		case <-done:
+			return position
+		default:
+		}
+		for i := 0; i < in.Rows; i++ {
+			net.Fill(in.Data[i*in.Cols:(i+1)*in.Cols], position+i, context)
+		}
+		out, entropy := net.Fire(in)
+		decoded := net.Decode(out)
+		symbol := Symbol{
+			Position: position,
+			Offset:   position,
+			Code:     decoded.Color,
+			Label:    decoded.Label,
+			Entropy:  entropy,
+			Head:     Head(out),
+		}
+		if *FlagExport != "" {
+			symbol.Outputs = append([]float32{}, out.Data...)
+		}
+		fn(symbol)
+		net.Step(symbol)
+		position++
+	}
+	return position
+}
+
+// Color colors the data starting at position until done is closed, returning the final position
+func Color(net *Net, data []byte, position int, done <-chan struct{}, fn func(symbol Symbol)) int {
+	return Colorize(net, len(data), func(position int) []float32 {
+		return Embed.Embed(data, position)
+	}, position, done, func(symbol Symbol) {
+		symbol.Symbol = data[symbol.Position]
+		fn(symbol)
+		net.Observe(ByteText[symbol.Symbol])
+	})
 }
 
 var (
 	// FlagFile is the file to process
-	FlagFile = flag.String("f", "10.txt.utf-8.bz2", "the file to process")
-	// FlagWander is wandering mode
-	FlagWander = flag.Bool("w", false, "wander mode")
+	FlagFile = flag.String("f", "10.txt.utf-8.bz2", "the file or http(s) url to process, - or empty for stdin")
+	// FlagSeed is the seed of the network, 0 is time based
+	FlagSeed = flag.Int64("seed", 2, "seed of the network, 0 for a time based seed")
+	// FlagSize is the size of the embedding
+	FlagSize = flag.Int("size", 32, "size of the embedding")
+	// FlagSamples is the number of samples per branch
+	FlagSamples = flag.Int("samples", 256, "number of samples per branch")
+	// FlagContext is the number of previous symbols in the input of each symbol
+	FlagContext = flag.Int("context", 0, "number of previous symbols in the input of each symbol")
+	// FlagContextMode is how the embeddings of the context are combined
+	FlagContextMode = flag.String("context-mode", ContextConcat, "how the embeddings of the context are combined: concat or average")
+	// FlagLayers is the number of stacked layers
+	FlagLayers = flag.Int("layers", 1, "number of stacked layers, each takes the output of the layer below as input")
+	// FlagBatch is the number of symbols per input
+	FlagBatch = flag.Int("batch", 1, "number of symbols per input")
+	// FlagWindow is the number of best samples the statistics are calculated from
+	FlagWindow = flag.Int64("window", 8, "number of best samples the statistics are calculated from")
+	// FlagBalance is the target probability of each code bit being set
+	FlagBalance = flag.Float64("balance", 0, "target probability of each code bit being set, 0 disables balancing")
+	// FlagBalanceRate is the rate the balancing thresholds adapt at
+	FlagBalanceRate = flag.Float64("balance-rate", .01, "rate the balancing thresholds adapt at")
+	// FlagNormalize normalizes the outputs by their running mean and variance
+	FlagNormalize = flag.Bool("normalize", false, "normalize the outputs by their running mean and variance before thresholding")
+	// FlagNormalizeRate is the rate the running mean and variance adapt at
+	FlagNormalizeRate = flag.Float64("normalize-rate", .01, "rate the running mean and variance adapt at")
+	// FlagOutputs is the number of outputs and code bits, defaults to 3 for color and 16 for wander
+	FlagOutputs = flag.Int("outputs", 0, "number of outputs, which are the bits of the code, 3 for color and 16 for wander when 0, codes up to 8 bits are colored distinctly")
 )
 
-func main() {
-	flag.Parse()
+// FlushInterval is the longest the buffered output is held before it is flushed
+const FlushInterval = 100 * time.Millisecond
 
-	color.Blue("Hello World!")
+// Output is the buffered output of a command to stdout or a file, recorded when the record flag is set.
+// The buffer is flushed when it is full or the last flush is older than the flush interval
+type Output struct {
+	Buffer   *bufio.Writer
+	File     *os.File
+	Recorder *Recorder
+	writer   io.Writer
+	flushed  time.Time
+}
 
-	data := []byte{}
-	if strings.HasSuffix(*FlagFile, ".bz2") {
-		input, err := os.Open(*FlagFile)
+// NewOutput makes a new output to the file, stdout when the file is empty
+func NewOutput(file string) *Output {
+	output := &Output{flushed: time.Now()}
+	var w io.Writer = os.Stdout
+	if file != "" {
+		f, err := os.Create(file)
 		if err != nil {
 			panic(err)
 		}
-		defer input.Close()
-		reader := bzip2.NewReader(input)
-		d, err := ioutil.ReadAll(reader)
+		output.File, w = f, f
+	}
+	output.Buffer = bufio.NewWriterSize(w, 1<<16)
+	output.writer = output.Buffer
+	if *FlagRecord != "" {
+		color.NoColor = false
+		recorder, err := NewRecorder(*FlagRecord)
 		if err != nil {
 			panic(err)
 		}
-		fmt.Println(len(d))
-		runes := []rune(string(d))
-		count := 0
-		for _, v := range runes {
-			if v < 256 {
-				data = append(data, byte(v))
-			} else {
-				count++
-			}
+		output.Recorder = recorder
+		output.writer = io.MultiWriter(output.Buffer, recorder)
+	}
+	return output
+}
+
+// Write writes to the buffer, flushing it if the last flush is older than the flush interval
+func (o *Output) Write(p []byte) (int, error) {
+	n, err := o.writer.Write(p)
+	if err == nil && time.Since(o.flushed) >= FlushInterval {
+		err = o.Flush()
+	}
+	return n, err
+}
+
+// Flush flushes the buffer
+func (o *Output) Flush() error {
+	o.flushed = time.Now()
+	return o.Buffer.Flush()
+}
+
+// Close flushes the output and closes the file and the recording
+func (o *Output) Close() error {
+	if err := o.Flush(); err != nil {
+		return err
+	}
+	if o.File != nil {
+		if err := o.File.Close(); err != nil {
+			return err
 		}
-		fmt.Println("unicode", count)
-	} else {
-		input, err := os.Open(*FlagFile)
-		if err != nil {
-			panic(err)
+	}
+	if o.Recorder != nil {
+		return o.Recorder.Close()
+	}
+	return nil
+}
+
+// ColorCommand colors the corpus
+func ColorCommand(args []string) {
+	flags := flag.NewFlagSet("color", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file, directory or glob to process")
+	format := flags.String("format", FormatTerminal, "the output format: terminal or html, a standalone page with a tooltip for each symbol")
+	out := OutputFlag(flags, "o", "", "the file the output is written to, stdout when empty")
+	report := flags.Bool("summary", false, "print how often each code fired, its mean entropy and its most frequent symbols after the corpus")
+	csv := OutputFlag(flags, "summary-csv", "", "the csv file the summary of the codes is written to")
+	flags.Parse(args)
+
+	if *FlagTUI {
+		TUI(Files(*file))
+		return
+	}
+	output := NewOutput(*out)
+	defer output.Close()
+	var page *Page
+	switch *format {
+	case FormatTerminal:
+		color.Blue("Hello World!")
+	case FormatHTML:
+		page = NewPage(output, filepath.Base(*file), PageColors(*FlagColoring))
+		defer page.Close()
+	default:
+		panic(fmt.Errorf("unknown format %s", *format))
+	}
+	exporter := NewFlagExporter()
+	if exporter != nil {
+		defer exporter.Close()
+	}
+	files := Files(*file)
+	progress, consumed := NewFlagProgress(CorpusSize(files)), 0
+	done := Interrupted()
+	net := NewFlagNet(3)
+	count, entropy, codes := 0, 0.0, [len(Colors)]int{}
+	colors, thermometer := Colors[:], Thermometer{}
+	switch *FlagColoring {
+	case ColoringCode:
+	case ColoringEntropy:
+		gradient := NewGradient(*FlagPalette)
+		colors = gradient[:]
+	default:
+		panic(fmt.Errorf("unknown coloring %s", *FlagColoring))
+	}
+	graphemes := Graphemes{
+		Emit: func(cluster string, code int) {
+			fmt.Fprint(output, colors[code](cluster))
+		},
+	}
+	// the symbols of the pending grapheme clusters of the page, the first is symbol base
+	symbols, classes, base := []Symbol{}, []int{}, 0
+	if page != nil {
+		graphemes.Emit = func(cluster string, index int) {
+			i := index - base
+			page.Write(cluster, symbols[i], classes[i])
+			symbols, classes, base = symbols[i+1:], classes[i+1:], index+1
 		}
-		defer input.Close()
-		d, err := ioutil.ReadAll(input)
-		if err != nil {
-			panic(err)
+	}
+	var summary *CodeSummary
+	if *report || *csv != "" {
+		summary = NewCodeSummary()
+	}
+	show := func(symbol Symbol) {
+		if exporter != nil {
+			exporter.Write(symbol)
 		}
-		data = d
-	}
-
-	if *FlagWander {
-		net := NewNet(2, 8, Size, 16)
-		in := NewMatrix(0, Size, Batch)
-		in.Data = in.Data[:cap(in.Data)]
-		position, length := 0, len(data)
-		seen := make(map[int]bool, 8)
-		h := fnv.New32()
-		for len(seen) != length {
-			for i := 0; i < Batch; i++ {
-				h.Reset()
-				h.Write(data[position+i : position+i+1])
-				rng := rand.New(rand.NewSource(int64(h.Sum32())))
-				embedding := [256]float32{}
-				sum := 0.0
-				for i := range embedding {
-					v := rng.NormFloat64()
-					sum += v * v
-					embedding[i] = float32(v)
-				}
-				length := float32(math.Sqrt(sum))
-				for i, v := range embedding {
-					embedding[i] = v / length
+		if summary != nil {
+			summary.Add(symbol)
+		}
+		code := symbol.Code
+		if *FlagColoring == ColoringEntropy {
+			code = thermometer.Level(symbol.Entropy)
+		}
+		switch {
+		case page != nil && *FlagGraphemes:
+			symbols, classes = append(symbols, symbol), append(classes, code)
+			graphemes.Write(SymbolBytes(symbol), base+len(symbols)-1)
+		case page != nil:
+			page.Write(symbol.String(), symbol, code)
+		case *FlagGraphemes:
+			graphemes.Write(SymbolBytes(symbol), code)
+		default:
+			fmt.Fprint(output, colors[code](symbol.String()))
+		}
+		count++
+		entropy += float64(symbol.Entropy)
+		codes[symbol.Code]++
+		if progress != nil {
+			consumed += len(SymbolBytes(symbol))
+			progress.Update(count, consumed)
+		}
+	}
+	defer func() {
+		Metric("symbols", float64(count))
+		if count > 0 {
+			Metric("entropy", entropy/float64(count))
+			bits := 0.0
+			for _, c := range codes {
+				if c > 0 {
+					p := float64(c) / float64(count)
+					bits -= p * math.Log2(p)
 				}
-				copy(in.Data[i*Size:(i+1)*Size], embedding[:])
 			}
-			out := net.Fire(in)
-			c := 0
-			for i, v := range out.Data {
-				if v > 0 {
-					c |= 1 << i
+			Metric("code_entropy", bits)
+		}
+	}()
+	start, offset := Resume(&net), 0
+	if *FlagResume && *FlagEnsemble > 1 {
+		panic(fmt.Errorf("resume isn't supported with an ensemble"))
+	}
+	ensemble := NewFlagEnsemble(net, 3)
+	for _, name := range files {
+		header := len(files) > 1
+		ensemble.Reset()
+		tokenizer := func() Tokenizer {
+			return NewTokenizer(name)
+		}
+		position := ensemble.ColorTokens(tokenizer, max(start-offset, 0), done, func(symbol Symbol) {
+			if header {
+				if page != nil {
+					page.Heading(name)
+				} else {
+					fmt.Fprintf(output, "\n==> %s <==\n", name)
 				}
+				header = false
 			}
-			seen[position] = true
-			if len(seen) == length {
-				break
-			}
-			position = c % length
-			if seen[position] {
-				break
-			}
-			for seen[position] {
-				position = (position + 1) % length
-			}
-			fmt.Println(position, string(data[position]))
+			show(symbol)
+		})
+		graphemes.Flush()
+		select {
+		case <-done:
+			output.Flush()
+			Interrupt(&ensemble.Nets[0], offset+position)
+			return
+		default:
 		}
-		return
+		offset += position
+	}
+	if *report && page == nil {
+		summary.Write(output, Colors[:])
 	}
+	if *csv != "" {
+		summary.WriteCSV(*csv)
+	}
+}
 
-	test := func(iterations int) {
-		net := NewNet(2, 8, Size, 3)
-		in := NewMatrix(0, Size, Batch)
-		in.Data = in.Data[:cap(in.Data)]
-		position := 0
-		h := fnv.New32()
-		for position < iterations {
-			for i := 0; i < Batch; i++ {
-				h.Reset()
-				h.Write(data[position+i : position+i+1])
-				rng := rand.New(rand.NewSource(int64(h.Sum32())))
-				embedding := [256]float32{}
-				sum := 0.0
-				for i := range embedding {
-					v := rng.NormFloat64()
-					sum += v * v
-					embedding[i] = float32(v)
-				}
-				length := float32(math.Sqrt(sum))
-				for i, v := range embedding {
-					embedding[i] = v / length
-				}
-				copy(in.Data[i*Size:(i+1)*Size], embedding[:])
-			}
-			out := net.Fire(in)
-			c := 0
-			if out.Data[0] > 0 {
-				c |= 1
-			}
-			if out.Data[1] > 0 {
-				c |= 2
-			}
-			if out.Data[2] > 0 {
-				c |= 4
+// Command is a subcommand of testament
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(args []string)
+}
+
+// Commands are the subcommands of testament, the first is the default
+var Commands []Command
+
+// ExitStatus is the status the process exits with once the command has finished and cleaned up,
+// the commands whose checks fail set it
+var ExitStatus int
+
+func init() {
+	Commands = []Command{
+		{"color", "color the corpus by the output codes of the network", ColorCommand},
+		{"wander", "wander the corpus following the output codes of the network", WanderCommand},
+		{"stats", "print statistics of the corpus", StatsCommand},
+		{"generate", "generate symbols from the output codes of the network", GenerateCommand},
+		{"train", "train a model over epochs of the corpus", Train},
+		{"serve", "serve the job api and web ui", ServeCommand},
+		{"demo", "broadcast the coloring of the corpus to browsers", DemoCommand},
+		{"play", "play back a recorded session", PlayCommand},
+		{"xcompare", "compare two corpora under one frozen model", XCompare},
+		{"compare", "train a network on each of two texts and score each under the network of the other", CompareCommand},
+		{"identify", "identify the language or author of the corpus by the model of lowest entropy", IdentifyCommand},
+		{"cross", "color a document by how surprising it is in the context of a second document", Cross},
+		{"diff", "color the corpus by the entropy difference of two models", Diff},
+		{"rank", "rank the documents of a directory by how anomalous they are", Rank},
+		{"anomaly", "report the spans of the corpus with the highest entropy in context", AnomalyCommand},
+		{"summarize", "print the most or least surprising sentences of the corpus as an extractive summary", Summarize},
+		{"chunk", "split the corpus into content defined chunks", ChunkCorpus},
+		{"hilbert", "lay the corpus out along a hilbert curve into an image", HilbertMap},
+		{"render", "lay the colored corpus out as a png or svg image with a pixel or glyph per symbol", RenderCommand},
+		{"html", "write a self contained interactive html report of the corpus", HTMLReport},
+		{"report", "render a dashboard comparing the recorded runs of a directory", ReportCommand},
+		{"bpe", "train a byte pair encoding vocabulary", BPECommand},
+		{"seeds", "report how much the results depend on the seed", SeedsCommand},
+		{"ablate", "disable one component at a time and tabulate the change in the metrics", AblateCommand},
+		{"noise", "measure how much corruption of the corpus changes the codes and entropies", NoiseCommand},
+		{"eval", "score how well the output codes predict the next symbol", Eval},
+		{"synth", "generate a corpus with known structure and check the network discovers it", SynthCommand},
+		{"probe", "report which input dimensions and bytes most influence the sign of each output neuron of a model", ProbeCommand},
+		{"autocorrelation", "report the dominant periodicities of the entropy from its autocorrelation and spectral density", AutocorrelationCommand},
+		{"changepoints", "detect the structural breaks of the entropy or code series", ChangepointCommand},
+		{"segment", "infer the boundaries of sentences, verses and sections from spikes of the entropy or changes of the codes", SegmentCommand},
+		{"counterfactual", "report how substituting the symbols at positions changes the codes and entropies", CounterfactualCommand},
+		{"vectors", "export the byte embeddings and the mean vectors of the statistics as word2vec text or npy", VectorsCommand},
+		{"card", "write a markdown or html model card of a trained model", CardCommand},
+		{"repl", "color the lines typed by the user with a network that keeps its state between them", ReplCommand},
+		{"soak", "loop over the corpus for a duration checking the network stays stable", Soak},
+	}
+	flag.Usage = func() {
+		output := flag.CommandLine.Output()
+		fmt.Fprintf(output, "usage: %s [flags] [command] [command flags]\n\ncommands:\n", os.Args[0])
+		for _, command := range Commands {
+			fmt.Fprintf(output, "  %-10s %s\n", command.Name, command.Usage)
+		}
+		fmt.Fprintf(output, "\nflags:\n")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+	args := Configure()
+	SetupLogging()
+
+	if *FlagSeed == 0 {
+		*FlagSeed = time.Now().UnixNano()
+	}
+	slog.Info("seed", "seed", *FlagSeed)
+	if *FlagEmbeddings != "" {
+		pretrained, size, err := LoadPretrained(*FlagEmbeddings)
+		if err != nil {
+			panic(err)
+		}
+		Pretrained, *FlagSize = pretrained, size
+		slog.Info("embeddings", "vectors", len(pretrained), "size", size)
+	}
+	SetupEmbeddings(*FlagEmbed)
+	if *FlagPalette != PaletteBasic {
+		Colors = NewColors(*FlagPalette)
+	}
+	if *FlagWindow > int64(*FlagSamples) {
+		panic(fmt.Errorf("window %d is larger than samples %d", *FlagWindow, *FlagSamples))
+	}
+
+	if len(args) == 0 {
+		args = []string{Commands[0].Name}
+	}
+	for _, command := range Commands {
+		if command.Name == args[0] {
+			if StartRun(args) {
+				return
 			}
-			symbol := ""
-			switch c {
-			case 0:
-				symbol = color.BlackString(string(data[position]))
-			case 1:
-				symbol = color.BlueString(string(data[position]))
-			case 2:
-				symbol = color.RedString(string(data[position]))
-			case 3:
-				symbol = color.GreenString(string(data[position]))
-			case 4:
-				symbol = color.CyanString(string(data[position]))
-			case 5:
-				symbol = color.YellowString(string(data[position]))
-			case 6:
-				symbol = color.MagentaString(string(data[position]))
-			case 7:
-				symbol = color.HiMagentaString(string(data[position]))
+			stopProfiles, stop, stopMetrics := StartProfiles(), StartEvents(), StartMetrics()
+			command.Run(args[1:])
+			stopMetrics()
+			stop()
+			stopProfiles()
+			FinishRun()
+			if ExitStatus != 0 {
+				os.Exit(ExitStatus)
 			}
-			fmt.Printf(symbol)
-			position++
+			return
 		}
 	}
-
-	test(len(data))
+	fmt.Fprintf(os.Stderr, "unknown command %s\n", args[0])
+	flag.Usage()
+	os.Exit(2)
 }
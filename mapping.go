@@ -0,0 +1,97 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+
+	. "github.com/pointlander/matrix"
+)
+
+const (
+	// MappingBinary maps the code directly to a color
+	MappingBinary = "binary"
+	// MappingGray orders the colors so that adjacent colors are codes that differ by one bit
+	MappingGray = "gray"
+	// MappingProjection maps a learned 1-D projection of the output to a color
+	MappingProjection = "projection"
+)
+
+var (
+	// FlagMapping is the mapping from codes to colors
+	FlagMapping = flag.String("mapping", MappingBinary, "mapping from codes to colors: binary, gray or projection")
+	// FlagMappingRate is the rate the projection adapts at
+	FlagMappingRate = flag.Float64("mapping-rate", .01, "rate the projection mapping adapts at")
+)
+
+// Projection is a learned 1-D projection of the output vectors
+type Projection struct {
+	Rate     float32
+	Weights  []float32
+	Means    []float32
+	Mean     float32
+	Variance float32
+}
+
+// GrayInverse computes the index of a gray code
+func GrayInverse(code int) int {
+	index := code
+	for shift := code >> 1; shift != 0; shift >>= 1 {
+		index ^= shift
+	}
+	return index
+}
+
+// Project projects the output onto the first principal component, learned with oja's rule,
+// and returns the quantile of the projection
+func (p *Projection) Project(out []float32, learn bool) float64 {
+	if len(p.Weights) < len(out) {
+		p.Weights = make([]float32, len(out))
+		p.Means = make([]float32, len(out))
+		for i := range p.Weights {
+			p.Weights[i] = float32(1 / math.Sqrt(float64(len(out))))
+		}
+		p.Variance = 1
+	}
+	y := float32(0)
+	for i, v := range out {
+		y += p.Weights[i] * (v - p.Means[i])
+	}
+	if learn {
+		norm := float32(0)
+		for i, v := range out {
+			x := v - p.Means[i]
+			p.Weights[i] += p.Rate * y * (x - y*p.Weights[i])
+			norm += p.Weights[i] * p.Weights[i]
+			p.Means[i] += p.Rate * (v - p.Means[i])
+		}
+		norm = float32(math.Sqrt(float64(norm)))
+		if norm > 0 {
+			for i := range p.Weights {
+				p.Weights[i] /= norm
+			}
+		}
+		diff := y - p.Mean
+		p.Mean += p.Rate * diff
+		p.Variance += p.Rate * (diff*diff - p.Variance)
+	}
+	z := float64(y-p.Mean) / math.Sqrt(float64(p.Variance)+1e-8)
+	return .5 * (1 + math.Erf(z/math.Sqrt2))
+}
+
+// Map maps the output and its code to one of count colors
+func (n *Net) Map(out Matrix, code, count int) int {
+	switch n.Mapping {
+	case MappingGray:
+		return GrayInverse(code) % count
+	case MappingProjection:
+		return min(int(n.Projection.Project(out.Data, !n.Frozen)*float64(count)), count-1)
+	case MappingBinary, "":
+		return code % count
+	}
+	panic(fmt.Errorf("unknown mapping %s", n.Mapping))
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Meta is the metadata of a position of the corpus
+type Meta map[string]string
+
+// String formats the metadata as sorted key=value pairs
+func (m Meta) String() string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + m[key]
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Pattern is a metadata value matched on the lines of the corpus
+type Pattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// Patterns are metadata patterns set by the meta flag
+type Patterns []Pattern
+
+// String is the patterns as flags
+func (p *Patterns) String() string {
+	values := []string{}
+	for _, pattern := range *p {
+		values = append(values, pattern.Name+"="+pattern.Regexp.String())
+	}
+	return strings.Join(values, ",")
+}
+
+// Set adds a name=regexp pattern
+func (p *Patterns) Set(value string) error {
+	name, expression, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("meta %s isn't name=regexp", value)
+	}
+	r, err := regexp.Compile(expression)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, Pattern{Name: name, Regexp: r})
+	return nil
+}
+
+// FlagMeta are the metadata patterns
+var FlagMeta Patterns
+
+func init() {
+	flag.Var(&FlagMeta, "meta", "name=regexp metadata attached to positions from the line it matches on until the next match, "+
+		"the value is the last submatch, can be repeated")
+}
+
+// Annotation computes the metadata of the lines of a source, every position has its source and line
+// and the values of the metadata patterns
+type Annotation struct {
+	Source string
+	Line   int
+	Values map[string]string
+}
+
+// NewAnnotation makes a new annotation of a source
+func NewAnnotation(source string) *Annotation {
+	return &Annotation{
+		Source: source,
+		Values: make(map[string]string),
+	}
+}
+
+// Next computes the metadata of the next line
+func (a *Annotation) Next(text string) Meta {
+	a.Line++
+	for _, pattern := range FlagMeta {
+		if match := pattern.Regexp.FindStringSubmatch(text); match != nil {
+			a.Values[pattern.Name] = match[len(match)-1]
+		}
+	}
+	meta := Meta{"source": a.Source, "line": strconv.Itoa(a.Line)}
+	for key, value := range a.Values {
+		meta[key] = value
+	}
+	return meta
+}
+
+// MaxLine is the most tokens that are buffered waiting for the end of a line
+const MaxLine = 4096
+
+// Annotate attaches the metadata of each line to the tokens of the tokenizer,
+// a line of tokens is buffered so the patterns can match anywhere on it
+func Annotate(tokenizer Tokenizer, source string) Tokenizer {
+	annotation, pending := NewAnnotation(source), []Token{}
+	return TokenizerFunc(func() (Token, bool) {
+		if len(pending) == 0 {
+			text := strings.Builder{}
+			for len(pending) < MaxLine {
+				token, ok := tokenizer.Next()
+				if !ok {
+					break
+				}
+				pending = append(pending, token)
+				text.WriteString(token.Text)
+				if strings.HasSuffix(token.Text, "\n") {
+					break
+				}
+			}
+			if len(pending) == 0 {
+				return Token{}, false
+			}
+			meta := annotation.Next(text.String())
+			for i := range pending {
+				pending[i].Meta = meta
+			}
+		}
+		token := pending[0]
+		pending = pending[1:]
+		return token, true
+	})
+}
+
+// AnnotateBytes computes the metadata of the lines of the data, returning the metadata of a position
+func AnnotateBytes(data []byte, source string) func(position int) Meta {
+	annotation, starts, metas := NewAnnotation(source), []int{}, []Meta{}
+	for begin := 0; begin < len(data); {
+		end := begin
+		for end < len(data) && data[end] != '\n' {
+			end++
+		}
+		if end < len(data) {
+			end++
+		}
+		starts = append(starts, begin)
+		metas = append(metas, annotation.Next(string(data[begin:end])))
+		begin = end
+	}
+	return func(position int) Meta {
+		line := sort.Search(len(starts), func(i int) bool {
+			return starts[i] > position
+		}) - 1
+		if line < 0 {
+			return nil
+		}
+		return metas[line]
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FlagMetrics is the address the metrics are served on
+var FlagMetrics = flag.String("metrics", "", "address the prometheus metrics and expvars are served on, such as :9090, none when empty")
+
+// LatencyBuckets are the upper bounds in seconds of the buckets of the fire latency histogram
+var LatencyBuckets = []float64{1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 2.5e-3, 5e-3, 1e-2, 2.5e-2, 5e-2, .1, .25, .5, 1}
+
+// Counters are the counters and gauges of the running networks
+type Counters struct {
+	Symbols int64
+	Fires   int64
+	Entropy float64
+	Window  int64
+	// Latency are the counts of the fire latencies of each bucket, the last is the overflow
+	Latency []int64
+	// Seconds is the summed fire latency
+	Seconds float64
+}
+
+// Telemetry collects the counters from the running networks
+type Telemetry struct {
+	sync.Mutex
+	Counters Counters
+}
+
+// Monitor is the telemetry of the metrics endpoint, nil when the metrics aren't served
+var Monitor *Telemetry
+
+// Fire records a fire of the network that took duration
+func (t *Telemetry) Fire(n *Net, entropy float32, duration time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	c, seconds := &t.Counters, duration.Seconds()
+	bucket := 0
+	for bucket < len(LatencyBuckets) && seconds > LatencyBuckets[bucket] {
+		bucket++
+	}
+	c.Latency[bucket]++
+	c.Seconds += seconds
+	c.Fires++
+	if !math.IsNaN(float64(entropy)) {
+		c.Entropy += float64(entropy)
+	}
+	c.Window = n.Window()
+}
+
+// Snapshot is a copy of the counters
+func (t *Telemetry) Snapshot() Counters {
+	t.Lock()
+	defer t.Unlock()
+	c := t.Counters
+	c.Latency = append([]int64{}, c.Latency...)
+	return c
+}
+
+// MeanEntropy is the mean entropy of the fires
+func (c Counters) MeanEntropy() float64 {
+	if c.Fires == 0 {
+		return 0
+	}
+	return c.Entropy / float64(c.Fires)
+}
+
+// ServeHTTP writes the metrics in the prometheus text format
+func (t *Telemetry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s := t.Snapshot()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	metric("testament_symbols_total", "counter", "Symbols colored.", s.Symbols)
+	metric("testament_fires_total", "counter", "Fires of the network.", s.Fires)
+	metric("testament_entropy_mean", "gauge", "Mean entropy of the fires.", s.MeanEntropy())
+	metric("testament_window", "gauge", "Current window of the statistics update.", s.Window)
+	fmt.Fprintf(w, "# HELP testament_fire_seconds Latency of the fires of the network.\n# TYPE testament_fire_seconds histogram\n")
+	cumulative := int64(0)
+	for i, bound := range LatencyBuckets {
+		cumulative += s.Latency[i]
+		fmt.Fprintf(w, "testament_fire_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	cumulative += s.Latency[len(LatencyBuckets)]
+	fmt.Fprintf(w, "testament_fire_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(w, "testament_fire_seconds_sum %g\ntestament_fire_seconds_count %d\n", s.Seconds, cumulative)
+}
+
+// StartMetrics serves the metrics on the metrics address if it is set, returning a function that stops serving
+func StartMetrics() func() {
+	if *FlagMetrics == "" {
+		return func() {}
+	}
+	Monitor = &Telemetry{Counters: Counters{Latency: make([]int64, len(LatencyBuckets)+1)}}
+	unsubscribe := Events.Subscribe(func(event Event) {
+		if event.Type == EventStep {
+			Monitor.Lock()
+			Monitor.Counters.Symbols++
+			Monitor.Unlock()
+		}
+	})
+	expvar.Publish("testament", expvar.Func(func() interface{} {
+		s := Monitor.Snapshot()
+		return map[string]interface{}{
+			"symbols":      s.Symbols,
+			"fires":        s.Fires,
+			"entropy_mean": s.MeanEntropy(),
+			"window":       s.Window,
+			"fire_seconds": s.Seconds,
+		}
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Monitor)
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{Addr: *FlagMetrics, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+	slog.Info("serving metrics", "addr", *FlagMetrics)
+	return func() {
+		unsubscribe()
+		server.Close()
+	}
+}
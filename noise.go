@@ -0,0 +1,147 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"unicode"
+)
+
+// Corruption is the rates of the kinds of corruption injected into a corpus
+type Corruption struct {
+	Flip   float64
+	Delete float64
+	Case   float64
+}
+
+// Corrupt corrupts the data, returning the corrupted data, the original position of each corrupted symbol
+// and whether it was changed
+func (c Corruption) Corrupt(rng *rand.Rand, data []byte) ([]byte, []int, []bool) {
+	corrupted, origins, changed := make([]byte, 0, len(data)), make([]int, 0, len(data)), make([]bool, 0, len(data))
+	for i, symbol := range data {
+		if rng.Float64() < c.Delete {
+			continue
+		}
+		s := symbol
+		if rng.Float64() < c.Flip {
+			s ^= 1 << uint(rng.Intn(8))
+		}
+		if rng.Float64() < c.Case {
+			r := rune(s)
+			if unicode.IsUpper(r) {
+				s = byte(unicode.ToLower(r))
+			} else if unicode.IsLower(r) {
+				s = byte(unicode.ToUpper(r))
+			}
+		}
+		corrupted = append(corrupted, s)
+		origins = append(origins, i)
+		changed = append(changed, s != symbol)
+	}
+	return corrupted, origins, changed
+}
+
+// Colorings colors the data with a frozen model or a new network, returning the codes and entropies
+func Colorings(model string, data []byte) ([]int, []float32) {
+	net := NewFlagNet(3)
+	if model != "" {
+		var err error
+		net, err = LoadNet(model)
+		if err != nil {
+			panic(err)
+		}
+		net.Frozen = true
+	}
+	codes, entropies := make([]int, 0, len(data)), make([]float32, 0, len(data))
+	Color(&net, data, 0, nil, func(symbol Symbol) {
+		codes = append(codes, symbol.Code)
+		entropies = append(entropies, symbol.Entropy)
+	})
+	return codes, entropies
+}
+
+// Correlation is the pearson correlation of two series
+func Correlation(a, b []float64) float64 {
+	ma, sa := MeanStd(a)
+	mb, sb := MeanStd(b)
+	if sa == 0 || sb == 0 {
+		return 0
+	}
+	sum := 0.0
+	for i := range a {
+		sum += (a[i] - ma) * (b[i] - mb)
+	}
+	return sum / float64(len(a)) / (sa * sb)
+}
+
+// NoiseCommand measures how much corruption of the corpus changes the codes and the entropy profile
+func NoiseCommand(args []string) {
+	flags := flag.NewFlagSet("noise", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	length := flags.Int("length", 4096, "length of the slice of the corpus, 0 for the whole corpus")
+	flip := flags.Float64("flip", .01, "rate of bit flips")
+	deletion := flags.Float64("delete", .01, "rate of deletions")
+	scramble := flags.Float64("case", .01, "rate of case changes")
+	seed := flags.Int64("noise-seed", 1, "seed of the corruption")
+	flags.Parse(args)
+
+	data := Load(*file)
+	if *length > 0 && *length < len(data) {
+		data = data[:*length]
+	}
+	if len(data) == 0 {
+		return
+	}
+	corruption := Corruption{Flip: *flip, Delete: *deletion, Case: *scramble}
+	corrupted, origins, changed := corruption.Corrupt(rand.New(rand.NewSource(*seed)), data)
+	cleanCodes, cleanEntropies := Colorings(*model, data)
+	noisyCodes, noisyEntropies := Colorings(*model, corrupted)
+
+	type Alignment struct {
+		Clean, Noisy []int
+		A, B         []float64
+		Same         int
+		Difference   float64
+	}
+	all, untouched := Alignment{}, Alignment{}
+	add := func(a *Alignment, i int) {
+		origin := origins[i]
+		a.Clean = append(a.Clean, cleanCodes[origin])
+		a.Noisy = append(a.Noisy, noisyCodes[i])
+		a.A = append(a.A, float64(cleanEntropies[origin]))
+		a.B = append(a.B, float64(noisyEntropies[i]))
+		if cleanCodes[origin] == noisyCodes[i] {
+			a.Same++
+		}
+		a.Difference += math.Abs(float64(cleanEntropies[origin] - noisyEntropies[i]))
+	}
+	changes := 0
+	for i := range corrupted {
+		add(&all, i)
+		if changed[i] {
+			changes++
+		} else {
+			add(&untouched, i)
+		}
+	}
+	fmt.Printf("symbols %d, deleted %d, changed %d\n", len(data), len(data)-len(corrupted), changes)
+	fmt.Printf("%-10s %9s %10s %9s %12s %12s\n", "positions", "count", "same code", "nmi", "entropy mae", "entropy corr")
+	report := func(name string, a Alignment) {
+		if len(a.Clean) == 0 {
+			return
+		}
+		count := float64(len(a.Clean))
+		fmt.Printf("%-10s %9d %10f %9f %12f %12f\n", name, len(a.Clean),
+			float64(a.Same)/count, NMI(a.Clean, a.Noisy), a.Difference/count, Correlation(a.A, a.B))
+		Metric(name+"_same_code", float64(a.Same)/count)
+		Metric(name+"_entropy_correlation", Correlation(a.A, a.B))
+	}
+	report("all", all)
+	report("untouched", untouched)
+}
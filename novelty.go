@@ -0,0 +1,68 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+)
+
+// NoveltyCandidates is the number of best value systems whose codes are candidates for the next position of a novelty wander
+const NoveltyCandidates = 8
+
+// Novelty is the mean cosine distance of the embedding of the position from the embeddings of the recent positions, between 0 and 1
+func Novelty(tokens []Token, position int, recent []int) float64 {
+	if len(recent) == 0 {
+		return 1
+	}
+	cosine := func(a, b []float32) float64 {
+		dot, aa, bb := 0.0, 0.0, 0.0
+		for i := range a[:min(len(a), len(b))] {
+			dot += float64(a[i]) * float64(b[i])
+			aa += float64(a[i]) * float64(a[i])
+			bb += float64(b[i]) * float64(b[i])
+		}
+		if aa == 0 || bb == 0 {
+			return 0
+		}
+		return dot / math.Sqrt(aa*bb)
+	}
+	sum, embedding := 0.0, tokens[position].Embedding
+	for _, visited := range recent {
+		sum += (1 - cosine(embedding, tokens[visited].Embedding)) / 2
+	}
+	return sum / float64(len(recent))
+}
+
+// Novel picks the code of the last fire trading the entropy of the best value systems off against the novelty of the
+// positions their codes address relative to the recent positions. The elite code of the fire is a candidate of entropy 0,
+// the entropies of the systems are scaled between 1/(candidates+1) and 1 so a small weight keeps the elite code.
+// The weight is the share of the novelty in the score, the candidate of lowest score wins
+func (n *Net) Novel(tokens []Token, recent []int, elite int, weight float64) int {
+	frozen := n.Frozen
+	n.Frozen = true
+	defer func() {
+		n.Frozen = frozen
+	}()
+	candidates := n.Candidates(NoveltyCandidates)
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, candidate := range candidates {
+		lowest, highest = math.Min(lowest, float64(candidate.Entropy)), math.Max(highest, float64(candidate.Entropy))
+	}
+	shift := 1 / float64(len(candidates)+1)
+	code, best := elite, weight*(1-Novelty(tokens, elite%len(tokens), recent))
+	for _, candidate := range candidates {
+		entropy := 0.0
+		if highest > lowest {
+			entropy = (float64(candidate.Entropy) - lowest) / (highest - lowest)
+		}
+		entropy = shift + (1-shift)*entropy
+		c := n.Decode(candidate.Outputs).Label
+		score := (1-weight)*entropy + weight*(1-Novelty(tokens, c%len(tokens), recent))
+		if score < best {
+			code, best = c, score
+		}
+	}
+	return code
+}
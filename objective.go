@@ -0,0 +1,63 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+const (
+	// ObjectiveMinimize selects the lowest entropy systems
+	ObjectiveMinimize = "min"
+	// ObjectiveMaximize selects the highest entropy systems
+	ObjectiveMaximize = "max"
+	// ObjectiveAnneal maximizes with a probability that decays linearly to 0 over the anneal steps and minimizes otherwise
+	ObjectiveAnneal = "anneal"
+)
+
+var (
+	// FlagObjective is the direction of the self entropy objective
+	FlagObjective = flag.String("objective", ObjectiveMinimize, "direction of the self entropy objective: min, max or anneal from max to min")
+	// FlagAnneal is the number of steps the anneal objective takes to go from maximizing to minimizing
+	FlagAnneal = flag.Int("anneal", 1000, "number of steps the anneal objective takes to go from maximizing to minimizing")
+)
+
+// Objective is the direction of the self entropy objective
+type Objective struct {
+	// Mode is min, max or anneal
+	Mode string
+	// Steps is the number of steps of the annealing schedule
+	Steps int
+	// Step is the current step of the annealing schedule
+	Step int
+}
+
+// Maximize advances the objective by a step and reports whether the step maximizes the entropy.
+// A frozen network doesn't advance the schedule, it maximizes while the probability of maximizing is above one half
+func (n *Net) Maximize() bool {
+	o := &n.Objective
+	switch o.Mode {
+	case ObjectiveMinimize, "":
+		return false
+	case ObjectiveMaximize:
+		return true
+	case ObjectiveAnneal:
+		if n.Frozen {
+			return 2*o.Step < o.Steps
+		}
+		o.Step++
+		if o.Step >= o.Steps {
+			return false
+		}
+		return n.Rng.Float64() >= float64(o.Step)/float64(o.Steps)
+	}
+	panic(fmt.Errorf("unknown objective %s", o.Mode))
+}
+
+// descending orders samples by descending entropy
+func descending(a, b Sample) int {
+	return compare(b, a)
+}
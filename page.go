@@ -0,0 +1,69 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+)
+
+// FormatTerminal is colored terminal output
+const FormatTerminal = "terminal"
+
+// Page streams the colored corpus as a standalone html page, each symbol is a span with a tooltip
+// of its position, code and entropy
+type Page struct {
+	writer io.Writer
+}
+
+// NewPage writes the head of a page titled name to the buffered writer, the classes c0, c1, ... have the colors
+func NewPage(w io.Writer, name string, colors []string) *Page {
+	p := &Page{writer: w}
+	fmt.Fprintf(p.writer, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>testament %s</title>\n<style>\n",
+		html.EscapeString(name))
+	fmt.Fprintln(p.writer, "body { font-family: monospace; white-space: pre-wrap; margin: 1em; }")
+	fmt.Fprintln(p.writer, "h1 { font-family: sans-serif; font-size: 1em; white-space: normal; }")
+	for class, color := range colors {
+		fmt.Fprintf(p.writer, ".c%d { color: %s; }\n", class, color)
+	}
+	fmt.Fprintf(p.writer, "</style>\n</head>\n<body dir=\"auto\">")
+	return p
+}
+
+// Heading writes a heading, such as the name of the next file
+func (p *Page) Heading(text string) {
+	fmt.Fprintf(p.writer, "<h1>%s</h1>", html.EscapeString(text))
+}
+
+// Write writes the text of a symbol in the color of the class
+func (p *Page) Write(text string, symbol Symbol, class int) {
+	fmt.Fprintf(p.writer, "<span class=\"c%d\" title=\"position %d code %d entropy %f\">%s</span>",
+		class, symbol.Position, symbol.Code, symbol.Entropy, html.EscapeString(text))
+}
+
+// Close writes the end of the page
+func (p *Page) Close() {
+	fmt.Fprintln(p.writer, "</body>\n</html>")
+}
+
+// PageColors are the css colors of the classes of the coloring, the codes or the levels of the entropy gradient
+func PageColors(coloring string) []string {
+	colors := []string{}
+	switch coloring {
+	case ColoringCode:
+		for code := 0; code < MaxCodes; code++ {
+			colors = append(colors, Hex(code))
+		}
+	case ColoringEntropy:
+		for level := 0; level < GradientLevels; level++ {
+			heat := Heat(float64(level) / (GradientLevels - 1))
+			colors = append(colors, fmt.Sprintf("#%02x%02x%02x", heat.R, heat.G, heat.B))
+		}
+	default:
+		panic(fmt.Errorf("unknown coloring %s", coloring))
+	}
+	return colors
+}
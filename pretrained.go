@@ -0,0 +1,116 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hash"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FlagEmbeddings is the file of the pretrained embeddings
+var FlagEmbeddings = flag.String("embeddings", "", "pretrained character or word vectors in the word2vec or glove text format that replace the hashed embeddings, the size becomes their width")
+
+// Pretrained are the pretrained embeddings of the words, nil when the embeddings are hashed
+var Pretrained map[string][]float32
+
+// LoadPretrained loads vectors in the word2vec text format, or the glove format which lacks the header line
+// of the number of vectors and their width. The vectors are normalized to unit length like the hashed embeddings
+// they are mixed with, so exported embeddings load back unchanged
+func LoadPretrained(file string) (map[string][]float32, int, error) {
+	input, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer input.Close()
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	vectors, width, line := make(map[string][]float32), 0, 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if line == 1 && len(fields) == 2 {
+			if _, err := strconv.Atoi(fields[1]); err == nil {
+				continue
+			}
+		}
+		if width == 0 {
+			width = len(fields) - 1
+		}
+		if len(fields)-1 != width || width == 0 {
+			return nil, 0, fmt.Errorf("%s:%d: vector of width %d instead of %d", file, line, len(fields)-1, width)
+		}
+		vector := make([]float32, width)
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s:%d: %v", file, line, err)
+			}
+			vector[i] = float32(value)
+		}
+		vectors[fields[0]] = Unit(vector)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(vectors) == 0 {
+		return nil, 0, fmt.Errorf("%s has no vectors", file)
+	}
+	return vectors, width, nil
+}
+
+// PretrainedEmbedding is the pretrained embedding of the text, or of its lower case, if there is one
+func PretrainedEmbedding(text string) ([]float32, bool) {
+	if Pretrained == nil {
+		return nil, false
+	}
+	if embedding, ok := Pretrained[text]; ok {
+		return embedding, true
+	}
+	embedding, ok := Pretrained[strings.ToLower(text)]
+	return embedding, ok
+}
+
+// PretrainedByte is the pretrained embedding of the byte, looked up as its word in the word2vec format or as its rune
+func PretrainedByte(symbol byte) ([]float32, bool) {
+	if embedding, ok := PretrainedEmbedding(ByteWord(symbol)); ok {
+		return embedding, true
+	}
+	return PretrainedEmbedding(string(rune(symbol)))
+}
+
+// Unit normalizes the vector to unit length in place, a vector already of unit length is kept as it is
+func Unit(vector []float32) []float32 {
+	sum := 0.0
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	length := math.Sqrt(sum)
+	if length == 0 || math.Abs(length-1) < 1e-6 {
+		return vector
+	}
+	for i, v := range vector {
+		vector[i] = float32(float64(v) / length)
+	}
+	return vector
+}
+
+// Hashed is the hashed embedding of the symbol truncated to size. With pretrained embeddings it is normalized
+// to unit length so the hashed fallbacks are on the scale of the pretrained vectors
+func Hashed(h hash.Hash32, symbol []byte, size int) []float32 {
+	embedding := Embedding(h, symbol, size)[:size]
+	if Pretrained != nil {
+		return Unit(embedding)
+	}
+	return embedding
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Influence is the influence of an input dimension on the sign of an output neuron
+type Influence struct {
+	Dimension int
+	Label     string
+	Mean      float32
+	Influence float64
+}
+
+// Affinity is the expected activation of an output neuron for a byte
+type Affinity struct {
+	Symbol     byte
+	Activation float64
+}
+
+// Receptive is the receptive field of an output neuron
+type Receptive struct {
+	Neuron     int
+	Dimensions []Influence
+	Positive   []Affinity
+	Negative   []Affinity
+	Fraction   float64
+}
+
+// EmbeddingSize is the size of the embedding of a symbol in the input of the network
+func (n *Net) EmbeddingSize() int {
+	size := n.Inputs
+	if n.Recurrence.Enabled {
+		size -= n.Outputs
+	}
+	if n.ContextMode == ContextConcat {
+		size /= n.Context + 1
+	}
+	return size
+}
+
+// InputLabel labels an input dimension of the network by the context offset and embedding dimension it holds
+func (n *Net) InputLabel(dimension int) string {
+	size := n.EmbeddingSize()
+	embedding := size
+	if n.ContextMode == ContextConcat {
+		embedding *= n.Context + 1
+	}
+	switch {
+	case dimension >= embedding:
+		return fmt.Sprintf("state %d", dimension-embedding)
+	case n.Context > 0 && n.ContextMode == ContextConcat:
+		return fmt.Sprintf("t-%d dim %d", dimension/size, dimension%size)
+	}
+	return fmt.Sprintf("dim %d", dimension)
+}
+
+// Probe computes the receptive fields of the output neurons of the first layer from the means of the value statistics,
+// with the embeddings of the current symbol as the input. The influence of an input dimension is the magnitude of
+// its mean weight scaled by the spread of the embeddings along the dimension, the recurrent state isn't scaled
+func (n *Net) Probe(embeddings [256][]float32, dimensions, symbols int) []Receptive {
+	size := n.EmbeddingSize()
+	if len(embeddings[0]) != size {
+		panic(fmt.Errorf("the model embeds symbols in %d dimensions, not %d, set -size", size, len(embeddings[0])))
+	}
+	spread := make([]float64, size)
+	for d := range spread {
+		sum, squares := 0.0, 0.0
+		for _, embedding := range embeddings {
+			v := float64(embedding[d])
+			sum += v
+			squares += v * v
+		}
+		mean := sum / 256
+		spread[d] = math.Sqrt(squares/256 - mean*mean)
+	}
+	embedding := size
+	if n.ContextMode == ContextConcat {
+		embedding *= n.Context + 1
+	}
+	receptives := []Receptive{}
+	for j, row := range n.V {
+		receptive := Receptive{Neuron: j}
+		influences := make([]Influence, len(row))
+		for d, random := range row {
+			influence := math.Abs(float64(random.Mean))
+			if d < embedding {
+				influence *= spread[d%size]
+			}
+			influences[d] = Influence{
+				Dimension: d,
+				Label:     n.InputLabel(d),
+				Mean:      random.Mean,
+				Influence: influence,
+			}
+		}
+		sort.SliceStable(influences, func(a, b int) bool {
+			return influences[a].Influence > influences[b].Influence
+		})
+		receptive.Dimensions = influences[:min(dimensions, len(influences))]
+
+		affinities, positive := make([]Affinity, 256), 0
+		for symbol, embedding := range embeddings {
+			activation := 0.0
+			for d, v := range embedding {
+				activation += float64(row[d].Mean) * float64(v)
+			}
+			affinities[symbol] = Affinity{Symbol: byte(symbol), Activation: activation}
+			if activation > 0 {
+				positive++
+			}
+		}
+		receptive.Fraction = float64(positive) / 256
+		sort.SliceStable(affinities, func(a, b int) bool {
+			return affinities[a].Activation > affinities[b].Activation
+		})
+		count := min(symbols, len(affinities))
+		receptive.Positive = append(receptive.Positive, affinities[:count]...)
+		for i := len(affinities) - 1; i >= len(affinities)-count; i-- {
+			receptive.Negative = append(receptive.Negative, affinities[i])
+		}
+		receptives = append(receptives, receptive)
+	}
+	return receptives
+}
+
+// AffinitySymbols formats the symbols of the affinities
+func AffinitySymbols(affinities []Affinity) string {
+	symbols := []string{}
+	for _, affinity := range affinities {
+		symbols = append(symbols, strconv.QuoteToASCII(string([]byte{affinity.Symbol})))
+	}
+	return strings.Join(symbols, " ")
+}
+
+// ProbeCommand reports which input dimensions and bytes most influence the sign of each output neuron of a model
+func ProbeCommand(args []string) {
+	flags := flag.NewFlagSet("probe", flag.ExitOnError)
+	model := flags.String("model", "", "the model to probe")
+	dimensions := flags.Int("dimensions", 5, "number of the most influential input dimensions reported for each neuron")
+	symbols := flags.Int("symbols", 12, "number of the bytes reported for each sign of each neuron")
+	flags.Parse(args)
+	if *model == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	net, err := LoadNet(*model)
+	if err != nil {
+		panic(err)
+	}
+	for _, receptive := range net.Probe(ByteEmbeddings(), *dimensions, *symbols) {
+		fmt.Printf("neuron %d (bit %d of the code) positive for %.1f%% of bytes\n",
+			receptive.Neuron, receptive.Neuron, 100*receptive.Fraction)
+		for _, influence := range receptive.Dimensions {
+			fmt.Printf("  %-14s mean %+8.4f influence %8.4f\n", influence.Label, influence.Mean, influence.Influence)
+		}
+		fmt.Printf("  + %s\n", AffinitySymbols(receptive.Positive))
+		fmt.Printf("  - %s\n", AffinitySymbols(receptive.Negative))
+	}
+	if len(net.Layers) > 0 {
+		fmt.Printf("the %d stacked layers take the outputs of the layer below as input and aren't probed\n", len(net.Layers))
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+var (
+	// FlagCPUProfile is the file the cpu profile is written to
+	FlagCPUProfile = OutputFlag(flag.CommandLine, "cpuprofile", "", "write a cpu profile of the command to the file")
+	// FlagMemProfile is the file the heap profile is written to
+	FlagMemProfile = OutputFlag(flag.CommandLine, "memprofile", "", "write a heap profile at the end of the command to the file")
+	// FlagTrace is the file the execution trace is written to
+	FlagTrace = OutputFlag(flag.CommandLine, "trace", "", "write an execution trace of the command to the file")
+)
+
+// StartProfiles starts the cpu profile and execution trace if their flags are set, returning a function that
+// stops them and writes the heap profile
+func StartProfiles() func() {
+	stops := []func(){}
+	if *FlagCPUProfile != "" {
+		output, err := os.Create(*FlagCPUProfile)
+		if err != nil {
+			panic(err)
+		}
+		if err := pprof.StartCPUProfile(output); err != nil {
+			panic(err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			output.Close()
+		})
+	}
+	if *FlagTrace != "" {
+		output, err := os.Create(*FlagTrace)
+		if err != nil {
+			panic(err)
+		}
+		if err := trace.Start(output); err != nil {
+			panic(err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			output.Close()
+		})
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+		if *FlagMemProfile != "" {
+			output, err := os.Create(*FlagMemProfile)
+			if err != nil {
+				panic(err)
+			}
+			defer output.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(output); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
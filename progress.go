@@ -0,0 +1,91 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FlagProgress is the interval the progress is printed at
+var FlagProgress = flag.Duration("progress", 0, "print the position, percent complete, symbols per second and eta to stderr at this interval, none when 0")
+
+// Progress periodically reports how far through the corpus a command is
+type Progress struct {
+	// Total is the size of the corpus in bytes, the percent complete and eta are unknown when it is 0
+	Total    int
+	Interval time.Duration
+	Writer   io.Writer
+	start    time.Time
+	last     time.Time
+}
+
+// NewProgress makes a progress reporting every interval through a corpus of total bytes
+func NewProgress(total int, interval time.Duration) *Progress {
+	now := time.Now()
+	return &Progress{Total: total, Interval: interval, Writer: os.Stderr, start: now, last: now}
+}
+
+// NewFlagProgress makes a progress from the progress flag, nil when the progress isn't reported
+func NewFlagProgress(total int) *Progress {
+	if *FlagProgress <= 0 {
+		return nil
+	}
+	return NewProgress(total, *FlagProgress)
+}
+
+// CorpusSize is the size in bytes of the files, 0 when the size of a file isn't known before it is read
+func CorpusSize(files []string) int {
+	total := 0
+	for _, file := range files {
+		if file == "" || file == "-" || IsURL(file) {
+			return 0
+		}
+		// the decompressed size of a compressed file is only known once it is read
+		input, err := os.Open(file)
+		if err != nil {
+			return 0
+		}
+		magic := make([]byte, 8)
+		n, _ := io.ReadFull(input, magic)
+		info, err := input.Stat()
+		input.Close()
+		if err != nil || Compression(file, magic[:n]) != nil {
+			return 0
+		}
+		begin, end := Range(int(info.Size()))
+		total += end - begin
+	}
+	return total
+}
+
+// Update reports the progress if the interval has passed, symbols have been processed covering done bytes
+func (p *Progress) Update(symbols, done int) {
+	now := time.Now()
+	if now.Sub(p.last) < p.Interval {
+		return
+	}
+	p.last = now
+	p.Report(symbols, done)
+}
+
+// Report reports the progress
+func (p *Progress) Report(symbols, done int) {
+	elapsed := time.Since(p.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(symbols) / elapsed
+	}
+	if p.Total <= 0 || done <= 0 {
+		fmt.Fprintf(p.Writer, "position %d %.0f symbols/s\n", symbols, rate)
+		return
+	}
+	fraction := min(float64(done)/float64(p.Total), 1)
+	eta := time.Duration((1 - fraction) / fraction * elapsed * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(p.Writer, "position %d %5.1f%% %.0f symbols/s eta %s\n", symbols, 100*fraction, rate, eta)
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Document is the score of a document in a collection
+type Document struct {
+	Path        string    `json:"path"`
+	Symbols     int       `json:"symbols"`
+	MeanEntropy float64   `json:"mean_entropy"`
+	Codes       []float64 `json:"codes"`
+	Divergence  float64   `json:"divergence"`
+	Score       float64   `json:"score"`
+}
+
+// Rank ranks the documents of a directory by how anomalous they are under a model
+func Rank(args []string) {
+	flags := flag.NewFlagSet("rank", flag.ExitOnError)
+	model := flags.String("model", "", "the model to score with")
+	dir := flags.String("dir", "", "the directory of documents")
+	top := flags.Int("top", 10, "number of documents to list")
+	details := OutputFlag(flags, "json", "", "file to write the per document json details to")
+	flags.Parse(args)
+	if *model == "" || *dir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	documents := []*Document{}
+	total := []float64{}
+	err := filepath.WalkDir(*dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data := Load(path)
+		if len(data) == 0 {
+			return nil
+		}
+		document := &Document{
+			Path: path,
+		}
+		Score(*model, data, func(symbol Symbol) {
+			for len(document.Codes) <= symbol.Code {
+				document.Codes = append(document.Codes, 0)
+			}
+			document.Symbols++
+			document.MeanEntropy += float64(symbol.Entropy)
+			document.Codes[symbol.Code]++
+		})
+		document.MeanEntropy /= float64(document.Symbols)
+		for len(total) < len(document.Codes) {
+			total = append(total, 0)
+		}
+		for code, count := range document.Codes {
+			total[code] += count
+			document.Codes[code] = count / float64(document.Symbols)
+		}
+		documents = append(documents, document)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	if len(documents) == 0 {
+		fmt.Println("no documents in", *dir)
+		return
+	}
+
+	sum := 0.0
+	for _, count := range total {
+		sum += count
+	}
+	for _, document := range documents {
+		for code, count := range total {
+			p, q := 0.0, (count+1)/(sum+float64(len(total)))
+			if code < len(document.Codes) {
+				p = document.Codes[code]
+			}
+			if p > 0 {
+				document.Divergence += p * math.Log2(p/q)
+			}
+		}
+	}
+
+	zscores := func(value func(d *Document) float64) []float64 {
+		mean, variance := 0.0, 0.0
+		for _, document := range documents {
+			mean += value(document)
+		}
+		mean /= float64(len(documents))
+		for _, document := range documents {
+			diff := value(document) - mean
+			variance += diff * diff
+		}
+		deviation := math.Sqrt(variance / float64(len(documents)))
+		scores := make([]float64, len(documents))
+		for i, document := range documents {
+			if deviation > 0 {
+				scores[i] = (value(document) - mean) / deviation
+			}
+		}
+		return scores
+	}
+	entropy := zscores(func(d *Document) float64 { return d.MeanEntropy })
+	divergence := zscores(func(d *Document) float64 { return d.Divergence })
+	for i, document := range documents {
+		document.Score = entropy[i] + divergence[i]
+	}
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].Score > documents[j].Score
+	})
+
+	if *details != "" {
+		output, err := os.Create(*details)
+		if err != nil {
+			panic(err)
+		}
+		defer output.Close()
+		encoder := json.NewEncoder(output)
+		for _, document := range documents {
+			if err := encoder.Encode(document); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	if *top > len(documents) {
+		*top = len(documents)
+	}
+	fmt.Printf("%8s %12s %12s %10s %s\n", "score", "entropy", "divergence", "symbols", "path")
+	for _, document := range documents[:*top] {
+		fmt.Printf("%8.3f %12.6f %12.6f %10d %s\n", document.Score, document.MeanEntropy,
+			document.Divergence, document.Symbols, document.Path)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FlagRecord is the asciinema file the session is recorded to
+var FlagRecord = OutputFlag(flag.CommandLine, "record", "", "record the session to an asciinema cast file")
+
+// Header is the header of an asciinema v2 cast file
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder records output as an asciinema v2 cast
+type Recorder struct {
+	Output  io.WriteCloser
+	Writer  *bufio.Writer
+	Start   time.Time
+	Last    time.Time
+	Pending []byte
+}
+
+// NewRecorder creates a new cast file
+func NewRecorder(file string) (*Recorder, error) {
+	output, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r := &Recorder{
+		Output: output,
+		Writer: bufio.NewWriter(output),
+		Start:  now,
+		Last:   now,
+	}
+	header, err := json.Marshal(Header{
+		Version:   2,
+		Width:     80,
+		Height:    24,
+		Timestamp: now.Unix(),
+		Env: map[string]string{
+			"TERM":  os.Getenv("TERM"),
+			"SHELL": os.Getenv("SHELL"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.Writer.Write(header)
+	r.Writer.WriteByte('\n')
+	return r, nil
+}
+
+// Write buffers the output, emitting an event at most every 10 milliseconds
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.Pending = append(r.Pending, bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))...)
+	if now := time.Now(); now.Sub(r.Last) >= 10*time.Millisecond {
+		r.Last = now
+		return len(p), r.event(now)
+	}
+	return len(p), nil
+}
+
+func (r *Recorder) event(now time.Time) error {
+	if len(r.Pending) == 0 {
+		return nil
+	}
+	event, err := json.Marshal([]interface{}{now.Sub(r.Start).Seconds(), "o", string(r.Pending)})
+	if err != nil {
+		return err
+	}
+	r.Pending = r.Pending[:0]
+	r.Writer.Write(event)
+	return r.Writer.WriteByte('\n')
+}
+
+// Close writes the pending output and closes the cast file
+func (r *Recorder) Close() error {
+	if err := r.event(time.Now()); err != nil {
+		return err
+	}
+	if err := r.Writer.Flush(); err != nil {
+		return err
+	}
+	return r.Output.Close()
+}
+
+// PlayCommand plays back a cast file
+func PlayCommand(args []string) {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: play session.cast")
+		os.Exit(2)
+	}
+	Play(flags.Arg(0))
+}
+
+// Play plays back a cast file with its original timing
+func Play(file string) {
+	input, err := os.Open(file)
+	if err != nil {
+		panic(err)
+	}
+	defer input.Close()
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	if !scanner.Scan() {
+		panic(fmt.Errorf("%s is empty", file))
+	}
+	header := Header{}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		panic(err)
+	}
+	if header.Version != 2 {
+		panic(fmt.Errorf("unsupported cast version %d", header.Version))
+	}
+	start := time.Now()
+	for scanner.Scan() {
+		event := []interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			panic(err)
+		}
+		if len(event) != 3 || event[1] != "o" {
+			continue
+		}
+		at, _ := event[0].(float64)
+		data, _ := event[2].(string)
+		time.Sleep(time.Until(start.Add(time.Duration(at * float64(time.Second)))))
+		os.Stdout.WriteString(data)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+}
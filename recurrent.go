@@ -0,0 +1,76 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"math"
+	"strings"
+
+	. "github.com/pointlander/matrix"
+)
+
+var (
+	// FlagRecurrent feeds the previous output back into the next input
+	FlagRecurrent = flag.Bool("recurrent", false, "feed the previous output back into the next input")
+	// FlagBoundary is the text that ends a document, resetting the recurrent state
+	FlagBoundary = flag.String("boundary", "", "text that ends a document and resets the recurrent state, files always do")
+)
+
+// Recurrence is the recurrent state of the network
+type Recurrence struct {
+	// Enabled feeds the previous output back into the next input
+	Enabled bool
+	// State is the previous output
+	State []float32
+	// Boundary is the text that ends a document
+	Boundary string
+	// Tail is the end of the text seen so far
+	Tail string
+}
+
+// Reset resets the recurrent state at the start of a document
+func (n *Net) Reset() {
+	for i := range n.Recurrence.State {
+		n.Recurrence.State[i] = 0
+	}
+	n.Recurrence.Tail = ""
+}
+
+// Feedback stores the output normalized to unit length, like the embeddings, as the recurrent state
+func (n *Net) Feedback(out Matrix) {
+	if !n.Recurrence.Enabled {
+		return
+	}
+	if len(n.Recurrence.State) != len(out.Data) {
+		n.Recurrence.State = make([]float32, len(out.Data))
+	}
+	sum := 0.0
+	for _, v := range out.Data {
+		sum += float64(v) * float64(v)
+	}
+	length := float32(math.Sqrt(sum))
+	for i, v := range out.Data {
+		if length > 0 {
+			v /= length
+		}
+		n.Recurrence.State[i] = v
+	}
+}
+
+// Observe observes the text of a symbol, resetting the recurrent state at the end of a document
+func (n *Net) Observe(text string) {
+	r := &n.Recurrence
+	if !r.Enabled || r.Boundary == "" {
+		return
+	}
+	r.Tail += text
+	if len(r.Tail) > len(r.Boundary) {
+		r.Tail = r.Tail[len(r.Tail)-len(r.Boundary):]
+	}
+	if strings.HasSuffix(r.Tail, r.Boundary) {
+		n.Reset()
+	}
+}
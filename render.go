@@ -0,0 +1,246 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// RenderPixel renders each symbol as a square pixel
+	RenderPixel = "pixel"
+	// RenderGlyph renders each symbol as its glyph
+	RenderGlyph = "glyph"
+	// GlyphWidth is the width of a glyph cell in an svg
+	GlyphWidth = 7.2
+	// GlyphHeight is the height of a glyph cell in an svg
+	GlyphHeight = 14
+)
+
+// Cell is the column and row of a symbol in the layout, a symbol that isn't laid out has a negative column
+type Cell struct {
+	X, Y int
+}
+
+// Layout lays the texts of the symbols out in rows of width cells. With lines a newline starts a new row and takes
+// no cell, so the rows follow the lines of the corpus as long as they fit
+func Layout(texts []string, width int, lines bool) (cells []Cell, rows int) {
+	cells = make([]Cell, len(texts))
+	x, y := 0, 0
+	for i, text := range texts {
+		if lines && text == "\n" {
+			cells[i] = Cell{X: -1, Y: y}
+			x, y = 0, y+1
+			continue
+		}
+		if x == width {
+			x, y = 0, y+1
+		}
+		cells[i] = Cell{X: x, Y: y}
+		x++
+	}
+	if x > 0 || len(texts) == 0 {
+		y++
+	}
+	return cells, y
+}
+
+// Fills are the colors of the symbols, the code colors or the heat of the entropy between its minimum and maximum
+func Fills(symbols []Symbol, coloring string) []color.RGBA {
+	fills := make([]color.RGBA, len(symbols))
+	switch coloring {
+	case ColoringCode:
+		for i, symbol := range symbols {
+			fills[i] = Palette[symbol.Code%MaxCodes]
+		}
+	case ColoringEntropy:
+		low, high := float32(math.MaxFloat32), float32(-math.MaxFloat32)
+		for _, symbol := range symbols {
+			low, high = min(low, symbol.Entropy), max(high, symbol.Entropy)
+		}
+		for i, symbol := range symbols {
+			if high > low {
+				fills[i] = Heat(float64((symbol.Entropy - low) / (high - low)))
+			} else {
+				fills[i] = Heat(.5)
+			}
+		}
+	default:
+		panic(fmt.Errorf("unknown coloring %s", coloring))
+	}
+	return fills
+}
+
+// Printable replaces the runes that can't be drawn with spaces
+func Printable(text string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// Rendering is the layout of the colored symbols of a corpus
+type Rendering struct {
+	Texts   []string
+	Fills   []color.RGBA
+	Cells   []Cell
+	Columns int
+	Rows    int
+}
+
+// PNG draws the rendering as a png, pixels are scale wide
+func (r Rendering) PNG(w io.Writer, mode string, scale int) (width, height int) {
+	cellWidth, cellHeight := scale, scale
+	face := basicfont.Face7x13
+	if mode == RenderGlyph {
+		cellWidth, cellHeight = face.Advance, face.Height
+	}
+	width, height = r.Columns*cellWidth, r.Rows*cellHeight
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	drawer := font.Drawer{Dst: img, Face: face}
+	for i, cell := range r.Cells {
+		if cell.X < 0 {
+			continue
+		}
+		x, y := cell.X*cellWidth, cell.Y*cellHeight
+		fill := image.NewUniform(r.Fills[i])
+		if mode == RenderGlyph {
+			drawer.Src, drawer.Dot = fill, fixed.P(x, y+face.Ascent)
+			drawer.DrawString(Printable(r.Texts[i]))
+		} else {
+			draw.Draw(img, image.Rect(x, y, x+cellWidth, y+cellHeight), fill, image.Point{}, draw.Src)
+		}
+	}
+	if err := png.Encode(w, img); err != nil {
+		panic(err)
+	}
+	return width, height
+}
+
+// SVG draws the rendering as an svg, consecutive symbols of a row with the same color are merged into one element
+func (r Rendering) SVG(w io.Writer, mode string, scale int) (width, height int) {
+	cellWidth, cellHeight := float64(scale), float64(scale)
+	if mode == RenderGlyph {
+		cellWidth, cellHeight = GlyphWidth, GlyphHeight
+	}
+	width, height = int(math.Ceil(float64(r.Columns)*cellWidth)), int(math.Ceil(float64(r.Rows)*cellHeight))
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	fmt.Fprintf(out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		width, height, width, height)
+	fmt.Fprintf(out, "<rect width=\"100%%\" height=\"100%%\" fill=\"#ffffff\"/>\n")
+	if mode == RenderGlyph {
+		fmt.Fprintf(out, "<g font-family=\"monospace\" font-size=\"12\" xml:space=\"preserve\">\n")
+	}
+	hex := func(c color.RGBA) string {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	number := func(v float64) string {
+		return strconv.FormatFloat(math.Round(100*v)/100, 'f', -1, 64)
+	}
+	for i := 0; i < len(r.Cells); {
+		cell := r.Cells[i]
+		if cell.X < 0 {
+			i++
+			continue
+		}
+		text := strings.Builder{}
+		j := i
+		for ; j < len(r.Cells) && r.Cells[j].Y == cell.Y && r.Cells[j].X >= 0 && r.Fills[j] == r.Fills[i]; j++ {
+			text.WriteString(r.Texts[j])
+		}
+		x, y := float64(cell.X)*cellWidth, float64(cell.Y)*cellHeight
+		if mode == RenderGlyph {
+			fmt.Fprintf(out, "<text x=\"%s\" y=\"%s\" fill=\"%s\">%s</text>\n", number(x), number(y+.8*cellHeight), hex(r.Fills[i]),
+				html.EscapeString(Printable(text.String())))
+		} else {
+			fmt.Fprintf(out, "<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"%s\"/>\n", number(x), number(y),
+				number(float64(j-i)*cellWidth), number(cellHeight), hex(r.Fills[i]))
+		}
+		i = j
+	}
+	if mode == RenderGlyph {
+		fmt.Fprintln(out, "</g>")
+	}
+	fmt.Fprintln(out, "</svg>")
+	return width, height
+}
+
+// RenderCommand lays the colored corpus out as an image with a pixel or glyph per symbol
+func RenderCommand(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	mode := flags.String("mode", RenderPixel, "how a symbol is drawn: pixel or glyph")
+	width := flags.Int("width", 0, "the number of symbols per row, 256 pixels or 100 glyphs when 0")
+	lines := flags.Bool("lines", true, "start a new row at each newline")
+	scale := flags.Int("scale", 1, "the size of a pixel")
+	output := OutputFlag(flags, "o", "render.png", "the png or svg file to write")
+	flags.Parse(args)
+
+	if *mode != RenderPixel && *mode != RenderGlyph {
+		panic(fmt.Errorf("unknown mode %s", *mode))
+	}
+	if *width <= 0 {
+		*width = 256
+		if *mode == RenderGlyph {
+			*width = 100
+		}
+	}
+	*scale = max(*scale, 1)
+	net := NewFlagNet(3)
+	if *model != "" {
+		var err error
+		net, err = LoadNet(*model)
+		if err != nil {
+			panic(err)
+		}
+		net.Frozen = true
+	}
+	symbols := []Symbol{}
+	ColorTokens(&net, NewTokenizer(*file), 0, nil, func(symbol Symbol) {
+		symbols = append(symbols, symbol)
+	})
+	r := Rendering{Texts: make([]string, len(symbols)), Fills: Fills(symbols, *FlagColoring), Columns: *width}
+	for i, symbol := range symbols {
+		r.Texts[i] = symbol.String()
+	}
+	r.Cells, r.Rows = Layout(r.Texts, *width, *lines)
+
+	out, err := os.Create(*output)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	var w, h int
+	switch strings.ToLower(filepath.Ext(*output)) {
+	case ".svg":
+		w, h = r.SVG(out, *mode, *scale)
+	default:
+		w, h = r.PNG(out, *mode, *scale)
+	}
+	fmt.Printf("wrote %dx%d %s image of %d symbols to %s\n", w, h, *mode, len(symbols), *output)
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReplHelp is the help of the meta-commands of the repl
+const ReplHelp = `:window [n]   show or set the number of best samples the statistics are calculated from
+:save [file]  save a checkpoint of the network, the checkpoint flag when no file is given
+:reset        start over with a new network, or the model the repl was started with
+:help         show this help
+:quit         leave the repl`
+
+// Repl colors each line read from in with a network that keeps learning across the lines
+type Repl struct {
+	Model    string
+	Net      Net
+	Position int
+	Out      io.Writer
+	colors   []func(format string, a ...interface{}) string
+	meter    Thermometer
+}
+
+// NewRepl makes a new repl starting from the model, a new network when the model is empty
+func NewRepl(model string, out io.Writer) (*Repl, error) {
+	r := &Repl{Model: model, Out: out, colors: Colors[:]}
+	switch *FlagColoring {
+	case ColoringCode:
+	case ColoringEntropy:
+		gradient := NewGradient(*FlagPalette)
+		r.colors = gradient[:]
+	default:
+		return nil, fmt.Errorf("unknown coloring %s", *FlagColoring)
+	}
+	return r, r.Reset()
+}
+
+// Reset starts over with a new network or the model
+func (r *Repl) Reset() error {
+	net := NewFlagNet(3)
+	if r.Model != "" {
+		var err error
+		net, err = LoadNet(r.Model)
+		if err != nil {
+			return err
+		}
+	}
+	r.Net, r.Position, r.meter = net, 0, Thermometer{}
+	return nil
+}
+
+// Color colors the line
+func (r *Repl) Color(line string) {
+	data := []byte(line)
+	if len(data) == 0 {
+		return
+	}
+	Color(&r.Net, data, 0, nil, func(symbol Symbol) {
+		code := symbol.Code
+		if *FlagColoring == ColoringEntropy {
+			code = r.meter.Level(symbol.Entropy)
+		}
+		fmt.Fprint(r.Out, r.colors[code](Printable(symbol.String())))
+	})
+	fmt.Fprintln(r.Out)
+	r.Position += len(data)
+}
+
+// Meta runs a meta-command, returning false when the repl should quit
+func (r *Repl) Meta(command string) (bool, error) {
+	fields := strings.Fields(command)
+	switch fields[0] {
+	case ":window", ":w":
+		if len(fields) == 1 {
+			fmt.Fprintln(r.Out, "window", r.Net.Window())
+			return true, nil
+		}
+		window, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return true, err
+		}
+		if window < 1 || window > int64(r.Net.Samples) {
+			return true, fmt.Errorf("window %d isn't between 1 and samples %d", window, r.Net.Samples)
+		}
+		r.Net.SetWindow(window)
+		for i := range r.Net.Layers {
+			r.Net.Layers[i].SetWindow(window)
+		}
+		fmt.Fprintln(r.Out, "window", window)
+	case ":save", ":s":
+		file := *FlagCheckpoint
+		if len(fields) > 1 {
+			file = fields[1]
+		}
+		if err := r.Net.Checkpoint(r.Position).Save(file); err != nil {
+			return true, err
+		}
+		fmt.Fprintln(r.Out, "saved position", r.Position, "to", file)
+	case ":reset", ":r":
+		if err := r.Reset(); err != nil {
+			return true, err
+		}
+		fmt.Fprintln(r.Out, "reset")
+	case ":help", ":h", ":?":
+		fmt.Fprintln(r.Out, ReplHelp)
+	case ":quit", ":q":
+		return false, nil
+	default:
+		return true, fmt.Errorf("unknown meta-command %s, :help lists them", fields[0])
+	}
+	return true, nil
+}
+
+// Run reads lines from in until the end of the input or :quit
+func (r *Repl) Run(in io.Reader, prompt string) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(r.Out, prompt)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ":") && len(strings.TrimSpace(line)) > 1 {
+			more, err := r.Meta(line)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if !more {
+				return
+			}
+		} else {
+			r.Color(line)
+		}
+		fmt.Fprint(r.Out, prompt)
+	}
+	if prompt != "" {
+		fmt.Fprintln(r.Out)
+	}
+}
+
+// ReplCommand colors the lines typed by the user with a network that keeps its state between the lines
+func ReplCommand(args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	model := flags.String("model", "", "the model the repl starts from, a new network when empty")
+	flags.Parse(args)
+
+	repl, err := NewRepl(*model, os.Stdout)
+	if err != nil {
+		panic(err)
+	}
+	prompt := ""
+	if _, _, err := TerminalSize(int(os.Stdin.Fd())); err == nil {
+		prompt = "> "
+		fmt.Println("type a line to color it, :help lists the meta-commands")
+	}
+	repl.Run(os.Stdin, prompt)
+}
@@ -0,0 +1,281 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rpc is the client and server stubs of the testament grpc api defined in testament.proto.
+// The messages are encoded in the protobuf wire format by hand, so the api is compatible with
+// clients generated from testament.proto in other languages
+package rpc
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Message is a message that encodes itself in the protobuf wire format
+type Message interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// Codec is the grpc codec of the messages
+type Codec struct{}
+
+// Marshal encodes the message
+func (Codec) Marshal(v any) ([]byte, error) {
+	message, ok := v.(Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a testament message", v)
+	}
+	return message.Marshal()
+}
+
+// Unmarshal decodes the message
+func (Codec) Unmarshal(data []byte, v any) error {
+	message, ok := v.(Message)
+	if !ok {
+		return fmt.Errorf("%T is not a testament message", v)
+	}
+	return message.Unmarshal(data)
+}
+
+// Name is the name of the codec, which is the content subtype of protobuf
+func (Codec) Name() string {
+	return "proto"
+}
+
+// appendVarint appends a varint field, zero is the default and isn't appended
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendFloat appends a float field, zero is the default and isn't appended
+func appendFloat(b []byte, num protowire.Number, v float32) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, math.Float32bits(v))
+}
+
+// appendBytes appends a bytes or string field, empty is the default and isn't appended
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// decode calls field with the number and value of each field of the wire format, v is the value
+// of varint and fixed32 fields and b is the value of bytes fields. Unknown fields are skipped
+func decode(data []byte, field func(num protowire.Number, v uint64, b []byte)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		v, b := uint64(0), []byte(nil)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed32Type:
+			var fixed uint32
+			fixed, n = protowire.ConsumeFixed32(data)
+			v = uint64(fixed)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(data)
+			b = append([]byte{}, b...)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		field(num, v, b)
+	}
+	return nil
+}
+
+// ColorizeRequest is the text to color with a served model, a new network when the model is empty
+type ColorizeRequest struct {
+	Model string
+	Text  []byte
+}
+
+// Marshal encodes the request
+func (m *ColorizeRequest) Marshal() ([]byte, error) {
+	b := appendBytes(nil, 1, []byte(m.Model))
+	return appendBytes(b, 2, m.Text), nil
+}
+
+// Unmarshal decodes the request
+func (m *ColorizeRequest) Unmarshal(data []byte) error {
+	*m = ColorizeRequest{}
+	return decode(data, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Model = string(b)
+		case 2:
+			m.Text = b
+		}
+	})
+}
+
+// Code is the code of a colored symbol
+type Code struct {
+	Position int64
+	Symbol   uint32
+	Code     int32
+	Entropy  float32
+	Label    int32
+}
+
+// Marshal encodes the code
+func (m *Code) Marshal() ([]byte, error) {
+	b := appendVarint(nil, 1, uint64(m.Position))
+	b = appendVarint(b, 2, uint64(m.Symbol))
+	b = appendVarint(b, 3, uint64(int64(m.Code)))
+	b = appendFloat(b, 4, m.Entropy)
+	return appendVarint(b, 5, uint64(int64(m.Label))), nil
+}
+
+// Unmarshal decodes the code
+func (m *Code) Unmarshal(data []byte) error {
+	*m = Code{}
+	return decode(data, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Position = int64(v)
+		case 2:
+			m.Symbol = uint32(v)
+		case 3:
+			m.Code = int32(v)
+		case 4:
+			m.Entropy = math.Float32frombits(uint32(v))
+		case 5:
+			m.Label = int32(v)
+		}
+	})
+}
+
+// WanderRequest is the text to wander with a served model, a new network when the model is empty
+type WanderRequest struct {
+	Model string
+	Text  []byte
+}
+
+// Marshal encodes the request
+func (m *WanderRequest) Marshal() ([]byte, error) {
+	b := appendBytes(nil, 1, []byte(m.Model))
+	return appendBytes(b, 2, m.Text), nil
+}
+
+// Unmarshal decodes the request
+func (m *WanderRequest) Unmarshal(data []byte) error {
+	*m = WanderRequest{}
+	return decode(data, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Model = string(b)
+		case 2:
+			m.Text = b
+		}
+	})
+}
+
+// Step is a jump to the position addressed by the code
+type Step struct {
+	Position int64
+	Code     int32
+	Token    []byte
+}
+
+// Marshal encodes the step
+func (m *Step) Marshal() ([]byte, error) {
+	b := appendVarint(nil, 1, uint64(m.Position))
+	b = appendVarint(b, 2, uint64(int64(m.Code)))
+	return appendBytes(b, 3, m.Token), nil
+}
+
+// Unmarshal decodes the step
+func (m *Step) Unmarshal(data []byte) error {
+	*m = Step{}
+	return decode(data, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Position = int64(v)
+		case 2:
+			m.Code = int32(v)
+		case 3:
+			m.Token = b
+		}
+	})
+}
+
+// GenerateRequest primes a served model, a new network when the model is empty, and generates count symbols
+// of the alphabet, the alphabet of the prime when empty
+type GenerateRequest struct {
+	Model    string
+	Alphabet []byte
+	Prime    []byte
+	Count    int32
+}
+
+// Marshal encodes the request
+func (m *GenerateRequest) Marshal() ([]byte, error) {
+	b := appendBytes(nil, 1, []byte(m.Model))
+	b = appendBytes(b, 2, m.Alphabet)
+	b = appendBytes(b, 3, m.Prime)
+	return appendVarint(b, 4, uint64(int64(m.Count))), nil
+}
+
+// Unmarshal decodes the request
+func (m *GenerateRequest) Unmarshal(data []byte) error {
+	*m = GenerateRequest{}
+	return decode(data, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Model = string(b)
+		case 2:
+			m.Alphabet = b
+		case 3:
+			m.Prime = b
+		case 4:
+			m.Count = int32(v)
+		}
+	})
+}
+
+// Generated is a generated symbol
+type Generated struct {
+	Symbol uint32
+	Code   int32
+}
+
+// Marshal encodes the generated symbol
+func (m *Generated) Marshal() ([]byte, error) {
+	b := appendVarint(nil, 1, uint64(m.Symbol))
+	return appendVarint(b, 2, uint64(int64(m.Code))), nil
+}
+
+// Unmarshal decodes the generated symbol
+func (m *Generated) Unmarshal(data []byte) error {
+	*m = Generated{}
+	return decode(data, func(num protowire.Number, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Symbol = uint32(v)
+		case 2:
+			m.Code = int32(v)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// roundTrip encodes the message and decodes it into decoded with the codec
+func roundTrip(t *testing.T, message, decoded Message) {
+	t.Helper()
+	codec := Codec{}
+	data, err := codec.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(message, decoded) {
+		t.Fatalf("got %+v, want %+v", decoded, message)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	roundTrip(t, &ColorizeRequest{Model: "model.bin", Text: []byte("in the beginning")}, &ColorizeRequest{})
+	roundTrip(t, &WanderRequest{Model: "model.bin", Text: []byte("in the beginning")}, &WanderRequest{})
+	for _, value := range []int32{0, 1, -1, math.MaxInt32, math.MinInt32} {
+		roundTrip(t, &Code{Position: 1 << 40, Symbol: 'x', Code: value, Entropy: 1.5, Label: value}, &Code{})
+		roundTrip(t, &Step{Position: 7, Code: value, Token: []byte("token")}, &Step{})
+		roundTrip(t, &GenerateRequest{Model: "model.bin", Alphabet: []byte("ab"), Prime: []byte("a"), Count: value}, &GenerateRequest{})
+		roundTrip(t, &Generated{Symbol: 0x10ffff, Code: value}, &Generated{})
+	}
+}
+
+// TestWire checks the encoding against the protobuf wire format of testament.proto, where a negative
+// int32 is a sign extended ten byte varint
+func TestWire(t *testing.T) {
+	code := &Code{Position: 3, Symbol: 'a', Code: -2, Entropy: .25, Label: -1}
+	var want []byte
+	want = protowire.AppendTag(want, 1, protowire.VarintType)
+	want = protowire.AppendVarint(want, 3)
+	want = protowire.AppendTag(want, 2, protowire.VarintType)
+	want = protowire.AppendVarint(want, 'a')
+	want = protowire.AppendTag(want, 3, protowire.VarintType)
+	want = protowire.AppendVarint(want, math.MaxUint64-1)
+	want = protowire.AppendTag(want, 4, protowire.Fixed32Type)
+	want = protowire.AppendFixed32(want, math.Float32bits(.25))
+	want = protowire.AppendTag(want, 5, protowire.VarintType)
+	want = protowire.AppendVarint(want, math.MaxUint64)
+	got, err := code.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+
+	generated := Generated{}
+	if err := generated.Unmarshal(protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), math.MaxUint64-6)); err != nil {
+		t.Fatal(err)
+	}
+	if generated.Code != -7 {
+		t.Fatalf("got code %d, want -7", generated.Code)
+	}
+}
+
+// TestUnknown checks unknown fields of a newer schema are skipped
+func TestUnknown(t *testing.T) {
+	data := protowire.AppendTag(nil, 9, protowire.BytesType)
+	data = protowire.AppendBytes(data, []byte("unknown"))
+	data = protowire.AppendTag(data, 2, protowire.VarintType)
+	data = protowire.AppendVarint(data, 5)
+	step := Step{}
+	if err := step.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if step.Code != 5 {
+		t.Fatalf("got code %d, want 5", step.Code)
+	}
+}
+
+func TestCodecRejects(t *testing.T) {
+	if _, err := (Codec{}).Marshal("not a message"); err == nil {
+		t.Fatal("expected an error for a value that is not a message")
+	}
+	if err := (Codec{}).Unmarshal([]byte{0xff}, &Step{}); err == nil {
+		t.Fatal("expected an error for a truncated message")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// TestamentServer is the server of the testament service
+type TestamentServer interface {
+	// Colorize colors the text, streaming the code of each symbol
+	Colorize(*ColorizeRequest, grpc.ServerStreamingServer[Code]) error
+	// Wander follows the output codes of the network around the text, streaming each jump
+	Wander(*WanderRequest, grpc.ServerStreamingServer[Step]) error
+	// Generate primes the network and then streams the generated symbols
+	Generate(*GenerateRequest, grpc.ServerStreamingServer[Generated]) error
+}
+
+// TestamentClient is the client of the testament service
+type TestamentClient interface {
+	// Colorize colors the text, streaming the code of each symbol
+	Colorize(ctx context.Context, in *ColorizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Code], error)
+	// Wander follows the output codes of the network around the text, streaming each jump
+	Wander(ctx context.Context, in *WanderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Step], error)
+	// Generate primes the network and then streams the generated symbols
+	Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Generated], error)
+}
+
+// handler is the stream handler of a server streaming method
+func handler[Req any, Res any, PReq interface {
+	*Req
+	Message
+}](method func(TestamentServer, PReq, grpc.ServerStreamingServer[Res]) error) grpc.StreamHandler {
+	return func(srv any, stream grpc.ServerStream) error {
+		in := PReq(new(Req))
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		return method(srv.(TestamentServer), in, &grpc.GenericServerStream[Req, Res]{ServerStream: stream})
+	}
+}
+
+// ServiceDesc is the grpc description of the testament service
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "testament.Testament",
+	HandlerType: (*TestamentServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Colorize",
+			Handler:       handler(TestamentServer.Colorize),
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Wander",
+			Handler:       handler(TestamentServer.Wander),
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Generate",
+			Handler:       handler(TestamentServer.Generate),
+			ServerStreams: true,
+		},
+	},
+	Metadata: "testament.proto",
+}
+
+// NewServer makes a grpc server that encodes with the codec of the messages
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	return grpc.NewServer(append([]grpc.ServerOption{grpc.ForceServerCodec(Codec{})}, opts...)...)
+}
+
+// RegisterTestamentServer registers the implementation of the testament service with a server made by NewServer
+func RegisterTestamentServer(s grpc.ServiceRegistrar, srv TestamentServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+type testamentClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewTestamentClient makes a client of the testament service
+func NewTestamentClient(cc grpc.ClientConnInterface) TestamentClient {
+	return &testamentClient{cc: cc}
+}
+
+// stream sends the request of a server streaming method, returning the stream of responses
+func stream[Req any, Res any](ctx context.Context, cc grpc.ClientConnInterface, desc *grpc.StreamDesc,
+	method string, in *Req, opts []grpc.CallOption) (grpc.ServerStreamingClient[Res], error) {
+	s, err := cc.NewStream(ctx, desc, method, append([]grpc.CallOption{grpc.ForceCodec(Codec{})}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Req, Res]{ClientStream: s}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Colorize colors the text, streaming the code of each symbol
+func (c *testamentClient) Colorize(ctx context.Context, in *ColorizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Code], error) {
+	return stream[ColorizeRequest, Code](ctx, c.cc, &ServiceDesc.Streams[0], "/testament.Testament/Colorize", in, opts)
+}
+
+// Wander follows the output codes of the network around the text, streaming each jump
+func (c *testamentClient) Wander(ctx context.Context, in *WanderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Step], error) {
+	return stream[WanderRequest, Step](ctx, c.cc, &ServiceDesc.Streams[1], "/testament.Testament/Wander", in, opts)
+}
+
+// Generate primes the network and then streams the generated symbols
+func (c *testamentClient) Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Generated], error) {
+	return stream[GenerateRequest, Generated](ctx, c.cc, &ServiceDesc.Streams[2], "/testament.Testament/Generate", in, opts)
+}
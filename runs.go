@@ -0,0 +1,266 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FlagRuns is the directory experiment runs are recorded in
+var FlagRuns = flag.String("runs", "", "directory each run records its manifest and metrics in")
+
+// Manifest describes the configuration of a run
+type Manifest struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Flags       map[string]string `json:"flags"`
+	Inputs      map[string]string `json:"inputs"`
+	Version     string            `json:"version"`
+	Key         string            `json:"key"`
+	Start       time.Time         `json:"start"`
+	Duration    float64           `json:"duration"`
+	Interrupted bool              `json:"interrupted,omitempty"`
+	Artifacts   []Artifact        `json:"artifacts,omitempty"`
+	OutputFlags []string          `json:"output_flags,omitempty"`
+}
+
+// Run is an experiment run recorded in its own directory
+type Run struct {
+	Dir      string             `json:"-"`
+	Manifest Manifest           `json:"manifest"`
+	Metrics  map[string]float64 `json:"metrics"`
+	release  func()
+}
+
+// CurrentRun is the run being recorded, nil when runs aren't recorded
+var CurrentRun *Run
+
+// StartRun starts recording a run of the command if the runs directory is set,
+// returning true if the output of an identical run was reused in place of running the command
+func StartRun(args []string) bool {
+	if *FlagRuns == "" {
+		return false
+	}
+	start := time.Now()
+	run := &Run{
+		Dir: filepath.Join(*FlagRuns, fmt.Sprintf("%s-%s", start.Format("20060102-150405.000"), args[0])),
+		Manifest: Manifest{
+			Command: args[0],
+			Args:    args[1:],
+			Flags:   make(map[string]string),
+			Start:   start,
+		},
+		Metrics: make(map[string]float64),
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		run.Manifest.Flags[f.Name] = f.Value.String()
+	})
+	run.Manifest.Inputs = Inputs(run.Manifest.Flags, run.Manifest.Args, OutputFlags)
+	run.Manifest.Version = Version()
+	if *FlagReuse && !*FlagResume && Reuse(run.Manifest) {
+		return true
+	}
+	if err := os.MkdirAll(run.Dir, 0755); err != nil {
+		panic(err)
+	}
+	run.Capture()
+	CurrentRun = run
+	return false
+}
+
+// Metric records a metric of the current run, values that aren't finite aren't recorded
+func Metric(name string, value float64) {
+	if CurrentRun != nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+		CurrentRun.Metrics[name] = value
+	}
+}
+
+// FinishRun writes the manifest and metrics of the current run
+func FinishRun() {
+	if CurrentRun == nil {
+		return
+	}
+	CurrentRun.Manifest.Duration = time.Since(CurrentRun.Manifest.Start).Seconds()
+	CurrentRun.Store(append([]string{}, CurrentRun.Manifest.Args...))
+	// the output flags of the command are registered by now, the files they name are left out of the inputs
+	// which keep their checksums from the start of the run
+	inputs := Inputs(CurrentRun.Manifest.Flags, CurrentRun.Manifest.Args, CurrentRun.Manifest.Outputs())
+	for file := range inputs {
+		if checksum, ok := CurrentRun.Manifest.Inputs[file]; ok {
+			inputs[file] = checksum
+		}
+	}
+	CurrentRun.Manifest.Inputs = inputs
+	CurrentRun.Manifest.Key = CurrentRun.Manifest.Hash()
+	write := func(name string, value interface{}) {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(filepath.Join(CurrentRun.Dir, name), data, 0644); err != nil {
+			panic(err)
+		}
+	}
+	write("manifest.json", CurrentRun.Manifest)
+	write("metrics.json", CurrentRun.Metrics)
+}
+
+// LoadRuns loads the runs recorded in a directory ordered by start time
+func LoadRuns(dir string) ([]Run, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	runs := []Run{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		run := Run{Dir: filepath.Join(dir, entry.Name())}
+		data, err := os.ReadFile(filepath.Join(run.Dir, "manifest.json"))
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(data, &run.Manifest); err != nil {
+			return nil, fmt.Errorf("%s: %v", run.Dir, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(run.Dir, "metrics.json")); err == nil {
+			if err := json.Unmarshal(data, &run.Metrics); err != nil {
+				return nil, fmt.Errorf("%s: %v", run.Dir, err)
+			}
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Manifest.Start.Before(runs[j].Manifest.Start)
+	})
+	return runs, nil
+}
+
+//go:embed ui/dashboard.html
+var dashboard string
+
+// DashboardTemplate is the template of the runs dashboard
+var DashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"metric": func(m map[string]float64, key string) string {
+		if value, ok := m[key]; ok {
+			return fmt.Sprintf("%.6g", value)
+		}
+		return ""
+	},
+}).Parse(dashboard))
+
+// Series is the values of a metric over the runs
+type Series struct {
+	Name   string
+	Points string
+	Low    float64
+	High   float64
+}
+
+// Dashboard is the data of the runs dashboard
+type Dashboard struct {
+	Dir     string
+	Runs    []Run
+	Flags   []string
+	Metrics []string
+	Series  []Series
+}
+
+// NewDashboard aggregates the runs, keeping the flags that differ between them
+func NewDashboard(dir string, runs []Run) Dashboard {
+	d := Dashboard{Dir: dir, Runs: runs}
+	values, metrics := make(map[string]map[string]bool), make(map[string]bool)
+	for _, run := range runs {
+		for name, value := range run.Manifest.Flags {
+			if values[name] == nil {
+				values[name] = make(map[string]bool)
+			}
+			values[name][value] = true
+		}
+		for name := range run.Metrics {
+			metrics[name] = true
+		}
+	}
+	for name, set := range values {
+		if len(set) > 1 && name != "runs" && name != "reuse" {
+			d.Flags = append(d.Flags, name)
+		}
+	}
+	for name := range metrics {
+		d.Metrics = append(d.Metrics, name)
+	}
+	sort.Strings(d.Flags)
+	sort.Strings(d.Metrics)
+	for _, name := range d.Metrics {
+		series := Series{Name: name, Low: 0, High: 0}
+		first := true
+		for _, run := range runs {
+			if value, ok := run.Metrics[name]; ok {
+				if first || value < series.Low {
+					series.Low = value
+				}
+				if first || value > series.High {
+					series.High = value
+				}
+				first = false
+			}
+		}
+		for i, run := range runs {
+			value, ok := run.Metrics[name]
+			if !ok {
+				continue
+			}
+			x, y := 0.0, 20.0
+			if len(runs) > 1 {
+				x = 200 * float64(i) / float64(len(runs)-1)
+			}
+			if series.High > series.Low {
+				y = 40 - 40*(value-series.Low)/(series.High-series.Low)
+			}
+			series.Points += fmt.Sprintf("%.1f,%.1f ", x, y)
+		}
+		d.Series = append(d.Series, series)
+	}
+	return d
+}
+
+// ReportCommand renders a static html dashboard comparing the runs of a directory
+func ReportCommand(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	output := OutputFlag(flags, "o", "dashboard.html", "the html file to write")
+	flags.Parse(args)
+	dir := *FlagRuns
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	if dir == "" {
+		dir = "runs"
+	}
+
+	runs, err := LoadRuns(dir)
+	if err != nil {
+		panic(err)
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	err = DashboardTemplate.Execute(out, NewDashboard(dir, runs))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("wrote dashboard of %d runs to %s\n", len(runs), *output)
+}
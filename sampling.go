@@ -0,0 +1,184 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	// WeightsBinary binarizes the sampled weights to ±1
+	WeightsBinary = "binary"
+	// WeightsContinuous keeps the gaussian value of the sampled weights
+	WeightsContinuous = "continuous"
+	// WeightsTernary zeroes the sampled weights with the probability of the sparsity and binarizes the rest to ±1
+	WeightsTernary = "ternary"
+	// TemperatureStochastic samples the sign of each weight with the probability of the sigmoid of the weight over the temperature
+	TemperatureStochastic = "stochastic"
+	// TemperatureContinuous maps each weight to the continuous value of the scaled sigmoid of the weight over the temperature
+	TemperatureContinuous = "continuous"
+)
+
+var (
+	// FlagWeights is how the sampled weights are quantized
+	FlagWeights = flag.String("weights", WeightsBinary, "how the sampled weights are quantized: binary, continuous or ternary")
+	// FlagSparsity is the probability of a sampled weight being zero with ternary weights
+	FlagSparsity = flag.Float64("sparsity", .5, "probability of a sampled weight being zero with ternary weights")
+	// FlagTemperature is the temperature of the binarization of the sampled weights
+	FlagTemperature = flag.Float64("temperature", 0, "temperature of the binarization of the sampled weights, 0 thresholds the weights to ±1")
+	// FlagTemperatureMode is how the temperature softens the binarization
+	FlagTemperatureMode = flag.String("temperature-mode", TemperatureStochastic, "how the temperature softens the binarization: stochastic or continuous")
+)
+
+// Sampling is how the sampled weights are quantized
+type Sampling struct {
+	// Weights is how the sampled weights are quantized, binary when empty
+	Weights string
+	// Temperature softens the threshold of the weights, 0 thresholds hard
+	Temperature float32
+	// Continuous maps the weights to continuous values in place of sampling their signs
+	Continuous bool
+	// Sparsity is the probability of a weight being zero with ternary weights
+	Sparsity float32
+}
+
+// NewFlagSampling makes the sampling configured by the command line flags
+func NewFlagSampling() Sampling {
+	if *FlagWeights != WeightsBinary && *FlagWeights != WeightsContinuous && *FlagWeights != WeightsTernary {
+		panic(fmt.Errorf("unknown weights %s", *FlagWeights))
+	}
+	if *FlagSparsity < 0 || *FlagSparsity >= 1 {
+		panic(fmt.Errorf("sparsity %f is not in [0, 1)", *FlagSparsity))
+	}
+	if *FlagTemperatureMode != TemperatureStochastic && *FlagTemperatureMode != TemperatureContinuous {
+		panic(fmt.Errorf("unknown temperature mode %s", *FlagTemperatureMode))
+	}
+	return Sampling{
+		Weights:     *FlagWeights,
+		Temperature: float32(*FlagTemperature),
+		Continuous:  *FlagTemperatureMode == TemperatureContinuous,
+		Sparsity:    float32(*FlagSparsity),
+	}
+}
+
+// Quantize quantizes a sampled weight
+func (s Sampling) Quantize(rng *rand.Rand, v float32) float32 {
+	switch s.Weights {
+	case WeightsBinary, "":
+		return s.Binarize(rng, v)
+	case WeightsContinuous:
+		return v
+	case WeightsTernary:
+		if rng.Float32() < s.Sparsity {
+			return 0
+		}
+		return s.Binarize(rng, v)
+	}
+	panic(fmt.Errorf("unknown weights %s", s.Weights))
+}
+
+// Binarize binarizes a sampled weight, low temperatures explore little and high temperatures explore more
+func (s Sampling) Binarize(rng *rand.Rand, v float32) float32 {
+	if s.Temperature <= 0 {
+		if v > 0 {
+			return 1
+		}
+		return -1
+	}
+	p := float32(1 / (1 + math.Exp(-float64(v/s.Temperature))))
+	if s.Continuous {
+		return 2*p - 1
+	}
+	if rng.Float32() < p {
+		return 1
+	}
+	return -1
+}
+
+// SampleTernary samples ternary weights from the statistics into the neurons of the system. Which weights are zero is drawn
+// a byte at a time from 64 random bits, so the sparsity is quantized to 1/256, and only the nonzero weights are
+// sampled from the statistics, which makes sparse sampling cheaper than binary sampling. The indices of the nonzero
+// weights are kept in the support of the system so that the zero weights are skipped by the dot products
+func (s Set) SampleTernary(rng *rand.Rand, system *Sample, sampling Sampling) {
+	neurons := system.Neurons
+	if len(system.Support) != len(neurons) {
+		system.Support = make([][]int, len(neurons))
+	}
+	threshold, bits, count := uint64(sampling.Sparsity*256), uint64(0), 0
+	for j := range neurons {
+		support := system.Support[j][:0]
+		for k := range neurons[j].Data {
+			if count == 0 {
+				bits, count = rng.Uint64(), 8
+			}
+			zero := bits&0xff < threshold
+			bits, count = bits>>8, count-1
+			if zero {
+				neurons[j].Data[k] = 0
+				continue
+			}
+			v := float32(rng.NormFloat64())*s[j][k].StdDev + s[j][k].Mean
+			neurons[j].Data[k] = sampling.Binarize(rng, v)
+			support = append(support, k)
+		}
+		system.Support[j] = support
+	}
+}
+
+// SparseStatistics calculates the statistics of the systems with ternary weights into statistics, each weight is
+// averaged over the systems it isn't zero in so that the zeros don't shrink the statistics. The weights that are zero
+// in every system keep their previous statistics
+func (n Net) SparseStatistics(systems []Sample, statistics, previous Set, weight func(i int) float32) Set {
+	inputs, counts := len(statistics[0]), n.scratch.Counts
+	for i := range counts {
+		counts[i] = 0
+	}
+	for i := range statistics {
+		for j := range statistics[i] {
+			statistics[i][j] = Random{}
+		}
+	}
+	for i := range systems {
+		w := weight(i)
+		for j, support := range systems[i].Support {
+			data := systems[i].Neurons[j].Data
+			for _, k := range support {
+				statistics[j][k].Mean += w * data[k]
+				counts[j*inputs+k] += w
+			}
+		}
+	}
+	for j := range statistics {
+		for k := range statistics[j] {
+			if count := counts[j*inputs+k]; count > 0 {
+				statistics[j][k].Mean /= count
+			}
+		}
+	}
+	for i := range systems {
+		w := weight(i)
+		for j, support := range systems[i].Support {
+			data := systems[i].Neurons[j].Data
+			for _, k := range support {
+				diff := statistics[j][k].Mean - data[k]
+				statistics[j][k].StdDev += w * diff * diff
+			}
+		}
+	}
+	for j := range statistics {
+		for k := range statistics[j] {
+			count := counts[j*inputs+k]
+			if count == 0 {
+				statistics[j][k] = previous[j][k]
+				continue
+			}
+			statistics[j][k].StdDev = float32(math.Sqrt(float64(statistics[j][k].StdDev / count)))
+		}
+	}
+	return statistics
+}
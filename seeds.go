@@ -0,0 +1,178 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SeedRun is the result of coloring the corpus with one seed
+type SeedRun struct {
+	Seed        int64
+	Entropy     float64
+	CodeEntropy float64
+	Codes       []int
+	Consistency [256]float64
+}
+
+// NewSeedRun colors the data with a new network for the seed
+func NewSeedRun(seed int64, data []byte) SeedRun {
+	run := SeedRun{Seed: seed, Codes: make([]int, 0, len(data))}
+	net := NewSeededNet(seed, 3)
+	counts := [256][len(Colors)]int{}
+	histogram := [len(Colors)]int{}
+	Color(&net, data, 0, nil, func(symbol Symbol) {
+		run.Entropy += float64(symbol.Entropy)
+		run.Codes = append(run.Codes, symbol.Code)
+		counts[symbol.Symbol][symbol.Code]++
+		histogram[symbol.Code]++
+	})
+	run.Entropy /= float64(len(data))
+	run.CodeEntropy = Bits(histogram[:])
+	for symbol, codes := range counts {
+		total, modal := 0, 0
+		for _, count := range codes {
+			total += count
+			modal = max(modal, count)
+		}
+		if total > 0 {
+			run.Consistency[symbol] = float64(modal) / float64(total)
+		}
+	}
+	return run
+}
+
+// Bits is the entropy in bits of a histogram
+func Bits(histogram []int) float64 {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+	bits := 0.0
+	for _, count := range histogram {
+		if count > 0 {
+			p := float64(count) / float64(total)
+			bits -= p * math.Log2(p)
+		}
+	}
+	return bits
+}
+
+// NMI is the normalized mutual information between two codings of the same positions,
+// it doesn't depend on how the codes are labeled
+func NMI(a, b []int) float64 {
+	joint := make(map[[2]int]int)
+	ha, hb := [len(Colors)]int{}, [len(Colors)]int{}
+	for i := range a {
+		joint[[2]int{a[i], b[i]}]++
+		ha[a[i]]++
+		hb[b[i]]++
+	}
+	flat := make([]int, 0, len(joint))
+	for _, count := range joint {
+		flat = append(flat, count)
+	}
+	ea, eb := Bits(ha[:]), Bits(hb[:])
+	if ea == 0 || eb == 0 {
+		return 0
+	}
+	return (ea + eb - Bits(flat)) / math.Sqrt(ea*eb)
+}
+
+// MeanStd is the mean and standard deviation of the values
+func MeanStd(values []float64) (mean, std float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(values)))
+}
+
+// SeedsCommand repeats the configuration across seeds and reports how much the results depend on the seed
+func SeedsCommand(args []string) {
+	flags := flag.NewFlagSet("seeds", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	n := flags.Int("n", 20, "number of seeds")
+	top := flags.Int("top", 16, "number of bytes with the most seed dependent codes to list")
+	threshold := flags.Float64("threshold", .5, "mean normalized mutual information below which results are dominated by seed noise")
+	flags.Parse(args)
+	if *n < 2 {
+		panic(fmt.Errorf("at least 2 seeds are needed"))
+	}
+
+	data := Load(*file)
+	if len(data) == 0 {
+		return
+	}
+	runs := make([]SeedRun, *n)
+	for i := range runs {
+		runs[i] = NewSeedRun(*FlagSeed+int64(i), data)
+		fmt.Printf("seed %d entropy %f code entropy %f\n", runs[i].Seed, runs[i].Entropy, runs[i].CodeEntropy)
+	}
+
+	metric := func(name string, value func(run SeedRun) float64) {
+		values := make([]float64, len(runs))
+		for i, run := range runs {
+			values[i] = value(run)
+		}
+		mean, std := MeanStd(values)
+		fmt.Printf("%-14s mean %f std %f cv %f\n", name, mean, std, std/mean)
+		Metric(name+"_std", std)
+	}
+	fmt.Println()
+	metric("entropy", func(run SeedRun) float64 { return run.Entropy })
+	metric("code_entropy", func(run SeedRun) float64 { return run.CodeEntropy })
+
+	agreements := []float64{}
+	for i := range runs {
+		for j := i + 1; j < len(runs); j++ {
+			agreements = append(agreements, NMI(runs[i].Codes, runs[j].Codes))
+		}
+	}
+	agreement, spread := MeanStd(agreements)
+	fmt.Printf("%-14s mean %f std %f\n", "agreement", agreement, spread)
+	Metric("agreement", agreement)
+
+	type Byte struct {
+		Symbol    int
+		Mean, Std float64
+	}
+	frequency := [256]int{}
+	for _, symbol := range data {
+		frequency[symbol]++
+	}
+	bytes := []Byte{}
+	for symbol, count := range frequency {
+		if count == 0 {
+			continue
+		}
+		values := make([]float64, len(runs))
+		for i, run := range runs {
+			values[i] = run.Consistency[symbol]
+		}
+		mean, std := MeanStd(values)
+		bytes = append(bytes, Byte{symbol, mean, std})
+	}
+	sort.Slice(bytes, func(i, j int) bool {
+		return bytes[i].Std > bytes[j].Std
+	})
+	fmt.Printf("\n%6s %10s %12s %12s\n", "byte", "frequency", "consistency", "std")
+	for _, b := range bytes[:min(*top, len(bytes))] {
+		fmt.Printf("%6q %10d %12f %12f\n", rune(b.Symbol), frequency[b.Symbol], b.Mean, b.Std)
+	}
+
+	fmt.Println()
+	if agreement < *threshold {
+		fmt.Printf("codes are dominated by seed noise, agreement %f is below %f\n", agreement, *threshold)
+	} else {
+		fmt.Printf("codes are driven by the data, agreement %f is at least %f\n", agreement, *threshold)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Boundary is an inferred boundary of a segment of the corpus
+type Boundary struct {
+	// Offset is the offset of the first symbol after the boundary
+	Offset int `json:"offset"`
+	// Score is the standard score of the smoothed signal at the boundary
+	Score float64 `json:"score"`
+}
+
+// Segmentation are the boundaries inferred from a series of the corpus
+type Segmentation struct {
+	File       string     `json:"file"`
+	Series     string     `json:"series"`
+	Threshold  float64    `json:"threshold"`
+	Window     int        `json:"window"`
+	Length     int        `json:"length"`
+	Boundaries []Boundary `json:"boundaries"`
+}
+
+// Signal is the signal of the series boundaries are spikes in: the entropy, or for the codes the total variation
+// distance between the code histograms of the window before and the window from each position
+func Signal(series string, codes []int, entropies []float32, window int) []float64 {
+	signal := make([]float64, len(codes))
+	switch series {
+	case SeriesEntropy:
+		for i, entropy := range entropies {
+			signal[i] = float64(entropy)
+		}
+	case SeriesCode:
+		before, after := make(map[int]int), make(map[int]int)
+		for _, code := range codes[:min(window, len(codes))] {
+			after[code]++
+		}
+		for i := range codes {
+			if i > 0 {
+				before[codes[i-1]]++
+				if i > window {
+					before[codes[i-1-window]]--
+				}
+				after[codes[i-1]]--
+				if i+window-1 < len(codes) {
+					after[codes[i+window-1]]++
+				}
+			}
+			b, a := float64(min(i, window)), float64(min(len(codes)-i, window))
+			if b == 0 || a == 0 {
+				continue
+			}
+			distance := 0.0
+			for code := range before {
+				distance += math.Abs(float64(before[code])/b - float64(after[code])/a)
+			}
+			for code, count := range after {
+				if _, ok := before[code]; !ok {
+					distance += float64(count) / a
+				}
+			}
+			signal[i] = distance / 2
+		}
+	default:
+		panic(fmt.Errorf("unknown series %s", series))
+	}
+	return signal
+}
+
+// Smooth is the centered moving average of the signal over the window
+func Smooth(signal []float64, window int) []float64 {
+	smoothed, sums := make([]float64, len(signal)), make([]float64, len(signal)+1)
+	for i, v := range signal {
+		sums[i+1] = sums[i] + v
+	}
+	for i := range signal {
+		begin, end := max(0, i-window/2), min(len(signal), i+(window+1)/2)
+		smoothed[i] = (sums[end] - sums[begin]) / float64(end-begin)
+	}
+	return smoothed
+}
+
+// Segment infers the boundaries at the local maxima of the smoothed signal whose standard score exceeds the threshold,
+// a boundary closer than minimum to the previous boundary is dropped unless it scores higher, then it replaces it
+func Segment(signal []float64, threshold float64, window, minimum int) []Boundary {
+	smoothed := Smooth(signal, max(window, 1))
+	mean, std := MeanStd(smoothed)
+	boundaries := []Boundary{}
+	if std == 0 {
+		return boundaries
+	}
+	for i := 1; i < len(smoothed)-1; i++ {
+		if smoothed[i] < smoothed[i-1] || smoothed[i] <= smoothed[i+1] {
+			continue
+		}
+		score := (smoothed[i] - mean) / std
+		if score < threshold {
+			continue
+		}
+		boundary := Boundary{Offset: i, Score: score}
+		if last := len(boundaries) - 1; last >= 0 && i-boundaries[last].Offset < minimum {
+			if score > boundaries[last].Score {
+				boundaries[last] = boundary
+			}
+			continue
+		}
+		boundaries = append(boundaries, boundary)
+	}
+	return boundaries
+}
+
+// SegmentCommand infers the boundaries of the sentences, verses and sections of the corpus from the spikes of the entropy
+// or the changes of the codes
+func SegmentCommand(args []string) {
+	flags := flag.NewFlagSet("segment", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	series := flags.String("series", SeriesEntropy, "the series the boundaries are spikes in: entropy or code")
+	threshold := flags.Float64("threshold", 1.5, "the standard score of the smoothed series a boundary exceeds")
+	window := flags.Int("window", 8, "the width of the smoothing window, and for the code series of the histograms compared")
+	minimum := flags.Int("min", 16, "minimum distance between boundaries")
+	output := OutputFlag(flags, "o", "", "the json file the boundaries are written to, stdout when empty")
+	flags.Parse(args)
+
+	if *window < 1 || *minimum < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	data := Load(*file)
+	codes, entropies := Colorings(*model, data)
+	segmentation := Segmentation{
+		File:       *file,
+		Series:     *series,
+		Threshold:  *threshold,
+		Window:     *window,
+		Length:     len(data),
+		Boundaries: Segment(Signal(*series, codes, entropies, *window), *threshold, *window, *minimum),
+	}
+
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		out, err := os.Create(*output)
+		if err != nil {
+			panic(err)
+		}
+		defer out.Close()
+		writer = out
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(segmentation); err != nil {
+		panic(err)
+	}
+	Metric("boundaries", float64(len(segmentation.Boundaries)))
+}
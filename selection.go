@@ -0,0 +1,67 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+)
+
+const (
+	// SelectionUniform weights the samples of the window uniformly
+	SelectionUniform = "uniform"
+	// SelectionSoftmax weights the samples of the window by the softmax of their negative entropies,
+	// scaled by the standard deviation of the entropies of the window
+	SelectionSoftmax = "softmax"
+	// SelectionRank weights the samples of the window linearly by their rank
+	SelectionRank = "rank"
+)
+
+// FlagSelection is how the samples of the window are weighted in the statistics update
+var FlagSelection = flag.String("selection", SelectionUniform, "how the samples of the window are weighted in the statistics update: uniform, softmax or rank")
+
+// SelectionWeights are the normalized weights of the window of samples, which are sorted from the best entropy:
+// ascending when minimizing and descending when maximizing. The weights are nil for uniform weights
+func SelectionWeights(selection string, systems []Sample, maximize bool) []float32 {
+	switch selection {
+	case SelectionUniform, "":
+		return nil
+	case SelectionSoftmax:
+		mean, variance := 0.0, 0.0
+		for _, system := range systems {
+			mean += float64(system.Entropy)
+		}
+		mean /= float64(len(systems))
+		for _, system := range systems {
+			diff := float64(system.Entropy) - mean
+			variance += diff * diff
+		}
+		scale := math.Sqrt(variance / float64(len(systems)))
+		if scale == 0 {
+			scale = 1
+		}
+		if maximize {
+			scale = -scale
+		}
+		weights, sum := make([]float32, len(systems)), 0.0
+		for i, system := range systems {
+			w := math.Exp(-float64(system.Entropy-systems[0].Entropy) / scale)
+			weights[i] = float32(w)
+			sum += w
+		}
+		for i := range weights {
+			weights[i] /= float32(sum)
+		}
+		return weights
+	case SelectionRank:
+		weights, n := make([]float32, len(systems)), len(systems)
+		for i := range weights {
+			weights[i] = float32(2*(n-i)) / float32(n*(n+1))
+		}
+		return weights
+	}
+	panic(fmt.Errorf("unknown selection %s", selection))
+}
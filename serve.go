@@ -0,0 +1,374 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ServeFlags are the flags of the serve command
+	ServeFlags = flag.NewFlagSet("serve", flag.ExitOnError)
+	// FlagAddr is the address to serve on
+	FlagAddr = ServeFlags.String("addr", ":8080", "address to serve on")
+	// FlagWebhook is the default webhook url for completed jobs
+	FlagWebhook = ServeFlags.String("webhook", "", "webhook url notified when a job finishes or fails")
+	// FlagWebhookAllow are the other webhook urls a job may ask to be notified at
+	FlagWebhookAllow = ServeFlags.String("webhook-allow", "", "comma separated webhook urls besides -webhook that a job may name with ?webhook=")
+	// FlagWebhookSecret is the secret used to sign webhook payloads
+	FlagWebhookSecret = ServeFlags.String("webhook-secret", "", "secret for the webhook hmac signature")
+	// FlagWebhookRetries is the number of times a webhook is retried
+	FlagWebhookRetries = ServeFlags.Int("webhook-retries", 5, "number of webhook retries")
+	// FlagModels is the directory of checkpoints served as models
+	FlagModels = ServeFlags.String("models", "", "directory of checkpoints served as models")
+	// FlagFrozen serves the models frozen so that they aren't updated by the text they score
+	FlagFrozen = ServeFlags.Bool("frozen", false, "serve the models in inference only mode, the text they score doesn't update them")
+	// FlagJobTTL is how long a finished job is kept
+	FlagJobTTL = ServeFlags.Duration("job-ttl", 30*time.Minute, "how long a finished job and its symbols are kept")
+	// FlagJobs is the largest number of finished jobs
+	FlagJobs = ServeFlags.Int("jobs", 256, "largest number of finished jobs kept, the oldest is dropped")
+)
+
+//go:embed ui/index.html
+var index []byte
+
+// JobState is the state of a job
+type JobState string
+
+const (
+	// JobRunning is a running job
+	JobRunning JobState = "running"
+	// JobDone is a finished job
+	JobDone JobState = "done"
+	// JobFailed is a failed job
+	JobFailed JobState = "failed"
+)
+
+// Job is an asynchronous colorization job
+type Job struct {
+	ID       string   `json:"id"`
+	State    JobState `json:"state"`
+	Error    string   `json:"error,omitempty"`
+	Symbols  []Symbol `json:"symbols,omitempty"`
+	webhook  string
+	finished time.Time
+}
+
+// Webhook is a webhook notifier
+type Webhook struct {
+	Secret  string
+	Retries int
+	Backoff time.Duration
+	Client  *http.Client
+}
+
+// Sign computes the hmac signature of the timestamp, a dot and the payload, so that a delivery can't be replayed later
+func (w Webhook) Sign(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookAllowed is true if a job may name the url as its webhook: the -webhook url or one of the -webhook-allow urls
+func WebhookAllowed(url string) bool {
+	if url == *FlagWebhook {
+		return true
+	}
+	for _, allowed := range strings.Split(*FlagWebhookAllow, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && url == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify posts the job to the url, retrying with exponential backoff
+func (w Webhook) Notify(url string, job Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	backoff := w.Backoff
+	for i := 0; ; i++ {
+		err = w.post(url, payload)
+		if err == nil || i >= w.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w Webhook) post(url string, payload []byte) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		request.Header.Set("X-Testament-Timestamp", timestamp)
+		request.Header.Set("X-Testament-Signature", w.Sign(timestamp, payload))
+	}
+	response, err := w.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", url, response.Status)
+	}
+	return nil
+}
+
+// Jobs is the set of jobs, the finished jobs are kept for the ttl up to the limit
+type Jobs struct {
+	sync.Mutex
+	Jobs    map[string]*Job
+	Webhook Webhook
+	TTL     time.Duration
+	Limit   int
+}
+
+// NewJobs makes a new set of jobs
+func NewJobs(webhook Webhook, ttl time.Duration, limit int) *Jobs {
+	return &Jobs{
+		Jobs:    make(map[string]*Job),
+		Webhook: webhook,
+		TTL:     ttl,
+		Limit:   max(limit, 1),
+	}
+}
+
+// evict drops the finished jobs older than the ttl and then the oldest finished jobs over the limit, the jobs must be locked
+func (j *Jobs) evict(now time.Time) {
+	finished := 0
+	for id, job := range j.Jobs {
+		switch {
+		case job.State == JobRunning:
+		case now.Sub(job.finished) > j.TTL:
+			delete(j.Jobs, id)
+		default:
+			finished++
+		}
+	}
+	for ; finished > j.Limit; finished-- {
+		oldest := ""
+		for id, job := range j.Jobs {
+			if job.State != JobRunning && (oldest == "" || job.finished.Before(j.Jobs[oldest].finished)) {
+				oldest = id
+			}
+		}
+		delete(j.Jobs, oldest)
+	}
+}
+
+// Models lists the checkpoints in the models directory
+func Models() []string {
+	models := []string{}
+	if *FlagModels == "" {
+		return models
+	}
+	entries, err := os.ReadDir(*FlagModels)
+	if err != nil {
+		return models
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			models = append(models, entry.Name())
+		}
+	}
+	return models
+}
+
+// LoadModel loads the network for a named model, an empty name is a new network.
+// The model is frozen when the models are served frozen
+func LoadModel(name string) (Net, error) {
+	net := NewFlagNet(3)
+	net.Frozen = *FlagFrozen
+	if name == "" {
+		return net, nil
+	}
+	if *FlagModels == "" || name != filepath.Base(name) {
+		return net, fmt.Errorf("model %s not found", name)
+	}
+	net, err := LoadNet(filepath.Join(*FlagModels, name))
+	net.Frozen = *FlagFrozen
+	return net, err
+}
+
+// Submit starts a new job for the data, the id of the job is random so that it can't be guessed
+func (j *Jobs) Submit(net Net, data []byte, webhook string) (Job, error) {
+	id, err := NewID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:      id,
+		State:   JobRunning,
+		webhook: webhook,
+	}
+	j.Lock()
+	j.evict(time.Now())
+	j.Jobs[job.ID] = job
+	submitted := *job
+	j.Unlock()
+	go j.run(job, net, data)
+	return submitted, nil
+}
+
+func (j *Jobs) run(job *Job, net Net, data []byte) {
+	symbols, err := func() (symbols []Symbol, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		meta := AnnotateBytes(data, "job "+job.ID)
+		Color(&net, data, 0, nil, func(symbol Symbol) {
+			symbol.Meta = meta(symbol.Position)
+			symbols = append(symbols, symbol)
+		})
+		return symbols, nil
+	}()
+	j.Lock()
+	if err != nil {
+		job.State, job.Error = JobFailed, err.Error()
+	} else {
+		job.State, job.Symbols = JobDone, symbols
+	}
+	job.finished = time.Now()
+	j.evict(job.finished)
+	finished := *job
+	j.Unlock()
+	if finished.webhook != "" {
+		if err := j.Webhook.Notify(finished.webhook, finished); err != nil {
+			slog.Error("webhook failed", "job", finished.ID, "error", err)
+		}
+	}
+}
+
+// Get gets a job by id
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.Lock()
+	defer j.Unlock()
+	j.evict(time.Now())
+	job, ok := j.Jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// ServeHTTP implements the job api
+func (j *Jobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs")
+	id = strings.TrimPrefix(id, "/")
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		webhook := r.URL.Query().Get("webhook")
+		if webhook == "" {
+			webhook = *FlagWebhook
+		} else if !WebhookAllowed(webhook) {
+			http.Error(w, "webhook not allowed", http.StatusForbidden)
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, *FlagMaxBody))
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		net, err := LoadModel(r.URL.Query().Get("model"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		job, err := j.Submit(net, data, webhook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	case id != "" && r.Method == http.MethodGet:
+		job, ok := j.Get(id)
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ServeCommand serves the job api and web ui
+func ServeCommand(args []string) {
+	ServeFlags.Parse(args)
+	Serve(*FlagAddr)
+}
+
+// Serve serves the job api
+func Serve(addr string) {
+	jobs := NewJobs(Webhook{
+		Secret:  *FlagWebhookSecret,
+		Retries: *FlagWebhookRetries,
+		Backoff: time.Second,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}, *FlagJobTTL, *FlagJobs)
+	mux := http.NewServeMux()
+	mux.Handle("/jobs", jobs)
+	mux.Handle("/jobs/", jobs)
+	mux.HandleFunc("/stream", StreamHandler)
+	mux.Handle("/colorize", NewSessions(*FlagSessionTTL, *FlagSessions))
+	book := []byte(nil)
+	if *FlagLive != "" {
+		book = Load(*FlagLive)
+	}
+	mux.Handle("/live", LiveHandler(book))
+	mux.HandleFunc("/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Models())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(index)
+	})
+	if *FlagGRPC != "" {
+		go ServeGRPC(*FlagGRPC)
+	}
+	fmt.Println("serving on", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		panic(err)
+	}
+}
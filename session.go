@@ -0,0 +1,172 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// FlagSessionTTL is how long an idle session is kept
+	FlagSessionTTL = ServeFlags.Duration("session-ttl", 30*time.Minute, "how long the warm network of an idle colorize session is kept")
+	// FlagSessions is the largest number of sessions
+	FlagSessions = ServeFlags.Int("sessions", 64, "largest number of colorize sessions, the least recently used is dropped")
+	// FlagMaxBody is the largest text a colorize request or a job can send
+	FlagMaxBody = ServeFlags.Int64("max-body", 16<<20, "largest number of bytes of the text of a colorize request or a job")
+)
+
+// Session is a warm network that keeps learning across the colorize requests of a client
+type Session struct {
+	sync.Mutex
+	ID    string
+	Model string
+	Net   Net
+	Used  time.Time
+}
+
+// Sessions are the colorize sessions
+type Sessions struct {
+	sync.Mutex
+	Sessions map[string]*Session
+	TTL      time.Duration
+	Limit    int
+}
+
+// Colorized is the response of a colorize request
+type Colorized struct {
+	Session string   `json:"session"`
+	Symbols []Symbol `json:"symbols"`
+}
+
+// NewSessions makes a new set of sessions
+func NewSessions(ttl time.Duration, limit int) *Sessions {
+	return &Sessions{
+		Sessions: make(map[string]*Session),
+		TTL:      ttl,
+		Limit:    max(limit, 1),
+	}
+}
+
+// Session gets the session with the id, making a new session for the model when the id is unknown or expired.
+// The ids of the new sessions are made by the server, the model is loaded outside of the lock of the sessions
+func (s *Sessions) Session(id, model string) (*Session, error) {
+	s.Lock()
+	now := time.Now()
+	for key, session := range s.Sessions {
+		if now.Sub(session.Used) > s.TTL {
+			delete(s.Sessions, key)
+		}
+	}
+	if session, ok := s.Sessions[id]; ok {
+		defer s.Unlock()
+		if session.Model != model {
+			return nil, ErrSessionModel
+		}
+		session.Used = now
+		return session, nil
+	}
+	s.Unlock()
+
+	net, err := LoadModel(model)
+	if err != nil {
+		return nil, err
+	}
+	id, err = NewID()
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{ID: id, Model: model, Net: net, Used: time.Now()}
+	s.Lock()
+	defer s.Unlock()
+	for len(s.Sessions) >= s.Limit {
+		oldest := ""
+		for key, session := range s.Sessions {
+			if oldest == "" || session.Used.Before(s.Sessions[oldest].Used) {
+				oldest = key
+			}
+		}
+		delete(s.Sessions, oldest)
+	}
+	s.Sessions[session.ID] = session
+	return session, nil
+}
+
+// NewID makes a random id for a session or a job
+func NewID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// ErrSessionModel is returned when a session is used with a different model than it was made with
+var ErrSessionModel = errors.New("the session was made with a different model")
+
+// ServeHTTP colors the body of a post with the warm network of the session, responding with the symbols as json
+// or with a standalone html page. A delete drops the session
+func (s *Sessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id := query.Get("session")
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.Lock()
+		delete(s.Sessions, id)
+		s.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, *FlagMaxBody))
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	session, err := s.Session(id, query.Get("model"))
+	switch {
+	case err == ErrSessionModel:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	session.Lock()
+	defer session.Unlock()
+	symbols := []Symbol{}
+	Color(&session.Net, data, 0, r.Context().Done(), func(symbol Symbol) {
+		symbols = append(symbols, symbol)
+	})
+	w.Header().Set("X-Testament-Session", session.ID)
+	format := query.Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		format = FormatHTML
+	}
+	if format == FormatHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		page := NewPage(w, "session "+session.ID, PageColors(ColoringCode))
+		for _, symbol := range symbols {
+			page.Write(symbol.String(), symbol, symbol.Code)
+		}
+		page.Close()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Colorized{Session: session.ID, Symbols: symbols})
+}
@@ -0,0 +1,178 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"time"
+)
+
+// SoakSample is the state of a soak test at the end of an interval
+type SoakSample struct {
+	Elapsed    float64 `json:"elapsed"`
+	Symbols    int     `json:"symbols"`
+	Throughput float64 `json:"throughput"`
+	Heap       uint64  `json:"heap"`
+	StdDev     float64 `json:"stddev"`
+	NaN        int     `json:"nan"`
+}
+
+// SoakCheck is the result of a check of a soak test
+type SoakCheck struct {
+	Name   string `json:"name"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail"`
+}
+
+// SoakReport is the report of a soak test
+type SoakReport struct {
+	Duration float64      `json:"duration"`
+	Symbols  int          `json:"symbols"`
+	Passes   int          `json:"passes"`
+	Pass     bool         `json:"pass"`
+	Checks   []SoakCheck  `json:"checks"`
+	Samples  []SoakSample `json:"samples"`
+}
+
+// MeanStdDev is the mean standard deviation of the statistics of the Q, K and V branches, near 0 when the statistics collapse
+func (n *Net) MeanStdDev() float64 {
+	sum, count := 0.0, 0
+	for _, set := range [...]Set{n.Q, n.K, n.V} {
+		for _, row := range set {
+			for _, random := range row {
+				sum += float64(random.StdDev)
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// Check checks the samples of the soak test against the limits, the first sample is the baseline
+func (r *SoakReport) Check(growth, slowdown, collapse float64) {
+	r.Pass = true
+	add := func(name string, pass bool, format string, a ...interface{}) {
+		r.Checks = append(r.Checks, SoakCheck{Name: name, Pass: pass, Detail: fmt.Sprintf(format, a...)})
+		r.Pass = r.Pass && pass
+	}
+	if len(r.Samples) == 0 {
+		add("samples", false, "no interval completed")
+		return
+	}
+	baseline, last := r.Samples[0], r.Samples[len(r.Samples)-1]
+	nan, slowest, lowest := 0, baseline.Throughput, baseline.StdDev
+	for _, sample := range r.Samples {
+		nan += sample.NaN
+		slowest = math.Min(slowest, sample.Throughput)
+		lowest = math.Min(lowest, sample.StdDev)
+	}
+	add("nan", nan == 0, "%d nan entropies", nan)
+	limit := float64(baseline.Heap) * (1 + growth)
+	add("memory", float64(last.Heap) <= limit, "heap %d bytes, baseline %d bytes, limit %.0f bytes", last.Heap, baseline.Heap, limit)
+	add("collapse", lowest >= collapse, "lowest mean stddev %g, limit %g", lowest, collapse)
+	add("throughput", slowest >= baseline.Throughput*(1-slowdown), "slowest %.2f symbols/s, baseline %.2f symbols/s",
+		slowest, baseline.Throughput)
+}
+
+// Soak loops over the corpus for a duration monitoring for memory growth, nan entropies,
+// collapse of the statistics and throughput degradation
+func Soak(args []string) {
+	flags := flag.NewFlagSet("soak", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to loop over")
+	duration := flags.Duration("duration", time.Hour, "how long to run")
+	interval := flags.Duration("interval", time.Minute, "how often the state is sampled")
+	growth := flags.Float64("growth", .5, "largest allowed growth of the heap over the first interval")
+	slowdown := flags.Float64("slowdown", .5, "largest allowed drop of the throughput below the first interval")
+	collapse := flags.Float64("collapse", 0, "smallest allowed mean standard deviation of the statistics, binary weights converge to 0")
+	output := OutputFlag(flags, "o", "soak.json", "the json report to write")
+	flags.Parse(args)
+
+	data := Load(*file)
+	if len(data) == 0 {
+		panic(fmt.Errorf("%s is empty", *file))
+	}
+	net := NewFlagNet(3)
+	stop, interrupted := make(chan struct{}), Interrupted()
+	go func() {
+		select {
+		case <-time.After(*duration):
+		case <-interrupted:
+		}
+		close(stop)
+	}()
+
+	report := SoakReport{}
+	start, mark, symbols, nan := time.Now(), time.Now(), 0, 0
+	sample := func() {
+		runtime.GC()
+		stats := runtime.MemStats{}
+		runtime.ReadMemStats(&stats)
+		now := time.Now()
+		s := SoakSample{
+			Elapsed:    now.Sub(start).Seconds(),
+			Symbols:    symbols,
+			Throughput: float64(symbols) / now.Sub(mark).Seconds(),
+			Heap:       stats.HeapAlloc,
+			StdDev:     net.MeanStdDev(),
+			NaN:        nan,
+		}
+		report.Samples = append(report.Samples, s)
+		report.Symbols += symbols
+		fmt.Printf("%8.0fs %10.2f symbols/s heap %10d stddev %8.6f nan %d\n", s.Elapsed, s.Throughput, s.Heap, s.StdDev, s.NaN)
+		mark, symbols, nan = now, 0, 0
+	}
+loop:
+	for {
+		net.Reset()
+		Color(&net, data, 0, stop, func(symbol Symbol) {
+			symbols++
+			if math.IsNaN(float64(symbol.Entropy)) {
+				nan++
+			}
+			if time.Since(mark) >= *interval {
+				sample()
+			}
+		})
+		select {
+		case <-stop:
+			break loop
+		default:
+		}
+		report.Passes++
+	}
+	report.Duration, report.Symbols = time.Since(start).Seconds(), report.Symbols+symbols
+	report.Check(*growth, *slowdown, *collapse)
+
+	for _, check := range report.Checks {
+		result := "PASS"
+		if !check.Pass {
+			result = "FAIL"
+		}
+		fmt.Printf("%s %-10s %s\n", result, check.Name, check.Detail)
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		panic(err)
+	}
+	fmt.Printf("wrote soak report of %d symbols over %d passes to %s\n", report.Symbols, report.Passes, *output)
+	Metric("symbols", float64(report.Symbols))
+	if !report.Pass {
+		ExitStatus = 1
+	}
+}
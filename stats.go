@@ -0,0 +1,94 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// StatsCommand prints statistics of the corpus
+func StatsCommand(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	top := flags.Int("top", 16, "number of most frequent bytes to list")
+	clusters := flags.Int("clusters", 0, "number of clusters the symbols are grouped into by the distribution of their output codes, 0 for none")
+	unit := flags.String("unit", UnitByte, "the symbols that are clustered: byte, rune or word")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	minimum := flags.Int("min", 2, "minimum number of occurrences of a clustered symbol")
+	flags.Parse(args)
+
+	data := Load(*file)
+	frequency := [256]int{}
+	for _, symbol := range data {
+		frequency[symbol]++
+	}
+	symbols, entropy := []int{}, 0.0
+	for symbol, count := range frequency {
+		if count == 0 {
+			continue
+		}
+		symbols = append(symbols, symbol)
+		p := float64(count) / float64(len(data))
+		entropy -= p * math.Log2(p)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return frequency[symbols[i]] > frequency[symbols[j]]
+	})
+	fmt.Println("symbols", len(data))
+	fmt.Println("distinct", len(symbols))
+	fmt.Printf("entropy %f bits per symbol\n", entropy)
+	if *top > len(symbols) {
+		*top = len(symbols)
+	}
+	fmt.Printf("%6s %10s %8s\n", "byte", "frequency", "percent")
+	for _, symbol := range symbols[:*top] {
+		fmt.Printf("%6q %10d %7.3f%%\n", rune(symbol), frequency[symbol], 100*float64(frequency[symbol])/float64(len(data)))
+	}
+	if *clusters > 0 {
+		codes, _ := Colorings(*model, data)
+		PrintClusters(Distributions(data, codes, *unit, *minimum), *clusters)
+	}
+}
+
+// PrintClusters clusters the symbols by the distributions of their codes and prints each cluster with
+// its mean distribution of the codes, the mean hellinger distance of its symbols from it and its symbols
+func PrintClusters(distributions []Distribution, k int) {
+	assignments := Cluster(distributions, k, *FlagSeed)
+	members := make([][]Distribution, min(k, len(distributions)))
+	for i, distribution := range distributions {
+		members[assignments[i]] = append(members[assignments[i]], distribution)
+	}
+	fmt.Printf("\n%d symbols in %d clusters\n", len(distributions), len(members))
+	for c, cluster := range members {
+		if len(cluster) == 0 {
+			continue
+		}
+		mean := make([]float64, len(cluster[0].Codes))
+		for _, distribution := range cluster {
+			for code, p := range distribution.Codes {
+				mean[code] += p / float64(len(cluster))
+			}
+		}
+		spread := 0.0
+		for _, distribution := range cluster {
+			spread += Hellinger(distribution.Codes, mean) / float64(len(cluster))
+		}
+		codes := ""
+		for code, p := range mean {
+			codes += fmt.Sprintf(" %s", Colors[code%len(Colors)]("%d:%.2f", code, p))
+		}
+		fmt.Printf("cluster %d: %d symbols, spread %.3f, codes%s\n  ", c, len(cluster), spread, codes)
+		for i, distribution := range cluster {
+			if i > 0 {
+				fmt.Print(" ")
+			}
+			fmt.Printf("%q", distribution.Symbol)
+		}
+		fmt.Println()
+	}
+}
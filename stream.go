@@ -0,0 +1,164 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrStreamClosed is returned when pushing to a closed stream processor
+var ErrStreamClosed = errors.New("stream processor closed")
+
+// StreamTokenizer checks the tokenizer of the flags splits by byte, the stream processor colors the pushed data byte by byte
+func StreamTokenizer() error {
+	if *FlagToken != "byte" || *FlagRunes {
+		return fmt.Errorf("the stream is colored by byte, -token %s and -runes aren't supported", *FlagToken)
+	}
+	return nil
+}
+
+// StreamProcessor colors a stream of bytes as they are pushed. The input and the results are bounded,
+// Push blocks while the model is behind and the model blocks while the results aren't read,
+// so a producer that outpaces the model can't grow memory without bound
+type StreamProcessor struct {
+	ctx     context.Context
+	input   chan []byte
+	results chan Symbol
+	once    sync.Once
+	closed  chan struct{}
+}
+
+// NewStreamProcessor starts a stream processor coloring with the network, buffering up to buffer
+// pushes and buffer symbols. The processor stops when the context is canceled
+func NewStreamProcessor(ctx context.Context, net *Net, buffer int) *StreamProcessor {
+	s := &StreamProcessor{
+		ctx:     ctx,
+		input:   make(chan []byte, buffer),
+		results: make(chan Symbol, buffer),
+		closed:  make(chan struct{}),
+	}
+	go s.run(net)
+	return s
+}
+
+// Push queues data to be colored, blocking while the buffer is full.
+// It fails if the context is canceled or the processor is closed
+func (s *StreamProcessor) Push(data []byte) error {
+	select {
+	case <-s.closed:
+		return ErrStreamClosed
+	default:
+	}
+	select {
+	case s.input <- append([]byte{}, data...):
+		return nil
+	case <-s.closed:
+		return ErrStreamClosed
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// Close marks the end of the stream, the remaining data is colored and then the results are closed
+func (s *StreamProcessor) Close() {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+}
+
+// Results are the colored symbols, closed at the end of the stream or when the context is canceled
+func (s *StreamProcessor) Results() <-chan Symbol {
+	return s.results
+}
+
+// tokenizer splits the pushed data into bytes, blocking until data is pushed.
+// The history is the last bytes the embedding of a byte reads and the context of the network
+func (s *StreamProcessor) tokenizer(net *Net) Tokenizer {
+	keep := Embed.Reach() + net.Context
+	var data, history []byte
+	return TokenizerFunc(func() (Token, bool) {
+		for len(data) == 0 {
+			var ok bool
+			select {
+			case data, ok = <-s.input:
+			case <-s.ctx.Done():
+				return Token{}, false
+			case <-s.closed:
+				select {
+				case data, ok = <-s.input:
+				default:
+				}
+			}
+			if !ok {
+				return Token{}, false
+			}
+		}
+		symbol := data[0]
+		data = data[1:]
+		history = append(history[max(0, len(history)-keep+1):], symbol)
+		return Token{Text: ByteText[symbol], Embedding: Embed.Embed(history, len(history)-1)}, true
+	})
+}
+
+func (s *StreamProcessor) run(net *Net) {
+	defer close(s.results)
+	ColorTokens(net, s.tokenizer(net), 0, s.ctx.Done(), func(symbol Symbol) {
+		select {
+		case s.results <- symbol:
+		case <-s.ctx.Done():
+		}
+	})
+}
+
+// StreamHandler colors the body of a post as it is uploaded and streams the symbols back as json lines
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := StreamTokenizer(); err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	net, err := LoadModel(r.URL.Query().Get("model"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	http.NewResponseController(w).EnableFullDuplex()
+	stream := NewStreamProcessor(ctx, &net, 64)
+	go func() {
+		defer stream.Close()
+		buffer := make([]byte, 4096)
+		for {
+			n, err := r.Body.Read(buffer)
+			if n > 0 && stream.Push(buffer[:n]) != nil {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for symbol := range stream.Results() {
+		if err := encoder.Encode(symbol); err != nil {
+			cancel()
+			continue
+		}
+		if flusher != nil && len(stream.Results()) == 0 {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// AggregateMean scores a sentence by the mean entropy of its symbols
+	AggregateMean = "mean"
+	// AggregateMax scores a sentence by the highest entropy of its symbols
+	AggregateMax = "max"
+	// AggregateSum scores a sentence by the total entropy of its symbols, favoring long sentences
+	AggregateSum = "sum"
+)
+
+// Passage is a sentence of the corpus scored by the entropy of its symbols
+type Passage struct {
+	Index  int
+	Offset int
+	Text   string
+	Score  float64
+}
+
+// Passages splits the data into sentences and scores each by the aggregate of the entropies of its symbols,
+// the whitespace between the sentences isn't scored
+func Passages(data []byte, entropies []float32, aggregate string) []Passage {
+	passages, offset := []Passage{}, 0
+	for _, sentence := range Tokenize(NewSentenceTokenizer(string(data))) {
+		text := strings.TrimRightFunc(sentence.Text, unicode.IsSpace)
+		passage := Passage{Index: len(passages), Offset: offset, Text: text}
+		offset += len(sentence.Text)
+		if text == "" {
+			continue
+		}
+		symbols := entropies[passage.Offset : passage.Offset+len(text)]
+		switch aggregate {
+		case AggregateMean, AggregateSum:
+			for _, entropy := range symbols {
+				passage.Score += float64(entropy)
+			}
+			if aggregate == AggregateMean {
+				passage.Score /= float64(len(symbols))
+			}
+		case AggregateMax:
+			passage.Score = math.Inf(-1)
+			for _, entropy := range symbols {
+				passage.Score = math.Max(passage.Score, float64(entropy))
+			}
+		default:
+			panic(fmt.Errorf("unknown aggregate %s", aggregate))
+		}
+		passages = append(passages, passage)
+	}
+	return passages
+}
+
+// Summarize prints the most or least surprising sentences of the corpus as an extractive summary
+func Summarize(args []string) {
+	flags := flag.NewFlagSet("summarize", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	model := flags.String("model", "", "frozen model to color with, empty for a new network")
+	top := flags.Int("top", 5, "number of sentences in the summary")
+	aggregate := flags.String("aggregate", AggregateMean, "how the entropies of the symbols of a sentence are scored: mean, max or sum")
+	least := flags.Bool("least", false, "pick the least surprising sentences instead of the most surprising")
+	ordered := flags.Bool("ordered", true, "print the picked sentences in the order of the corpus instead of the order of their scores")
+	flags.Parse(args)
+	if *top < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data := Load(*file)
+	_, entropies := Colorings(*model, data)
+	passages := Passages(data, entropies, *aggregate)
+	sort.SliceStable(passages, func(i, j int) bool {
+		if *least {
+			return passages[i].Score < passages[j].Score
+		}
+		return passages[i].Score > passages[j].Score
+	})
+	passages = passages[:min(*top, len(passages))]
+	if *ordered {
+		sort.Slice(passages, func(i, j int) bool {
+			return passages[i].Index < passages[j].Index
+		})
+	}
+	for _, passage := range passages {
+		fmt.Printf("%6d %8d %f %s\n", passage.Index, passage.Offset, passage.Score, strings.Join(strings.Fields(passage.Text), " "))
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SummaryTop is the number of the most frequent symbols of each code that are listed
+const SummaryTop = 8
+
+// CodeSummary is the summary of a coloring: how often each code fired, the mean entropy of each code
+// and which symbols each code was given to
+type CodeSummary struct {
+	Count   int
+	Counts  map[int]int
+	Entropy map[int]float64
+	Symbols map[int]map[string]int
+}
+
+// NewCodeSummary makes an empty summary
+func NewCodeSummary() *CodeSummary {
+	return &CodeSummary{
+		Counts:  make(map[int]int),
+		Entropy: make(map[int]float64),
+		Symbols: make(map[int]map[string]int),
+	}
+}
+
+// Add adds a colored symbol to the summary
+func (s *CodeSummary) Add(symbol Symbol) {
+	s.Count++
+	s.Counts[symbol.Code]++
+	s.Entropy[symbol.Code] += float64(symbol.Entropy)
+	symbols := s.Symbols[symbol.Code]
+	if symbols == nil {
+		symbols = make(map[string]int)
+		s.Symbols[symbol.Code] = symbols
+	}
+	symbols[symbol.String()]++
+}
+
+// Codes are the codes that fired from the most to the least frequent
+func (s *CodeSummary) Codes() []int {
+	codes := make([]int, 0, len(s.Counts))
+	for code := range s.Counts {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if s.Counts[codes[i]] != s.Counts[codes[j]] {
+			return s.Counts[codes[i]] > s.Counts[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	return codes
+}
+
+// Top are the top most frequent symbols of the code, quoted, along with their counts
+func (s *CodeSummary) Top(code, top int) []string {
+	symbols := s.Symbols[code]
+	texts := make([]string, 0, len(symbols))
+	for text := range symbols {
+		texts = append(texts, text)
+	}
+	sort.Slice(texts, func(i, j int) bool {
+		if symbols[texts[i]] != symbols[texts[j]] {
+			return symbols[texts[i]] > symbols[texts[j]]
+		}
+		return texts[i] < texts[j]
+	})
+	listed := make([]string, 0, top)
+	for _, text := range texts[:min(top, len(texts))] {
+		listed = append(listed, fmt.Sprintf("%s:%d", strconv.Quote(text), symbols[text]))
+	}
+	return listed
+}
+
+// Write writes the summary as a table with a row per code, colored by the colors of the codes
+func (s *CodeSummary) Write(w io.Writer, colors []func(format string, a ...interface{}) string) {
+	fmt.Fprintf(w, "\n%6s %10s %8s %10s %s\n", "code", "count", "percent", "entropy", "symbols")
+	for _, code := range s.Codes() {
+		count := s.Counts[code]
+		fmt.Fprintf(w, "%s %10d %7.3f%% %10f %s\n", colors[code]("%6d", code), count, 100*float64(count)/float64(s.Count),
+			s.Entropy[code]/float64(count), strings.Join(s.Top(code, SummaryTop), " "))
+	}
+}
+
+// WriteCSV writes the summary to a csv file with a row per code
+func (s *CodeSummary) WriteCSV(file string) {
+	rows := [][]string{}
+	for _, code := range s.Codes() {
+		count := s.Counts[code]
+		rows = append(rows, []string{strconv.Itoa(code), strconv.Itoa(count),
+			strconv.FormatFloat(float64(count)/float64(s.Count), 'g', -1, 64),
+			strconv.FormatFloat(s.Entropy[code]/float64(count), 'g', -1, 64),
+			strings.Join(s.Top(code, SummaryTop), " ")})
+	}
+	WriteCSV(file, []string{"code", "count", "fraction", "entropy", "symbols"}, rows)
+}
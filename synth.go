@@ -0,0 +1,167 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Synthetic is a corpus with known structure, each symbol is labeled with the structure it belongs to
+type Synthetic struct {
+	Data   []byte
+	Labels []int
+}
+
+// Generators generate synthetic corpora of length symbols, labels are less than 8
+var Generators = map[string]func(rng *rand.Rand, length int) Synthetic{
+	"periodic": func(rng *rand.Rand, length int) Synthetic {
+		pattern := []byte("abcdefg")
+		rng.Shuffle(len(pattern), func(i, j int) {
+			pattern[i], pattern[j] = pattern[j], pattern[i]
+		})
+		s := Synthetic{}
+		for i := 0; i < length; i++ {
+			s.Data = append(s.Data, pattern[i%len(pattern)])
+			s.Labels = append(s.Labels, i%len(pattern))
+		}
+		return s
+	},
+	"brackets": func(rng *rand.Rand, length int) Synthetic {
+		s, depth := Synthetic{}, 0
+		for len(s.Data) < length {
+			switch r := rng.Float64(); {
+			case depth < 7 && r < .3:
+				depth++
+				s.Data = append(s.Data, '(')
+			case depth > 0 && r < .6:
+				s.Data = append(s.Data, ')')
+				depth--
+			default:
+				s.Data = append(s.Data, byte('a'+rng.Intn(4)))
+			}
+			s.Labels = append(s.Labels, depth)
+		}
+		return s
+	},
+	"markov": func(rng *rand.Rand, length int) Synthetic {
+		const order, alphabet = 2, 4
+		states := 1
+		for i := 0; i < order; i++ {
+			states *= alphabet
+		}
+		next := make([][]float64, states)
+		for i := range next {
+			next[i] = make([]float64, alphabet)
+			sum := 0.0
+			for j := range next[i] {
+				next[i][j] = rng.ExpFloat64() * rng.ExpFloat64()
+				sum += next[i][j]
+			}
+			for j := range next[i] {
+				next[i][j] /= sum
+			}
+		}
+		s, state := Synthetic{}, 0
+		for i := 0; i < length; i++ {
+			r, symbol := rng.Float64(), 0
+			for symbol < alphabet-1 && r > next[state][symbol] {
+				r -= next[state][symbol]
+				symbol++
+			}
+			s.Data = append(s.Data, byte('a'+symbol))
+			s.Labels = append(s.Labels, state%8)
+			state = (state*alphabet + symbol) % states
+		}
+		return s
+	},
+	"interleaved": func(rng *rand.Rand, length int) Synthetic {
+		languages := []string{"aeiou", "xyzqk"}
+		s := Synthetic{}
+		for len(s.Data) < length {
+			language := rng.Intn(len(languages))
+			words := 1 + rng.Intn(8)
+			for i := 0; i < words; i++ {
+				letters := 2 + rng.Intn(6)
+				for j := 0; j < letters; j++ {
+					s.Data = append(s.Data, languages[language][rng.Intn(len(languages[language]))])
+					s.Labels = append(s.Labels, language)
+				}
+				s.Data = append(s.Data, ' ')
+				s.Labels = append(s.Labels, language)
+			}
+			s.Data = append(s.Data, '.', '\n')
+			s.Labels = append(s.Labels, language, language)
+		}
+		s.Data, s.Labels = s.Data[:length], s.Labels[:length]
+		return s
+	},
+}
+
+// GeneratorNames are the sorted names of the generators
+func GeneratorNames() []string {
+	names := make([]string, 0, len(Generators))
+	for name := range Generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check checks that the codes carry information about the labels by comparing their normalized
+// mutual information with that of shuffled labels
+func (s Synthetic) Check(rng *rand.Rand, codes []int, shuffles int) (nmi, shuffled float64, ok bool) {
+	nmi = NMI(codes, s.Labels)
+	labels := append([]int{}, s.Labels...)
+	for i := 0; i < shuffles; i++ {
+		rng.Shuffle(len(labels), func(i, j int) {
+			labels[i], labels[j] = labels[j], labels[i]
+		})
+		shuffled = max(shuffled, NMI(codes, labels))
+	}
+	return nmi, shuffled, nmi > shuffled
+}
+
+// SynthCommand generates a synthetic corpus with known structure and checks the network discovers it
+func SynthCommand(args []string) {
+	flags := flag.NewFlagSet("synth", flag.ExitOnError)
+	kind := flags.String("kind", "periodic", "kind of corpus: "+strings.Join(GeneratorNames(), ", "))
+	length := flags.Int("n", 4096, "number of symbols")
+	output := OutputFlag(flags, "o", "", "file the corpus is written to")
+	check := flags.Bool("check", true, "check the codes carry information about the known structure")
+	shuffles := flags.Int("shuffles", 8, "number of shuffled labelings the check compares against")
+	flags.Parse(args)
+
+	generator, ok := Generators[*kind]
+	if !ok {
+		panic(fmt.Errorf("unknown kind %s", *kind))
+	}
+	rng := rand.New(rand.NewSource(*FlagSeed))
+	synthetic := generator(rng, *length)
+	if *output != "" {
+		if err := os.WriteFile(*output, synthetic.Data, 0644); err != nil {
+			panic(err)
+		}
+		fmt.Printf("wrote %d symbols of %s to %s\n", len(synthetic.Data), *kind, *output)
+	}
+	if !*check {
+		return
+	}
+	codes, _ := Colorings("", synthetic.Data)
+	nmi, shuffled, ok := synthetic.Check(rng, codes, *shuffles)
+	Metric("nmi", nmi)
+	result := "PASS"
+	if !ok {
+		result = "FAIL"
+	}
+	fmt.Printf("%s %s: nmi of codes and structure %f, best shuffled %f\n", result, *kind, nmi, shuffled)
+	if !ok {
+		ExitStatus = 1
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// ErrTerminal is returned when the terminal can't be controlled on the platform
+var ErrTerminal = errors.New("the terminal can't be put into raw mode on this platform")
+
+// MakeRaw puts the terminal into raw mode, returning a function that restores it
+func MakeRaw(fd int) (func(), error) {
+	return nil, ErrTerminal
+}
+
+// TerminalSize is the width and height of the terminal
+func TerminalSize(fd int) (width, height int, err error) {
+	return 0, 0, ErrTerminal
+}
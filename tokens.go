@@ -0,0 +1,424 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/pointlander/matrix"
+	"github.com/pointlander/testament/bpe"
+)
+
+var (
+	// FlagToken is the tokenizer the corpus is split with
+	FlagToken = flag.String("token", "byte", "tokenizer the corpus is split with: "+strings.Join(TokenizerNames(), ", "))
+	// FlagVocab is the byte pair encoding vocabulary
+	FlagVocab = flag.String("vocab", "vocab.json", "byte pair encoding vocabulary for -token bpe")
+	// FlagRunes processes the corpus as unicode runes instead of bytes, the same as -token rune
+	FlagRunes = flag.Bool("runes", false, "process the corpus as unicode runes instead of bytes, the same as -token rune")
+)
+
+// Token is a unit of the corpus
+type Token struct {
+	// Text is the printable text of the token
+	Text string
+	// Embedding is the embedding of the token
+	Embedding []float32
+	// Meta is the metadata of the position of the token
+	Meta Meta
+	// Offset is the byte of the file the token begins at
+	Offset int
+}
+
+// Tokenizer splits a corpus into tokens
+type Tokenizer interface {
+	// Next returns the next token, false at the end of the corpus
+	Next() (Token, bool)
+}
+
+// TokenizerFunc adapts a function to a tokenizer
+type TokenizerFunc func() (Token, bool)
+
+// Next returns the next token
+func (t TokenizerFunc) Next() (Token, bool) {
+	return t()
+}
+
+// Tokenizers are the tokenizers by name, each makes a tokenizer of a file
+var Tokenizers = map[string]func(file string) Tokenizer{
+	"byte": func(file string) Tokenizer {
+		data, begin := LoadAt(file)
+		return Shift(NewByteTokenizer(data), begin)
+	},
+	"rune": func(file string) Tokenizer {
+		data, begin := LoadRawAt(file)
+		return Shift(NewRuneTokenizer(string(data)), begin)
+	},
+	"word": func(file string) Tokenizer {
+		data, begin := LoadRawAt(file)
+		return Shift(NewWordTokenizer(string(data)), begin)
+	},
+	"sentence": func(file string) Tokenizer {
+		data, begin := LoadRawAt(file)
+		return Shift(NewSentenceTokenizer(string(data)), begin)
+	},
+	"bpe": func(file string) Tokenizer {
+		vocab, err := bpe.Load(*FlagVocab)
+		if err != nil {
+			panic(err)
+		}
+		data, begin := LoadAt(file)
+		return Shift(NewBPETokenizer(vocab, data), begin)
+	},
+}
+
+// TokenizerNames are the sorted names of the tokenizers
+func TokenizerNames() []string {
+	names := make([]string, 0, len(Tokenizers))
+	for name := range Tokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewTokenizer makes the tokenizer selected by the flags for a file
+func NewTokenizer(file string) Tokenizer {
+	name := *FlagToken
+	if *FlagRunes {
+		name = "rune"
+	}
+	tokenizer, ok := Tokenizers[name]
+	if !ok {
+		panic(fmt.Errorf("unknown tokenizer %s", name))
+	}
+	return Annotate(tokenizer(file), file)
+}
+
+// TextEmbeddings are the embeddings of the texts seen so far
+var TextEmbeddings = struct {
+	sync.Mutex
+	Embeddings map[string][]float32
+}{
+	Embeddings: make(map[string][]float32),
+}
+
+// TextEmbedding is the embedding of a text keyed on its utf-8 bytes, single ascii characters match the byte embeddings.
+// With a transliteration the text is transliterated to ascii before it is hashed, a pretrained embedding of the text is used instead of the hash
+func TextEmbedding(text string) []float32 {
+	if t := CurrentTransliteration(); t != nil {
+		text = t.Transliterate(text)
+	}
+	TextEmbeddings.Lock()
+	defer TextEmbeddings.Unlock()
+	embedding, ok := TextEmbeddings.Embeddings[text]
+	if !ok && len(text) == 1 {
+		embedding, ok = PretrainedByte(text[0])
+	}
+	if !ok {
+		embedding, ok = PretrainedEmbedding(text)
+	}
+	if !ok {
+		embedding = Hashed(fnv.New32(), []byte(text), *FlagSize)
+		TextEmbeddings.Embeddings[text] = embedding
+	}
+	return embedding
+}
+
+// ByteText is the printable text of each byte
+var ByteText = func() (text [256]string) {
+	for i := range text {
+		text[i] = string(rune(i))
+	}
+	return text
+}()
+
+// NewByteTokenizer splits the data into bytes
+func NewByteTokenizer(data []byte) Tokenizer {
+	i := 0
+	return TokenizerFunc(func() (Token, bool) {
+		if i >= len(data) {
+			return Token{}, false
+		}
+		symbol := data[i]
+		i++
+		return Token{Text: ByteText[symbol], Embedding: Embed.Embed(data, i-1), Offset: i - 1}, true
+	})
+}
+
+// NewRuneTokenizer splits the text into runes
+func NewRuneTokenizer(text string) Tokenizer {
+	offset := 0
+	return TokenizerFunc(func() (Token, bool) {
+		if text == "" {
+			return Token{}, false
+		}
+		_, size := utf8.DecodeRuneInString(text)
+		token := text[:size]
+		text, offset = text[size:], offset+size
+		return Token{Text: token, Embedding: TextEmbedding(token), Offset: offset - size}, true
+	})
+}
+
+// NewWordTokenizer splits the text into words of letters and digits, every other rune is a token of its own
+func NewWordTokenizer(text string) Tokenizer {
+	word := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	offset := 0
+	return TokenizerFunc(func() (Token, bool) {
+		if text == "" {
+			return Token{}, false
+		}
+		r, size := utf8.DecodeRuneInString(text)
+		if word(r) {
+			for size < len(text) {
+				r, s := utf8.DecodeRuneInString(text[size:])
+				if !word(r) {
+					break
+				}
+				size += s
+			}
+		}
+		token := text[:size]
+		text, offset = text[size:], offset+size
+		return Token{Text: token, Embedding: TextEmbedding(token), Offset: offset - size}, true
+	})
+}
+
+// Terminal reports whether the rune ends a sentence
+func Terminal(r rune) bool {
+	return r == '.' || r == '!' || r == '?'
+}
+
+// Closing reports whether the rune closes a quotation or parenthesis after the end of a sentence
+func Closing(r rune) bool {
+	return strings.ContainsRune("\"')]}”’»", r)
+}
+
+// NewSentenceTokenizer splits the text into sentences ending at a run of . ! or ? followed by whitespace or at a blank line,
+// the whitespace after a sentence is part of it. The embedding of a sentence is the normalized mean of the embeddings of its words
+func NewSentenceTokenizer(text string) Tokenizer {
+	offset := 0
+	return TokenizerFunc(func() (Token, bool) {
+		if text == "" {
+			return Token{}, false
+		}
+		size, ended := 0, false
+		for size < len(text) && !ended {
+			r, s := utf8.DecodeRuneInString(text[size:])
+			size += s
+			switch {
+			case Terminal(r):
+				for size < len(text) {
+					r, s := utf8.DecodeRuneInString(text[size:])
+					if !Terminal(r) && !Closing(r) {
+						break
+					}
+					size += s
+				}
+				r, _ := utf8.DecodeRuneInString(text[size:])
+				ended = size == len(text) || unicode.IsSpace(r)
+			case r == '\n':
+				ended = strings.HasPrefix(strings.TrimLeft(text[size:], " \t\r"), "\n")
+			}
+		}
+		for size < len(text) {
+			r, s := utf8.DecodeRuneInString(text[size:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			size += s
+		}
+		sentence := text[:size]
+		text, offset = text[size:], offset+size
+		return Token{Text: sentence, Embedding: SentenceEmbedding(sentence), Offset: offset - size}, true
+	})
+}
+
+// SentenceEmbedding is the normalized mean of the embeddings of the words of the sentence,
+// the embedding of the text of a sentence without words
+func SentenceEmbedding(sentence string) []float32 {
+	words := strings.FieldsFunc(sentence, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return TextEmbedding(strings.TrimSpace(sentence))
+	}
+	embedding := make([]float32, *FlagSize)
+	for _, word := range words {
+		for i, v := range TextEmbedding(strings.ToLower(word)) {
+			embedding[i] += v
+		}
+	}
+	sum := float32(0)
+	for _, v := range embedding {
+		sum += v * v
+	}
+	if length := float32(math.Sqrt(float64(sum))); length > 0 {
+		for i := range embedding {
+			embedding[i] /= length
+		}
+	}
+	return embedding
+}
+
+// NewBPETokenizer splits the data into the tokens of a byte pair encoding vocabulary
+func NewBPETokenizer(vocab *bpe.Vocab, data []byte) Tokenizer {
+	ids, i, offset := vocab.Encode(data), 0, 0
+	return TokenizerFunc(func() (Token, bool) {
+		if i >= len(ids) {
+			return Token{}, false
+		}
+		token := string(vocab.Token(ids[i]))
+		i, offset = i+1, offset+len(token)
+		return Token{Text: token, Embedding: TextEmbedding(token), Offset: offset - len(token)}, true
+	})
+}
+
+// Shift moves the offsets of the tokens of the tokenizer to the byte of the file its data begins at
+func Shift(tokenizer Tokenizer, begin int) Tokenizer {
+	if begin == 0 {
+		return tokenizer
+	}
+	return TokenizerFunc(func() (Token, bool) {
+		token, ok := tokenizer.Next()
+		token.Offset += begin
+		return token, ok
+	})
+}
+
+// Tokenize reads all of the tokens of the tokenizer
+func Tokenize(tokenizer Tokenizer) []Token {
+	tokens := []Token{}
+	for {
+		token, ok := tokenizer.Next()
+		if !ok {
+			return tokens
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// InputTokens fills the input with the embeddings of the batch of tokens at position
+func (n *Net) InputTokens(in Matrix, tokens []Token, position int) {
+	embed := func(position int) []float32 {
+		if position < 0 {
+			return nil
+		}
+		return tokens[position%len(tokens)].Embedding
+	}
+	for i := 0; i < in.Rows; i++ {
+		n.Fill(in.Data[i*in.Cols:(i+1)*in.Cols], position+i, embed)
+	}
+}
+
+// ColorTokens colors the tokens of the tokenizer starting at position until done is closed, returning the final position.
+// The tokens are streamed, only the context, the batch of tokens being colored and the first batch, which the last batches wrap around to, are kept
+func ColorTokens(net *Net, tokenizer Tokenizer, position int, done <-chan struct{}, fn func(symbol Symbol)) int {
+	net.Rewind()
+	in := NewInput(net)
+	window := make([]Token, 0, in.Rows)
+	for len(window) < in.Rows {
+		token, ok := tokenizer.Next()
+		if !ok {
+			break
+		}
+		window = append(window, token)
+	}
+	head, history := append([]Token{}, window...), make([]Token, 0, net.Context+1)
+	index, total := 0, -1
+	if len(window) < in.Rows {
+		total = len(window)
+	}
+	embed := func(position int) []float32 {
+		switch {
+		case position < 0:
+			return nil
+		case total >= 0 && position >= total:
+			return head[position%total].Embedding
+		case position >= index:
+			return window[position-index].Embedding
+		}
+		return history[len(history)-(index-position)].Embedding
+	}
+	for len(window) > 0 {
+		select {
+		case <-done:
+			return index
+		default:
+		}
+		if index >= position {
+			for i := 0; i < in.Rows; i++ {
+				net.Fill(in.Data[i*in.Cols:(i+1)*in.Cols], index+i, embed)
+			}
+			out, entropy := net.Fire(in)
+			decoded := net.Decode(out)
+			r, _ := utf8.DecodeRuneInString(window[0].Text)
+			symbol := Symbol{
+				Position: index,
+				Symbol:   byte(r),
+				Code:     decoded.Color,
+				Label:    decoded.Label,
+				Entropy:  entropy,
+				Rune:     r,
+				Head:     Head(out),
+				Token:    window[0].Text,
+				Meta:     window[0].Meta,
+				Offset:   window[0].Offset,
+			}
+			if *FlagExport != "" {
+				symbol.Outputs = append([]float32{}, out.Data...)
+			}
+			fn(symbol)
+			net.Step(symbol)
+			net.Observe(window[0].Text)
+		}
+		if net.Context > 0 {
+			if len(history) == net.Context {
+				history = history[1:]
+			}
+			history = append(history, window[0])
+		}
+		window = window[1:]
+		index++
+		if total < 0 {
+			if token, ok := tokenizer.Next(); ok {
+				window = append(window, token)
+			} else {
+				total = index + len(window)
+			}
+		}
+	}
+	return index
+}
+
+// BPECommand trains byte pair encoding vocabularies
+func BPECommand(args []string) {
+	if len(args) == 0 || args[0] != "train" {
+		fmt.Fprintln(os.Stderr, "usage: testament bpe train [-f file] [-vocab vocab.json] [-size 512]")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("bpe train", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to train on")
+	vocab := OutputFlag(flags, "vocab", *FlagVocab, "the vocabulary file to write")
+	size := flags.Int("size", 512, "number of tokens in the vocabulary")
+	flags.Parse(args[1:])
+
+	v := bpe.Train(Load(*file), *size)
+	if err := v.Save(*vocab); err != nil {
+		panic(err)
+	}
+	fmt.Printf("wrote vocabulary of %d tokens to %s\n", v.Size(), *vocab)
+}
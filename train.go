@@ -0,0 +1,257 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Stage is a stage of the alphabet curriculum, it maps the bytes onto a reduced alphabet
+type Stage struct {
+	Name string
+	Map  [256]byte
+}
+
+// NewStage makes a stage from a mapping of the ascii bytes, other bytes are kept
+func NewStage(name string, fn func(symbol rune) rune) Stage {
+	stage := Stage{Name: name}
+	for i := range stage.Map {
+		stage.Map[i] = byte(i)
+		if i < 128 {
+			stage.Map[i] = byte(fn(rune(i)))
+		}
+	}
+	return stage
+}
+
+// Apply maps the data onto the alphabet of the stage
+func (s Stage) Apply(data []byte) []byte {
+	mapped := make([]byte, len(data))
+	for i, symbol := range data {
+		mapped[i] = s.Map[symbol]
+	}
+	return mapped
+}
+
+// Curriculum are the stages of the alphabet curriculum, from the smallest alphabet to the full alphabet
+var Curriculum = []Stage{
+	NewStage("letters", func(symbol rune) rune {
+		switch {
+		case unicode.IsDigit(symbol):
+			return '0'
+		case unicode.IsPunct(symbol) || unicode.IsSymbol(symbol):
+			return '.'
+		}
+		return unicode.ToLower(symbol)
+	}),
+	NewStage("folded", func(symbol rune) rune {
+		if unicode.IsDigit(symbol) {
+			return '0'
+		}
+		return unicode.ToLower(symbol)
+	}),
+	NewStage("full", func(symbol rune) rune {
+		return symbol
+	}),
+}
+
+// Schedule is the stage of the curriculum of each epoch, the stages are spread evenly over the epochs
+// and the last epoch always uses the full alphabet
+func Schedule(epochs int) []int {
+	schedule := make([]int, epochs)
+	for epoch := range schedule {
+		schedule[epoch] = epoch * len(Curriculum) / epochs
+	}
+	if epochs > 0 {
+		schedule[epochs-1] = len(Curriculum) - 1
+	}
+	return schedule
+}
+
+// Weights computes the number of updates each byte value gets per occurrence,
+// the inverse of its frequency relative to the mean frequency, capped
+func Weights(data []byte, limit int) (weights [256]int) {
+	frequency, distinct := [256]int{}, 0
+	for _, symbol := range data {
+		if frequency[symbol] == 0 {
+			distinct++
+		}
+		frequency[symbol]++
+	}
+	mean := float64(len(data)) / float64(distinct)
+	for symbol, count := range frequency {
+		weights[symbol] = 1
+		if count == 0 {
+			continue
+		}
+		weight := int(math.Round(mean / float64(count)))
+		if weight > limit {
+			weight = limit
+		}
+		if weight > 1 {
+			weights[symbol] = weight
+		}
+	}
+	return weights
+}
+
+// CorpusFile is a file of the training corpus
+type CorpusFile struct {
+	Name string
+	Size int
+	// Checksum is the sha256 of the loaded contents of the file
+	Checksum string
+}
+
+// Provenance is how a model was trained
+type Provenance struct {
+	Corpus   []CorpusFile
+	Flags    map[string]string
+	Version  string
+	Start    time.Time
+	Duration float64
+	Epochs   int
+	Symbols  int
+	Updates  int
+	// Entropy is the mean entropy of the updates
+	Entropy float64
+	// Codes is the histogram of the codes of the updates
+	Codes []int
+}
+
+// Train trains a model over epochs of the corpus
+func Train(args []string) {
+	flags := flag.NewFlagSet("train", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file, directory or glob to process")
+	epochs := flags.Int("epochs", 1, "number of passes over the corpus")
+	rare := flags.Bool("rare", false, "oversample positions containing rare bytes")
+	limit := flags.Int("cap", 8, "maximum number of updates per position when oversampling")
+	curriculum := flags.Bool("curriculum", false, "start from a reduced alphabet and restore the full alphabet over the epochs")
+	output := OutputFlag(flags, "o", "model.bin", "the file to write the model to")
+	flags.Parse(args)
+
+	start := time.Now()
+	files := Files(*file)
+	corpus, data := make([][]byte, len(files)), []byte{}
+	provenance := Provenance{Flags: make(map[string]string), Version: Version(), Start: start, Epochs: *epochs}
+	for i, name := range files {
+		corpus[i] = Load(name)
+		data = append(data, corpus[i]...)
+		checksum := sha256.Sum256(corpus[i])
+		provenance.Corpus = append(provenance.Corpus, CorpusFile{Name: name, Size: len(corpus[i]), Checksum: hex.EncodeToString(checksum[:])})
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		provenance.Flags[f.Name] = f.Value.String()
+	})
+	flags.VisitAll(func(f *flag.Flag) {
+		provenance.Flags["train."+f.Name] = f.Value.String()
+	})
+	if len(data) == 0 {
+		return
+	}
+	weights := [256]int{}
+	for i := range weights {
+		weights[i] = 1
+	}
+	if *rare {
+		weights = Weights(data, *limit)
+	}
+
+	done := Interrupted()
+	net := NewFlagNet(3)
+	in := NewInput(&net)
+	updates, frequency, codes, entropy := [256]int{}, [256]int{}, make([]int, net.Codes()), 0.0
+	for _, symbol := range data {
+		frequency[symbol]++
+	}
+	schedule, stages := Schedule(*epochs), []string{}
+	position, processed, progress := 0, 0, NewFlagProgress(*epochs*len(data))
+train:
+	for epoch := 0; epoch < *epochs; epoch++ {
+		stage := Curriculum[len(Curriculum)-1]
+		if *curriculum {
+			stage = Curriculum[schedule[epoch]]
+			stages = append(stages, stage.Name)
+			slog.Info("epoch", "epoch", epoch, "alphabet", stage.Name)
+		}
+		for f, data := range corpus {
+			if len(files) > 1 {
+				slog.Info("training", "file", files[f])
+			}
+			net.Reset()
+			mapped := data
+			if *curriculum {
+				mapped = stage.Apply(data)
+			}
+			for position = 0; position < len(data); position++ {
+				select {
+				case <-done:
+					break train
+				default:
+				}
+				symbol := data[position]
+				net.Input(in, mapped, position)
+				for i := 0; i < weights[symbol]; i++ {
+					out, e := net.Fire(in)
+					codes[net.Decode(out).Color]++
+					entropy += float64(e)
+					updates[symbol]++
+				}
+				net.Observe(ByteText[symbol])
+				processed++
+				if progress != nil {
+					progress.Update(processed, processed)
+				}
+			}
+		}
+		slog.Info("epoch done", "epoch", epoch)
+	}
+
+	total := 0
+	for _, count := range updates {
+		total += count
+	}
+	Metric("symbols", float64(len(data)))
+	Metric("updates", float64(total))
+
+	provenance.Duration, provenance.Symbols, provenance.Updates = time.Since(start).Seconds(), len(data), total
+	provenance.Codes = codes
+	if total > 0 {
+		provenance.Entropy = entropy / float64(total)
+	}
+	checkpoint := net.Checkpoint(position)
+	checkpoint.Curriculum = stages
+	checkpoint.Provenance = provenance
+	if err := checkpoint.Save(*output); err != nil {
+		panic(err)
+	}
+	if len(stages) > 0 {
+		fmt.Println("curriculum", strings.Join(stages, " "))
+	}
+	fmt.Println("model written to", *output)
+
+	symbols := []int{}
+	for symbol, count := range frequency {
+		if count > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return frequency[symbols[i]] < frequency[symbols[j]]
+	})
+	fmt.Printf("%6s %10s %8s %10s\n", "byte", "frequency", "weight", "updates")
+	for _, symbol := range symbols {
+		fmt.Printf("%6q %10d %8d %10d\n", rune(symbol), frequency[symbol], weights[symbol], updates[symbol])
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FlagTranslit transliterates non-ascii letters to ascii as they are embedded
+var FlagTranslit = flag.String("translit", "", "transliterate non-ascii letters to ascii as they are embedded: a locale ("+
+	strings.Join(TransliterationNames(), ", ")+") or a json table of runes to ascii")
+
+// Transliteration maps runes to ascii sequences, runes without an entry are decomposed and stripped of their marks
+type Transliteration map[rune]string
+
+// Transliterations are the builtin transliterations by locale
+var Transliterations = map[string]Transliteration{
+	"default": {
+		'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O", 'ł': "l", 'Ł': "L",
+		'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "Th", 'ı': "i", 'ĸ': "q", 'ŋ': "ng", 'Ŋ': "NG",
+		'α': "a", 'β': "b", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "e", 'θ': "th", 'ι': "i", 'κ': "k",
+		'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+		'υ': "y", 'φ': "ph", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+		'Α': "A", 'Β': "B", 'Γ': "G", 'Δ': "D", 'Ε': "E", 'Ζ': "Z", 'Η': "E", 'Θ': "Th", 'Ι': "I", 'Κ': "K",
+		'Λ': "L", 'Μ': "M", 'Ν': "N", 'Ξ': "X", 'Ο': "O", 'Π': "P", 'Ρ': "R", 'Σ': "S", 'Τ': "T", 'Υ': "Y",
+		'Φ': "Ph", 'Χ': "Ch", 'Ψ': "Ps", 'Ω': "O",
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+		'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+		'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+		'э': "e", 'ю': "iu", 'я': "ia",
+		'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Е': "E", 'Ё': "E", 'Ж': "Zh", 'З': "Z", 'И': "I",
+		'Й': "I", 'К': "K", 'Л': "L", 'М': "M", 'Н': "N", 'О': "O", 'П': "P", 'Р': "R", 'С': "S", 'Т': "T",
+		'У': "U", 'Ф': "F", 'Х': "Kh", 'Ц': "Ts", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch", 'Ъ': "", 'Ы': "Y", 'Ь': "",
+		'Э': "E", 'Ю': "Iu", 'Я': "Ia",
+	},
+	"de": {
+		'ä': "ae", 'Ä': "Ae", 'ö': "oe", 'Ö': "Oe", 'ü': "ue", 'Ü': "Ue",
+	},
+	"da": {
+		'å': "aa", 'Å': "Aa",
+	},
+	"sv": {
+		'å': "aa", 'Å': "Aa", 'ä': "ae", 'Ä': "Ae", 'ö': "oe", 'Ö': "Oe",
+	},
+}
+
+// TransliterationNames are the sorted names of the builtin transliterations
+func TransliterationNames() []string {
+	names := make([]string, 0, len(Transliterations))
+	for name := range Transliterations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewTransliteration makes the transliteration of a locale or of a json table file, both on top of the default table
+func NewTransliteration(name string) (Transliteration, error) {
+	t := Transliteration{}
+	for r, ascii := range Transliterations["default"] {
+		t[r] = ascii
+	}
+	table, ok := Transliterations[name]
+	if !ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown transliteration %s: %w", name, err)
+		}
+		entries := map[string]string{}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+		table = Transliteration{}
+		for key, ascii := range entries {
+			r, size := utf8.DecodeRuneInString(key)
+			if size != len(key) {
+				return nil, fmt.Errorf("transliteration key %q isn't a single rune", key)
+			}
+			table[r] = ascii
+		}
+	}
+	for r, ascii := range table {
+		t[r] = ascii
+	}
+	return t, nil
+}
+
+// Transliterate maps the non-ascii letters of the text to ascii, letters that can't be transliterated are kept
+func (t Transliteration) Transliterate(text string) string {
+	builder := strings.Builder{}
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			builder.WriteRune(r)
+			continue
+		}
+		if ascii, ok := t[r]; ok {
+			builder.WriteString(ascii)
+			continue
+		}
+		if ascii, ok := t.decompose(r); ok {
+			builder.WriteString(ascii)
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// decompose transliterates a letter by stripping the marks from its canonical decomposition
+func (t Transliteration) decompose(r rune) (string, bool) {
+	if !unicode.IsLetter(r) {
+		return "", false
+	}
+	ascii := strings.Builder{}
+	for _, d := range norm.NFD.String(string(r)) {
+		switch {
+		case unicode.Is(unicode.Mn, d):
+		case d < utf8.RuneSelf:
+			ascii.WriteRune(d)
+		case t[d] != "":
+			ascii.WriteString(t[d])
+		default:
+			return "", false
+		}
+	}
+	return ascii.String(), ascii.Len() > 0
+}
+
+// CurrentTransliteration is the transliteration selected by the translit flag, nil if disabled
+var CurrentTransliteration = sync.OnceValue(func() Transliteration {
+	if *FlagTranslit == "" {
+		return nil
+	}
+	t, err := NewTransliteration(*FlagTranslit)
+	if err != nil {
+		panic(err)
+	}
+	return t
+})
+
+// TranslitEmbedder embeds the bytes of the non-ascii runes of the data by their transliteration,
+// the mean of the embeddings of the ascii bytes the rune transliterates to. The data is read as utf-8,
+// a byte that isn't part of a valid utf-8 rune is read as its latin-1 rune. The other bytes are embedded as they are
+type TranslitEmbedder struct {
+	Embedder
+	Transliteration Transliteration
+	sync.Mutex
+	cache map[rune][]float32
+}
+
+// NewTranslitEmbedder makes an embedder transliterating the runes embedded by embedder
+func NewTranslitEmbedder(embedder Embedder, t Transliteration) *TranslitEmbedder {
+	return &TranslitEmbedder{Embedder: embedder, Transliteration: t, cache: make(map[rune][]float32)}
+}
+
+// Rune is the rune the byte at position of the data belongs to
+func Rune(data []byte, position int) rune {
+	for start := position; start >= 0 && start > position-utf8.UTFMax; start-- {
+		if !utf8.RuneStart(data[start]) {
+			continue
+		}
+		r, size := utf8.DecodeRune(data[start:])
+		if r != utf8.RuneError && start+size > position {
+			return r
+		}
+		break
+	}
+	return rune(data[position])
+}
+
+// Reach is the number of bytes the embedding of a byte reads, at least the bytes of the rune it belongs to
+func (e *TranslitEmbedder) Reach() int {
+	return max(e.Embedder.Reach(), utf8.UTFMax)
+}
+
+// Embed is the embedding of the byte at position of the data, every byte of a rune has the embedding of its transliteration
+func (e *TranslitEmbedder) Embed(data []byte, position int) []float32 {
+	if data[position] < utf8.RuneSelf {
+		return e.Embedder.Embed(data, position)
+	}
+	r := Rune(data, position)
+	e.Lock()
+	defer e.Unlock()
+	embedding, ok := e.cache[r]
+	if !ok {
+		ascii := []byte(e.Transliteration.Transliterate(string(r)))
+		if len(ascii) == 0 || ascii[0] >= utf8.RuneSelf {
+			embedding = e.Embedder.Embed(data, position)
+		} else {
+			embedding = make([]float32, e.Size())
+			for i := range ascii {
+				for j, v := range e.Embedder.Embed(ascii, i) {
+					embedding[j] += v / float32(len(ascii))
+				}
+			}
+		}
+		e.cache[r] = embedding
+	}
+	return embedding
+}
@@ -0,0 +1,316 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ansi "github.com/fatih/color"
+)
+
+const (
+	// TUIFrame is the interval the dashboard is redrawn at
+	TUIFrame = 100 * time.Millisecond
+	// TUIHistory is the number of entropies and standard deviations the trends are drawn from
+	TUIHistory = 1024
+	// TUILines is the number of lines of the colored text kept for the text pane
+	TUILines = 256
+	// TUIStdDevEvery is the number of symbols between samples of the mean standard deviation of the statistics
+	TUIStdDevEvery = 16
+)
+
+// FlagTUI colors the corpus in a live dashboard
+var FlagTUI = flag.Bool("tui", false, "color the corpus in a live dashboard of the text, entropy trend, code histogram and convergence")
+
+// Sparks are the levels of a sparkline
+var Sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws the values as a sparkline of width runes, each the mean of a bucket of the values
+func Sparkline(values []float64, width int) string {
+	if len(values) == 0 || width <= 0 {
+		return ""
+	}
+	width = min(width, len(values))
+	means := make([]float64, width)
+	low, high := math.Inf(1), math.Inf(-1)
+	for i := range means {
+		begin, end := i*len(values)/width, (i+1)*len(values)/width
+		sum := 0.0
+		for _, v := range values[begin:end] {
+			sum += v
+		}
+		means[i] = sum / float64(end-begin)
+		low, high = math.Min(low, means[i]), math.Max(high, means[i])
+	}
+	line := strings.Builder{}
+	for _, mean := range means {
+		level := 0
+		if high > low {
+			level = int((mean - low) / (high - low) * float64(len(Sparks)-1))
+		}
+		line.WriteRune(Sparks[level])
+	}
+	return line.String()
+}
+
+// Glyph is a colored symbol of the text pane
+type Glyph struct {
+	Text  string
+	Color int
+}
+
+// Live is the state of the tui, shared by the coloring and drawing goroutines
+type Live struct {
+	sync.Mutex
+	Lines     [][]Glyph
+	Codes     []int
+	Entropies []float64
+	StdDevs   []float64
+	Symbols   int
+	Window    int64
+	Paused    bool
+	Finished  bool
+	Start     time.Time
+}
+
+// Add adds a colored symbol to the dashboard, the lines of the text pane wrap at width
+func (d *Live) Add(symbol Symbol, color, width int) {
+	d.Lock()
+	defer d.Unlock()
+	text := Printable(symbol.String())
+	if len(d.Lines) == 0 {
+		d.Lines = append(d.Lines, nil)
+	}
+	if symbol.String() == "\n" {
+		d.Lines = append(d.Lines, nil)
+	} else {
+		if len(d.Lines[len(d.Lines)-1]) >= width {
+			d.Lines = append(d.Lines, nil)
+		}
+		d.Lines[len(d.Lines)-1] = append(d.Lines[len(d.Lines)-1], Glyph{Text: text, Color: color})
+	}
+	if len(d.Lines) > TUILines {
+		d.Lines = d.Lines[len(d.Lines)-TUILines:]
+	}
+	d.Codes[symbol.Code]++
+	d.Entropies = append(d.Entropies, float64(symbol.Entropy))
+	if len(d.Entropies) > TUIHistory {
+		d.Entropies = d.Entropies[len(d.Entropies)-TUIHistory:]
+	}
+	d.Symbols++
+}
+
+// Draw draws the dashboard as a screen of width by height
+func (d *Live) Draw(width, height int, colors []func(format string, a ...interface{}) string) string {
+	d.Lock()
+	defer d.Unlock()
+	screen := strings.Builder{}
+	screen.WriteString("\x1b[H")
+	line := func(text string) {
+		screen.WriteString(text)
+		screen.WriteString("\x1b[K\r\n")
+	}
+	histogram := min(len(d.Codes), max(height/3, 1))
+	rows := max(height-3-histogram, 1)
+	lines := d.Lines[max(len(d.Lines)-rows, 0):]
+	for i := 0; i < rows; i++ {
+		if i >= len(lines) {
+			line("")
+			continue
+		}
+		text := strings.Builder{}
+		for _, glyph := range lines[i] {
+			text.WriteString(colors[glyph.Color](glyph.Text))
+		}
+		line(text.String())
+	}
+	state := "running"
+	switch {
+	case d.Finished:
+		state = "finished"
+	case d.Paused:
+		state = "paused"
+	}
+	rate := float64(d.Symbols) / math.Max(time.Since(d.Start).Seconds(), 1e-9)
+	line(ansi.New(ansi.ReverseVideo).Sprint(fmt.Sprintf("%-*s", width,
+		fmt.Sprintf(" %s  symbols %d  %.0f symbols/s  window %d  space pause  +/- window  q quit", state, d.Symbols, rate, d.Window))))
+	label := func(name string, values []float64) {
+		latest := 0.0
+		if len(values) > 0 {
+			latest = values[len(values)-1]
+		}
+		line(fmt.Sprintf("%-8s %12.6g %s", name, latest, Sparkline(values, width-22)))
+	}
+	label("entropy", d.Entropies)
+	label("stddev", d.StdDevs)
+	order := make([]int, len(d.Codes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return d.Codes[order[i]] > d.Codes[order[j]]
+	})
+	total := max(d.Symbols, 1)
+	for i, code := range order[:histogram] {
+		if i == histogram-1 && len(order) > histogram {
+			screen.WriteString(fmt.Sprintf("%d more codes\x1b[K", len(order)-histogram+1))
+			break
+		}
+		share := float64(d.Codes[code]) / float64(total)
+		bar := strings.Repeat("█", int(share*float64(max(width-22, 0))))
+		text := fmt.Sprintf("code %3d %6.2f%% %s", code, 100*share, Colors[code](bar))
+		if i == histogram-1 {
+			screen.WriteString(text + "\x1b[K")
+		} else {
+			line(text)
+		}
+	}
+	return screen.String()
+}
+
+// TUI colors the files in a live dashboard until q is pressed
+func TUI(files []string) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	restore, err := MakeRaw(in)
+	if err != nil {
+		panic(fmt.Errorf("the tui needs a terminal: %w", err))
+	}
+	defer restore()
+	ansi.NoColor = false
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+
+	net := NewFlagNet(3)
+	colors, thermometer := Colors[:], Thermometer{}
+	if *FlagColoring == ColoringEntropy {
+		gradient := NewGradient(*FlagPalette)
+		colors = gradient[:]
+	}
+	d := &Live{Codes: make([]int, net.Codes()), Window: net.Window(), Start: time.Now()}
+	keys, quit, done := make(chan byte, 16), make(chan struct{}), make(chan struct{})
+	go func() {
+		buffer := make([]byte, 1)
+		for {
+			if n, err := os.Stdin.Read(buffer); err != nil || n == 0 {
+				return
+			}
+			switch buffer[0] {
+			case 'q', 3:
+				close(quit)
+				return
+			default:
+				select {
+				case keys <- buffer[0]:
+				default:
+				}
+			}
+		}
+	}()
+	width := func() int {
+		w, _, err := TerminalSize(out)
+		if err != nil || w <= 0 {
+			return 80
+		}
+		return w
+	}
+	adjust := func(key byte) {
+		window := net.Window()
+		switch key {
+		case ' ', 'p':
+			d.Lock()
+			d.Paused = !d.Paused
+			d.Unlock()
+		case '+', '=':
+			window = min(window+1, int64(net.Samples))
+		case '-', '_':
+			window = max(window-1, 1)
+		}
+		net.SetWindow(window)
+		for i := range net.Layers {
+			net.Layers[i].SetWindow(window)
+		}
+		d.Lock()
+		d.Window = window
+		d.Unlock()
+	}
+	go func() {
+		defer func() {
+			d.Lock()
+			d.Finished = true
+			d.Unlock()
+		}()
+		for _, name := range files {
+			net.Reset()
+			ColorTokens(&net, NewTokenizer(name), 0, done, func(symbol Symbol) {
+				for {
+					select {
+					case key := <-keys:
+						adjust(key)
+						continue
+					default:
+					}
+					d.Lock()
+					paused := d.Paused
+					d.Unlock()
+					if !paused {
+						break
+					}
+					select {
+					case key := <-keys:
+						adjust(key)
+					case <-done:
+						return
+					}
+				}
+				color := symbol.Code
+				if *FlagColoring == ColoringEntropy {
+					color = thermometer.Level(symbol.Entropy)
+				}
+				d.Add(symbol, color, width())
+				if d.Symbols%TUIStdDevEvery == 0 {
+					stddev := net.MeanStdDev()
+					d.Lock()
+					d.StdDevs = append(d.StdDevs, stddev)
+					if len(d.StdDevs) > TUIHistory {
+						d.StdDevs = d.StdDevs[len(d.StdDevs)-TUIHistory:]
+					}
+					d.Unlock()
+				}
+			})
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+
+	interrupted := Interrupted()
+	ticker := time.NewTicker(TUIFrame)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			close(done)
+			return
+		case <-interrupted:
+			close(done)
+			return
+		case <-ticker.C:
+			w, h, err := TerminalSize(out)
+			if err != nil {
+				w, h = 80, 24
+			}
+			os.Stdout.WriteString(d.Draw(w, h, colors))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// VectorsWord2Vec writes the vectors in the word2vec text format
+	VectorsWord2Vec = "word2vec"
+	// VectorsNPY writes the vectors as numpy arrays
+	VectorsNPY = "npy"
+)
+
+// Vectors is a named table of vectors of the same width
+type Vectors struct {
+	Name  string
+	Words []string
+	Rows  [][]float32
+}
+
+// ByteWord is the word of a byte in the word2vec format, which can't have whitespace:
+// the graphic ascii bytes are themselves and the other bytes are their hex value
+func ByteWord(symbol byte) string {
+	if symbol > ' ' && symbol < 0x7f {
+		return string(rune(symbol))
+	}
+	return fmt.Sprintf("0x%02x", symbol)
+}
+
+// EmbeddingVectors are the vectors of the embeddings of the bytes by the embedder
+func EmbeddingVectors() Vectors {
+	vectors := Vectors{Name: "embeddings"}
+	for symbol, embedding := range ByteEmbeddings() {
+		vectors.Words = append(vectors.Words, ByteWord(byte(symbol)))
+		vectors.Rows = append(vectors.Rows, embedding)
+	}
+	return vectors
+}
+
+// MeanVectors are the mean vectors of the outputs of the set, the word of an output is its index prefixed with the name
+func MeanVectors(name string, set Set) Vectors {
+	vectors := Vectors{Name: name}
+	for i, output := range set {
+		row := make([]float32, len(output))
+		for j, random := range output {
+			row[j] = random.Mean
+		}
+		vectors.Words = append(vectors.Words, name+strconv.Itoa(i))
+		vectors.Rows = append(vectors.Rows, row)
+	}
+	return vectors
+}
+
+// NetVectors are the byte embeddings and the mean vectors of the Q, K and V sets of the network and of its layers
+func NetVectors(net *Net) []Vectors {
+	vectors := []Vectors{EmbeddingVectors()}
+	sets := func(prefix string, n *Net) {
+		vectors = append(vectors, MeanVectors(prefix+"q", n.Q), MeanVectors(prefix+"k", n.K), MeanVectors(prefix+"v", n.V))
+	}
+	sets("", net)
+	for i := range net.Layers {
+		sets(fmt.Sprintf("layer%d_", i+1), &net.Layers[i])
+	}
+	return vectors
+}
+
+// WriteWord2Vec writes the vectors in the word2vec text format, a header of the number of vectors and their width
+// followed by a line per vector of its word and values
+func (v Vectors) WriteWord2Vec(w io.Writer) error {
+	output := bufio.NewWriter(w)
+	width := 0
+	if len(v.Rows) > 0 {
+		width = len(v.Rows[0])
+	}
+	fmt.Fprintf(output, "%d %d\n", len(v.Rows), width)
+	for i, row := range v.Rows {
+		output.WriteString(v.Words[i])
+		for _, value := range row {
+			output.WriteByte(' ')
+			output.WriteString(strconv.FormatFloat(float64(value), 'g', -1, 32))
+		}
+		output.WriteByte('\n')
+	}
+	return output.Flush()
+}
+
+// WriteNPY writes the vectors as a two dimensional little endian float32 array in the numpy npy version 1.0 format,
+// the words aren't written
+func (v Vectors) WriteNPY(w io.Writer) error {
+	width := 0
+	if len(v.Rows) > 0 {
+		width = len(v.Rows[0])
+	}
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", len(v.Rows), width)
+	// the magic, version, header length and header are padded with spaces and a newline to a multiple of 64 bytes
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n"
+	output := bufio.NewWriter(w)
+	output.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(output, binary.LittleEndian, uint16(len(header)))
+	output.WriteString(header)
+	buffer := make([]byte, 4)
+	for _, row := range v.Rows {
+		for _, value := range row {
+			binary.LittleEndian.PutUint32(buffer, math.Float32bits(value))
+			output.Write(buffer)
+		}
+	}
+	return output.Flush()
+}
+
+// VectorsCommand exports the byte embeddings and the mean vectors of the statistics of a model for embedding tooling
+func VectorsCommand(args []string) {
+	flags := flag.NewFlagSet("vectors", flag.ExitOnError)
+	model := flags.String("model", "", "the model whose statistics are exported, a new network when empty")
+	format := flags.String("format", VectorsWord2Vec, "the format of the vectors: word2vec or npy")
+	dir := OutputFlag(flags, "o", "vectors", "the directory the vectors are written to, a file per table")
+	flags.Parse(args)
+
+	net := NewFlagNet(3)
+	if *model != "" {
+		var err error
+		net, err = LoadNet(*model)
+		if err != nil {
+			panic(err)
+		}
+	}
+	extension := ".txt"
+	switch *format {
+	case VectorsWord2Vec:
+	case VectorsNPY:
+		extension = ".npy"
+	default:
+		panic(fmt.Errorf("unknown format %s", *format))
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		panic(err)
+	}
+	for _, vectors := range NetVectors(&net) {
+		file := filepath.Join(*dir, vectors.Name+extension)
+		output, err := os.Create(file)
+		if err != nil {
+			panic(err)
+		}
+		if *format == VectorsNPY {
+			err = vectors.WriteNPY(output)
+		} else {
+			err = vectors.WriteWord2Vec(output)
+		}
+		if err != nil {
+			panic(err)
+		}
+		if err := output.Close(); err != nil {
+			panic(err)
+		}
+		fmt.Println("wrote", len(vectors.Rows), "vectors to", file)
+	}
+}
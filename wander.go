@@ -0,0 +1,522 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+const (
+	// StopCovered stops a wander that visited every position
+	StopCovered = "covered"
+	// StopRevisit stops a wander whose code addressed a position it already visited
+	StopRevisit = "revisit"
+	// StopSteps stops a wander that made the most steps
+	StopSteps = "max-steps"
+	// StopSeconds stops a wander that ran for the longest duration
+	StopSeconds = "max-seconds"
+	// StopInterrupted stops an interrupted wander
+	StopInterrupted = "interrupted"
+)
+
+const (
+	// FallbackNext moves on from a visited position to the next unvisited position
+	FallbackNext = "next"
+	// FallbackNearest moves on from a visited position to the nearest unvisited position before or after it
+	FallbackNearest = "nearest"
+	// FallbackRandom moves on from a visited position to a random unvisited position
+	FallbackRandom = "random"
+	// CycleMembers is the number of members of a cycle that are reported
+	CycleMembers = 16
+	// CyclePeriod is the longest period of the addressed positions a cycle is detected at
+	CyclePeriod = 64
+)
+
+const (
+	// GranularityToken wanders over the tokens of the token flag
+	GranularityToken = "token"
+	// GranularityWord wanders over the words, leaving out the whitespace and punctuation between them
+	GranularityWord = "word"
+	// GranularitySentence wanders over the sentences
+	GranularitySentence = "sentence"
+)
+
+// Units are the units of the file the codes of a wander address: the tokens of the token flag, words or sentences
+func Units(file, granularity string) []Token {
+	switch granularity {
+	case GranularityToken:
+		return Tokenize(NewTokenizer(file))
+	case GranularityWord:
+		data, begin := LoadRawAt(file)
+		words := []Token{}
+		for _, token := range Tokenize(Shift(NewWordTokenizer(string(data)), begin)) {
+			r, _ := utf8.DecodeRuneInString(token.Text)
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				words = append(words, token)
+			}
+		}
+		return words
+	case GranularitySentence:
+		data, begin := LoadRawAt(file)
+		return Tokenize(Shift(NewSentenceTokenizer(string(data)), begin))
+	}
+	panic(fmt.Errorf("unknown granularity %s", granularity))
+}
+
+// Walk is when a wander stops
+type Walk struct {
+	// MaxSteps is the most jumps, 0 is unlimited
+	MaxSteps int
+	// MaxDuration is the longest the wander runs, 0 is unlimited
+	MaxDuration time.Duration
+	// StopOnRevisit stops the wander when the code addresses a visited position,
+	// otherwise it moves on to an unvisited position picked by the fallback
+	StopOnRevisit bool
+	// Fallback is how an unvisited position is picked when the code addresses a visited position
+	Fallback string
+	// Teleport is the probability of jumping to a random unvisited position instead of the position addressed by the code
+	Teleport float64
+	// Seed is the seed of the random jumps
+	Seed int64
+	// BreakCycles is the number of times the seed of the network of a walker is perturbed to break out of a cycle
+	// before the revisit stops the walker or falls back
+	BreakCycles int
+	// Novelty is the weight of the novelty of the addressed position against the entropy of the code, between 0 and 1,
+	// 0 follows the code of the best system
+	Novelty float64
+	// Recent is the number of the last positions of the path of a walker the novelty is measured against
+	Recent int
+	// Seen are the positions visited before the wander when it resumes
+	Seen []int
+}
+
+// Cycle is a loop a walker entered, the codes of the walker addressed the members twice in a row in the same order
+type Cycle struct {
+	Walker  int
+	Step    int
+	Members []int
+}
+
+// String is the report of the cycle
+func (c Cycle) String() string {
+	members := make([]string, 0, len(c.Members))
+	for i, member := range c.Members {
+		if i == CycleMembers {
+			members = append(members, "…")
+			break
+		}
+		members = append(members, strconv.Itoa(member))
+	}
+	return fmt.Sprintf("cycle of %d positions entered by walker %d after %d steps: %s",
+		len(c.Members), c.Walker, c.Step, strings.Join(members, " "))
+}
+
+// Wandered is the summary of a wander
+type Wandered struct {
+	Position  int
+	Steps     int
+	Visited   int
+	Length    int
+	Teleports int
+	Cycles    []Cycle
+	Stop      string
+	// Seen are the sorted positions visited
+	Seen []int
+}
+
+// Coverage is the percentage of the positions visited
+func (w Wandered) Coverage() float64 {
+	if w.Length == 0 {
+		return 0
+	}
+	return 100 * float64(w.Visited) / float64(w.Length)
+}
+
+// String is the summary printed at the end of a wander
+func (w Wandered) String() string {
+	summary := fmt.Sprintf("stopped on %s after %d steps, visited %d unique positions of %d, coverage %.2f%%",
+		w.Stop, w.Steps, w.Visited, w.Length, w.Coverage())
+	if w.Teleports > 0 {
+		summary += fmt.Sprintf(", teleported %d times", w.Teleports)
+	}
+	if len(w.Cycles) > 0 {
+		summary += fmt.Sprintf(", entered %d cycles", len(w.Cycles))
+	}
+	return summary
+}
+
+// Jump is a step of a walker from a position to the position addressed by the code,
+// or the position it was diverted to when the addressed position was visited or the walker teleported
+type Jump struct {
+	Walker    int
+	From      int
+	To        int
+	Addressed int
+	Code      int
+	Teleport  bool
+}
+
+// Walker is a wanderer, walkers that share a network share its lock
+type Walker struct {
+	Net      *Net
+	Lock     *sync.Mutex
+	Position int
+}
+
+// NewWalkers makes count walkers spread evenly over length positions from start, each with its own network
+// with an independent seed, the first is net, or all sharing net
+func NewWalkers(net *Net, count, start, length int, shared bool) []Walker {
+	walkers := []Walker{{Net: net, Lock: &sync.Mutex{}, Position: start}}
+	for i := 1; i < count; i++ {
+		walker := Walker{Net: net, Lock: walkers[0].Lock, Position: (start + i*length/count) % max(length, 1)}
+		if !shared {
+			own := NewSeededNet(*FlagSeed+int64(i**FlagLayers), net.Outputs)
+			walker.Net, walker.Lock = &own, &sync.Mutex{}
+		}
+		walkers = append(walkers, walker)
+	}
+	return walkers
+}
+
+// WanderCommand wanders the corpus, jumping to the position addressed by the output code
+func WanderCommand(args []string) {
+	flags := flag.NewFlagSet("wander", flag.ExitOnError)
+	file := flags.String("f", *FlagFile, "the file to process")
+	out := OutputFlag(flags, "o", "", "the file the output is written to, stdout when empty")
+	granularity := flags.String("granularity", GranularityToken, "what the codes address: token, the tokens of the token flag, word or sentence")
+	steps := flags.Int("max-steps", 0, "the most jumps, 0 for no limit")
+	seconds := flags.Float64("max-seconds", 0, "the longest the wander runs in seconds, 0 for no limit")
+	revisit := flags.Bool("stop-on-revisit", true, "stop when the code addresses a visited position, otherwise move on to the next unvisited position")
+	count := flags.Int("walkers", 1, "number of concurrent walkers starting spread over the corpus and sharing the visited positions")
+	shared := flags.Bool("shared", false, "the walkers share one network instead of each having its own with an independent seed")
+	fallback := flags.String("fallback", FallbackNext, "how an unvisited position is picked when the code addresses a visited position: next, nearest or random")
+	teleport := flags.Float64("teleport", 0, "probability of jumping to a random unvisited position instead of the position addressed by the code")
+	graph := OutputFlag(flags, "graph", "", "the graphviz dot file the transitions between the positions are written to")
+	nodes := flags.String("graph-nodes", NodesPosition, "what the positions of the graph are collapsed into: position, line or sentence")
+	cycles := flags.Int("break-cycles", 0, "number of times the seed of the network is perturbed to break out of a cycle before the revisit stops or falls back")
+	heatmap := OutputFlag(flags, "heatmap", "", "the png or svg file the heatmap of how often the codes addressed each position is written to, - for bars along the text after the summary")
+	novelty := flags.Float64("novelty", 0, "weight between 0 and 1 of the embedding distance of the addressed position from the recent positions against the entropy of the code")
+	recent := flags.Int("novelty-window", 16, "number of recently visited positions the novelty is measured against")
+	beam := flags.Int("beam", 0, "width of the beam search over the codes of the best value systems, the best path is written, 0 or 1 follows a single code")
+	flags.Parse(args)
+
+	output := NewOutput(*out)
+	defer output.Close()
+	color.Blue("Hello World!")
+	tokens := Units(*file, *granularity)
+	done := Interrupted()
+	net := NewFlagNet(16)
+	walk := Walk{
+		MaxSteps:      *steps,
+		MaxDuration:   time.Duration(*seconds * float64(time.Second)),
+		StopOnRevisit: *revisit,
+		Fallback:      *fallback,
+		Teleport:      *teleport,
+		Seed:          *FlagSeed,
+		BreakCycles:   *cycles,
+		Novelty:       *novelty,
+		Recent:        *recent,
+	}
+	switch *fallback {
+	case FallbackNext, FallbackNearest, FallbackRandom:
+	default:
+		panic(fmt.Errorf("unknown fallback %s", *fallback))
+	}
+	if *teleport < 0 || *teleport > 1 {
+		panic(fmt.Errorf("the teleport probability %f isn't between 0 and 1", *teleport))
+	}
+	if *novelty < 0 || *novelty > 1 {
+		panic(fmt.Errorf("the novelty weight %f isn't between 0 and 1", *novelty))
+	}
+	if *recent < 1 {
+		panic(fmt.Errorf("the novelty window %d is less than 1", *recent))
+	}
+	if *count < 1 {
+		panic(fmt.Errorf("the number of walkers %d is less than 1", *count))
+	}
+	if *beam > 1 && (*count > 1 || *teleport > 0 || *fallback != FallbackNext || *cycles > 0) {
+		panic(fmt.Errorf("the beam search doesn't support -walkers, -teleport, -fallback or -break-cycles"))
+	}
+	var transitions *Graph
+	if *graph != "" {
+		transitions = NewGraph(tokens, *nodes)
+	}
+	var visits Visits
+	if *heatmap != "" {
+		visits = make(Visits, len(tokens))
+	}
+	checkpoint, resumed := ResumeCheckpoint(&net)
+	walkers := NewWalkers(&net, *count, checkpoint.Position, len(tokens), *shared)
+	if resumed {
+		if len(checkpoint.Walkers) != len(walkers)-1 {
+			panic(fmt.Errorf("the checkpoint has %d walkers, not %d", len(checkpoint.Walkers)+1, len(walkers)))
+		}
+		for i, state := range checkpoint.Walkers {
+			if !*shared {
+				walkers[i+1].Net.Restore(state)
+			}
+			walkers[i+1].Position = state.Position
+		}
+		walk.Seen = checkpoint.Seen
+	}
+	// interrupt checkpoints the networks and positions of the walkers and the visited positions
+	interrupt := func(wandered Wandered) {
+		checkpoint := net.Checkpoint(wandered.Position)
+		for _, walker := range walkers[1:] {
+			state := Checkpoint{Position: walker.Position}
+			if !*shared {
+				state = walker.Net.Checkpoint(walker.Position)
+			}
+			checkpoint.Walkers = append(checkpoint.Walkers, state)
+		}
+		checkpoint.Seen = wandered.Seen
+		SaveInterrupt(checkpoint)
+	}
+	write := func(jump Jump) {
+		if len(walkers) > 1 {
+			fmt.Fprint(output, jump.Walker, " ")
+		}
+		text := tokens[jump.To].Text
+		if *granularity != GranularityToken {
+			text = strings.Join(strings.Fields(text), " ")
+		}
+		fmt.Fprintln(output, tokens[jump.To].Offset, text)
+		if transitions != nil {
+			transitions.Add(jump)
+		}
+		if visits != nil {
+			visits.Add(jump)
+		}
+	}
+	// save writes the transitions of the wander to the graph file and the visits to the heatmap,
+	// both are written when the wander is interrupted too
+	save := func() {
+		if transitions != nil {
+			file, err := os.Create(*graph)
+			if err != nil {
+				panic(err)
+			}
+			defer file.Close()
+			if err := transitions.Write(file); err != nil {
+				panic(err)
+			}
+		}
+		if visits != nil {
+			visits.Write(*heatmap, tokens, output)
+		}
+	}
+	if *beam > 1 {
+		searched := BeamSearch(&net, tokens, walkers[0].Position, *beam, walk, done, write)
+		if searched.Stop == StopInterrupted {
+			save()
+			output.Flush()
+			Interrupt(&net, searched.Best.Position)
+			return
+		}
+		fmt.Fprintln(output, searched)
+		save()
+		return
+	}
+	wandered := Wander(walkers, tokens, walk, done, write)
+	if wandered.Stop == StopInterrupted {
+		save()
+		output.Flush()
+		interrupt(wandered)
+		return
+	}
+	fmt.Fprintln(output, wandered)
+	for _, cycle := range wandered.Cycles {
+		for j, member := range cycle.Members {
+			cycle.Members[j] = tokens[member].Offset
+		}
+		fmt.Fprintln(output, cycle)
+	}
+	save()
+}
+
+// Wander follows the output codes of the networks of the walkers around the tokens concurrently, calling fn with
+// each jump of a walker, until a stop condition of the walk fires or done is closed.
+// The walkers share the visited positions, a walker that revisits a position stops on its own.
+// A repetition of the positions addressed by the codes of a walker is recorded as a cycle
+func Wander(walkers []Walker, tokens []Token, walk Walk, done <-chan struct{}, fn func(jump Jump)) Wandered {
+	length := len(tokens)
+	wandered, start := Wandered{Position: walkers[0].Position, Length: length}, time.Now()
+	if length == 0 {
+		wandered.Stop = StopCovered
+		return wandered
+	}
+	var lock sync.Mutex
+	seen, rng := make(map[int]bool, 8+len(walk.Seen)), rand.New(rand.NewSource(walk.Seed))
+	for _, position := range walk.Seen {
+		seen[position] = true
+	}
+	for _, walker := range walkers {
+		seen[walker.Position] = true
+	}
+	// random picks a random unvisited position, scanning from a random position once the picks keep hitting visited positions
+	random := func() int {
+		for i := 0; i < 64; i++ {
+			if position := rng.Intn(length); !seen[position] {
+				return position
+			}
+		}
+		position := rng.Intn(length)
+		for seen[position] {
+			position = (position + 1) % length
+		}
+		return position
+	}
+	// fallback picks the unvisited position to move on to from the visited position
+	fallback := func(position int) int {
+		switch walk.Fallback {
+		case FallbackRandom:
+			return random()
+		case FallbackNearest:
+			for distance := 1; ; distance++ {
+				if after := (position + distance) % length; !seen[after] {
+					return after
+				}
+				if before := ((position-distance)%length + length) % length; !seen[before] {
+					return before
+				}
+			}
+		}
+		for seen[position] {
+			position = (position + 1) % length
+		}
+		return position
+	}
+	if len(seen) == length {
+		wandered.Stop = StopCovered
+	}
+	var group sync.WaitGroup
+	run := func(i int) {
+		defer group.Done()
+		walker := &walkers[i]
+		in := NewInput(walker.Net)
+		// the path of the walker, the recent positions addressed by its codes and whether they are repeating
+		path, addressed, attempts, cycling := []int{walker.Position}, []int{}, 0, false
+		for {
+			lock.Lock()
+			select {
+			case <-done:
+				wandered.Stop = StopInterrupted
+			default:
+			}
+			switch {
+			case wandered.Stop != "":
+			case walk.MaxSteps > 0 && wandered.Steps >= walk.MaxSteps:
+				wandered.Stop = StopSteps
+			case walk.MaxDuration > 0 && time.Since(start) >= walk.MaxDuration:
+				wandered.Stop = StopSeconds
+			}
+			stopped := wandered.Stop != ""
+			lock.Unlock()
+			if stopped {
+				return
+			}
+
+			walker.Lock.Lock()
+			walker.Net.InputTokens(in, tokens, walker.Position)
+			out, _ := walker.Net.Fire(in)
+			c := walker.Net.Decode(out).Label
+			if walk.Novelty > 0 {
+				c = walker.Net.Novel(tokens, path[max(0, len(path)-walk.Recent):], c, walk.Novelty)
+			}
+			walker.Lock.Unlock()
+
+			lock.Lock()
+			if wandered.Stop != "" {
+				lock.Unlock()
+				return
+			}
+			position, teleport := c%length, walk.Teleport > 0 && rng.Float64() < walk.Teleport
+			period := Period(append(addressed, position), CyclePeriod)
+			if period > 0 && !teleport {
+				if attempts == 0 && !cycling {
+					members := append(addressed[len(addressed)+1-period:], position)
+					wandered.Cycles = append(wandered.Cycles, Cycle{Walker: i, Step: wandered.Steps, Members: append([]int{}, members...)})
+					cycling = true
+				}
+				if attempts < walk.BreakCycles {
+					attempts++
+					seed := rng.Int63()
+					lock.Unlock()
+					walker.Lock.Lock()
+					walker.Net.Reseed(seed)
+					Trace("reseed", "walker", i, "seed", seed, "code", c)
+					walker.Lock.Unlock()
+					continue
+				}
+			} else if period == 0 {
+				cycling = false
+			}
+			attempts = 0
+			if addressed = append(addressed, c%length); len(addressed) > 2*CyclePeriod {
+				addressed = append(addressed[:0], addressed[len(addressed)-2*CyclePeriod:]...)
+			}
+			switch {
+			case teleport:
+				position = random()
+				wandered.Teleports++
+			case seen[position] && walk.StopOnRevisit:
+				lock.Unlock()
+				return
+			case seen[position]:
+				position = fallback(position)
+			}
+			jump := Jump{Walker: i, From: walker.Position, To: position, Addressed: c % length, Code: c, Teleport: teleport}
+			seen[position], walker.Position = true, position
+			path = append(path, position)
+			Trace("wander", "walker", i, "position", position, "code", c)
+			fn(jump)
+			wandered.Steps++
+			if len(seen) == length {
+				wandered.Stop = StopCovered
+			}
+			lock.Unlock()
+		}
+	}
+	group.Add(len(walkers))
+	for i := range walkers {
+		go run(i)
+	}
+	group.Wait()
+	if wandered.Stop == "" {
+		wandered.Stop = StopRevisit
+	}
+	wandered.Position, wandered.Visited = walkers[0].Position, len(seen)
+	for position := range seen {
+		wandered.Seen = append(wandered.Seen, position)
+	}
+	sort.Ints(wandered.Seen)
+	return wandered
+}
+
+// Period is the shortest period up to limit the end of the addresses repeats with, twice in a row, 0 when they don't repeat
+func Period(addresses []int, limit int) int {
+	for period := 1; period <= limit && 2*period <= len(addresses); period++ {
+		end, repeats := len(addresses), true
+		for i := 1; i <= period && repeats; i++ {
+			repeats = addresses[end-i] == addresses[end-i-period]
+		}
+		if repeats {
+			return period
+		}
+	}
+	return 0
+}
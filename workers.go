@@ -0,0 +1,110 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// WorkersAuto tunes the number of workers at startup
+const WorkersAuto = -1
+
+// WorkerCount is the number of workers the samples are computed on, 0 is GOMAXPROCS
+type WorkerCount int
+
+// String returns the number of workers
+func (w *WorkerCount) String() string {
+	if *w == WorkersAuto {
+		return "auto"
+	}
+	return strconv.Itoa(int(*w))
+}
+
+// Set sets the number of workers, auto tunes the number of workers
+func (w *WorkerCount) Set(value string) error {
+	if value == "auto" {
+		*w = WorkersAuto
+		return nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return fmt.Errorf("workers must be auto or a count, not %s", value)
+	}
+	*w = WorkerCount(count)
+	return nil
+}
+
+// FlagWorkers is the number of workers the samples are computed on
+var FlagWorkers WorkerCount
+
+func init() {
+	flag.Var(&FlagWorkers, "workers", "number of workers the samples are computed on, 0 for GOMAXPROCS or auto to benchmark the counts at startup")
+}
+
+// Work runs the tasks until the queue is closed
+func Work(tasks <-chan Task) {
+	for task := range tasks {
+		task.Run()
+	}
+}
+
+// StartWorkers starts the workers once
+func StartWorkers() {
+	workers.Do(func() {
+		count := int(FlagWorkers)
+		switch {
+		case FlagWorkers == WorkersAuto:
+			count = TuneWorkers(50 * time.Millisecond)
+			slog.Debug("tuned workers", "count", count)
+		case count == 0:
+			count = runtime.GOMAXPROCS(0)
+		}
+		for i := 0; i < count; i++ {
+			go Work(Tasks)
+		}
+	})
+}
+
+// TuneWorkers benchmarks sampling a network configured by the flags with increasing numbers of workers
+// for about budget each and returns the fastest count. The number of chunks isn't tuned, each chunk has its
+// own random number generator so the number of chunks changes the results
+func TuneWorkers(budget time.Duration) int {
+	net := NewFlagNet(3)
+	input := NewInput(&net)
+	rng := rand.New(rand.NewSource(1))
+	for i := range input.Data {
+		input.Data[i] = float32(rng.NormFloat64())
+	}
+	procs := runtime.GOMAXPROCS(0)
+	counts := []int{}
+	for count := 1; count < 2*procs; count *= 2 {
+		counts = append(counts, count)
+	}
+	counts = append(counts, procs, 2*procs)
+	best, fastest := procs, time.Duration(0)
+	for _, count := range counts {
+		tasks := make(chan Task, 3*Chunks)
+		for i := 0; i < count; i++ {
+			go Work(tasks)
+		}
+		start, runs := time.Now(), 0
+		for runs < 3 || time.Since(start) < budget {
+			net.sample(tasks, input, input)
+			runs++
+		}
+		close(tasks)
+		elapsed := time.Since(start) / time.Duration(runs)
+		if fastest == 0 || elapsed < fastest {
+			best, fastest = count, elapsed
+		}
+	}
+	return best
+}
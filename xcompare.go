@@ -0,0 +1,169 @@
+// Copyright 2023 The Testament Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// Profile is the code and entropy profile of a text under a model
+type Profile struct {
+	Count     int
+	Codes     []int
+	Entropy   []float64
+	Bigrams   map[[2]int]int
+	Entropies []float32
+}
+
+// Frozen loads a frozen copy of the model
+func Frozen(model string) Net {
+	net, err := LoadNet(model)
+	if err != nil {
+		panic(err)
+	}
+	net.Frozen = true
+	return net
+}
+
+// Score colors the data with a frozen copy of the model
+func Score(model string, data []byte, fn func(symbol Symbol)) {
+	net := Frozen(model)
+	Color(&net, data, 0, nil, fn)
+}
+
+// NewProfile scores the data with the model, the profile has an entry for each code of the model
+func NewProfile(model string, data []byte) Profile {
+	net := Frozen(model)
+	profile := Profile{
+		Codes:   make([]int, net.Codes()),
+		Entropy: make([]float64, net.Codes()),
+		Bigrams: make(map[[2]int]int),
+	}
+	previous := -1
+	Color(&net, data, 0, nil, func(symbol Symbol) {
+		profile.Count++
+		profile.Codes[symbol.Code]++
+		profile.Entropy[symbol.Code] += float64(symbol.Entropy)
+		profile.Entropies = append(profile.Entropies, symbol.Entropy)
+		if previous >= 0 {
+			profile.Bigrams[[2]int{previous, symbol.Code}]++
+		}
+		previous = symbol.Code
+	})
+	return profile
+}
+
+// Histogram buckets the entropies using the bounds
+func (p Profile) Histogram(bounds []float32) []int {
+	histogram := make([]int, len(bounds)+1)
+	for _, entropy := range p.Entropies {
+		histogram[sort.Search(len(bounds), func(i int) bool {
+			return entropy < bounds[i]
+		})]++
+	}
+	return histogram
+}
+
+// LogRatio is the smoothed log ratio of the frequencies of a pattern in a and b
+func LogRatio(a, totalA, b, totalB, patterns int) float64 {
+	pa := (float64(a) + 1) / (float64(totalA) + float64(patterns))
+	pb := (float64(b) + 1) / (float64(totalB) + float64(patterns))
+	return math.Log2(pa / pb)
+}
+
+// XCompare compares two corpora under one frozen model
+func XCompare(args []string) {
+	flags := flag.NewFlagSet("xcompare", flag.ExitOnError)
+	model := flags.String("model", "", "the model to score with")
+	a := flags.String("a", "", "the first corpus")
+	b := flags.String("b", "", "the second corpus")
+	buckets := flags.Int("buckets", 8, "number of entropy buckets")
+	top := flags.Int("top", 10, "number of code patterns to report")
+	flags.Parse(args)
+	if *model == "" || *a == "" || *b == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	profileA, profileB := NewProfile(*model, Load(*a)), NewProfile(*model, Load(*b))
+	if profileA.Count == 0 || profileB.Count == 0 {
+		panic("corpora must not be empty")
+	}
+
+	fmt.Printf("\ncodes\n%4s %10s %10s %10s %10s %10s\n", "code", "a", "b", "log2(a/b)", "entropy a", "entropy b")
+	for code := range profileA.Codes {
+		ca, cb := profileA.Codes[code], profileB.Codes[code]
+		ea, eb := 0.0, 0.0
+		if ca > 0 {
+			ea = profileA.Entropy[code] / float64(ca)
+		}
+		if cb > 0 {
+			eb = profileB.Entropy[code] / float64(cb)
+		}
+		fmt.Printf("%4d %9.2f%% %9.2f%% %10.3f %10.4f %10.4f\n", code,
+			100*float64(ca)/float64(profileA.Count), 100*float64(cb)/float64(profileB.Count),
+			LogRatio(ca, profileA.Count, cb, profileB.Count, len(profileA.Codes)), ea, eb)
+	}
+
+	all := append(append([]float32{}, profileA.Entropies...), profileB.Entropies...)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i] < all[j]
+	})
+	bounds := make([]float32, 0, *buckets-1)
+	for i := 1; i < *buckets; i++ {
+		bounds = append(bounds, all[i*len(all) / *buckets])
+	}
+	histogramA, histogramB := profileA.Histogram(bounds), profileB.Histogram(bounds)
+	fmt.Printf("\nentropy\n%20s %10s %10s %10s\n", "bucket", "a", "b", "log2(a/b)")
+	for i := range histogramA {
+		low, high := "-inf", "+inf"
+		if i > 0 {
+			low = fmt.Sprintf("%.4f", bounds[i-1])
+		}
+		if i < len(bounds) {
+			high = fmt.Sprintf("%.4f", bounds[i])
+		}
+		fmt.Printf("%20s %9.2f%% %9.2f%% %10.3f\n", low+".."+high,
+			100*float64(histogramA[i])/float64(profileA.Count), 100*float64(histogramB[i])/float64(profileB.Count),
+			LogRatio(histogramA[i], profileA.Count, histogramB[i], profileB.Count, len(histogramA)))
+	}
+
+	type Pattern struct {
+		Bigram [2]int
+		Ratio  float64
+	}
+	patterns := []Pattern{}
+	totalA, totalB, count := profileA.Count-1, profileB.Count-1, len(profileA.Codes)*len(profileA.Codes)
+	for i := range profileA.Codes {
+		for j := range profileA.Codes {
+			bigram := [2]int{i, j}
+			patterns = append(patterns, Pattern{
+				Bigram: bigram,
+				Ratio:  LogRatio(profileA.Bigrams[bigram], totalA, profileB.Bigrams[bigram], totalB, count),
+			})
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].Ratio > patterns[j].Ratio
+	})
+	if *top > len(patterns)/2 {
+		*top = len(patterns) / 2
+	}
+	fmt.Printf("\ncode patterns over represented in a\n")
+	for _, pattern := range patterns[:*top] {
+		fmt.Printf("%s%s %8.3f\n", Colors[pattern.Bigram[0]]("%d", pattern.Bigram[0]),
+			Colors[pattern.Bigram[1]]("%d", pattern.Bigram[1]), pattern.Ratio)
+	}
+	fmt.Printf("\ncode patterns over represented in b\n")
+	for i := len(patterns) - 1; i >= len(patterns)-*top; i-- {
+		pattern := patterns[i]
+		fmt.Printf("%s%s %8.3f\n", Colors[pattern.Bigram[0]]("%d", pattern.Bigram[0]),
+			Colors[pattern.Bigram[1]]("%d", pattern.Bigram[1]), -pattern.Ratio)
+	}
+}